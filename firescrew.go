@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"embed"
-	"mime/multipart"
 	_ "net/http/pprof"
 	"runtime"
 
@@ -13,9 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
-	"image/color/palette"
 	"image/draw"
-	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
@@ -24,15 +21,20 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/8ff/firescrew/pkg/eventSinks"
 	"github.com/8ff/firescrew/pkg/firescrewServe"
+	"github.com/8ff/firescrew/pkg/frameSplitter"
+	"github.com/8ff/firescrew/pkg/notifier"
+	"github.com/8ff/firescrew/pkg/promMetrics"
 	"github.com/8ff/tuna"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/goki/freetype"
 	"github.com/goki/freetype/truetype"
 
@@ -42,14 +44,27 @@ import (
 
 var Version string
 
-var gifSliceMutex sync.Mutex
-var gifSlice []image.RGBA
-
 //go:embed assets/*
 var assetsFs embed.FS
 
 var stream *mjpeg.Stream
 
+// Prometheus metrics served on /metrics next to the output stream
+var (
+	metricsRegistry  = promMetrics.NewRegistry()
+	frameCounter     = promMetrics.NewCounterVec("firescrew_camera_frames_received_total", "Frames received from the low resolution feed.", "camera")
+	restartCounter   = promMetrics.NewCounterVec("firescrew_camera_restarts_total", "ffmpeg restarts by feed.", "camera", "feed")
+	feedErrorCounter = promMetrics.NewCounterVec("firescrew_camera_errors_total", "Feed errors by reason.", "camera", "reason")
+	viewerGauge      = promMetrics.NewGaugeVec("firescrew_camera_viewers", "Connected stream viewers.", "camera")
+	inputFPSGauge    = promMetrics.NewGaugeVec("firescrew_camera_input_fps", "Frames per second received from the low resolution feed.", "camera")
+	lastFrameGauge   = promMetrics.NewGaugeVec("firescrew_camera_last_frame_timestamp_seconds", "Unix time of the last received frame.", "camera")
+	httpDuration     = promMetrics.NewHistogramVec("firescrew_http_request_duration_seconds", "Time spent serving HTTP requests. Stream requests last as long as the viewer stays connected.", nil, "handler", "method", "code")
+)
+
+func init() {
+	metricsRegistry.Register(frameCounter, restartCounter, feedErrorCounter, viewerGauge, inputFPSGauge, lastFrameGauge, httpDuration)
+}
+
 type Config struct {
 	CameraName          string       `json:"cameraName"`
 	PrintDebug          bool         `json:"printDebug"`
@@ -65,23 +80,24 @@ type Config struct {
 		OnlyRemuxMp4  bool   `json:"onlyRemuxMp4"`
 	} `json:"video"`
 	Events struct {
-		Mqtt struct {
-			Host  string `json:"host"`
-			Port  int    `json:"port"`
-			User  string `json:"user"`
-			Pass  string `json:"pass"`
-			Topic string `json:"topic"`
-		}
+		Mqtt  eventSinks.MQTTConfig `json:"mqtt"`
 		Slack struct {
 			Url string `json:"url"`
 		}
-		ScriptPath string `json:"scriptPath"`
-		Webhook    string `json:"webhookUrl"`
+		ScriptPath    string                     `json:"scriptPath"`
+		Scripts       []eventSinks.ScriptConfig  `json:"scripts"`       // Scripts with timeouts, filters and JSON actions
+		ScriptWorkers int                        `json:"scriptWorkers"` // Scripts run at the same time, default 2
+		ScriptLog     string                     `json:"scriptLog"`     // Output of every script run, default scripts.log next to the config file
+		Webhook       string                     `json:"webhookUrl"`
+		Webhooks      []eventSinks.WebhookConfig `json:"webhooks"`      // Endpoints with retries, signing and headers
+		WebhookOutbox string                     `json:"webhookOutbox"` // Directory of queued webhook deliveries, default webhook-outbox next to the config file
 	} `json:"events"`
 	Notifications struct {
-		EnablePushoverAlerts bool   `json:"enablePushoverAlerts"`
-		PushoverAppToken     string `json:"pushoverAppToken"`
-		PushoverUserKey      string `json:"pushoverUserKey"`
+		Notifiers            []notifier.Config `json:"notifiers"` // Pushover, Telegram, ntfy, Gotify, email and Slack, each with optional cameras and types routing
+		Limits               *notifier.Limits  `json:"limits"`    // Cooldowns, hourly cap, quiet hours, dedup and digests across notifiers
+		EnablePushoverAlerts bool              `json:"enablePushoverAlerts"`
+		PushoverAppToken     string            `json:"pushoverAppToken"`
+		PushoverUserKey      string            `json:"pushoverUserKey"`
 	} `json:"notifications"`
 }
 
@@ -135,6 +151,10 @@ type Event struct {
 
 var globalConfig Config
 var runtimeConfig RuntimeConfig
+var webhookOutbox *eventSinks.Outbox
+var mqttClient *eventSinks.MQTTClient
+var notifications *notifier.Router
+var scriptRunner *eventSinks.ScriptRunner
 
 type Frame struct {
 	Data [][]byte
@@ -199,6 +219,9 @@ func readConfig(path string) Config {
 	Log("info", fmt.Sprintf("Events Slack URL: %s", config.Events.Slack.Url))
 	Log("info", fmt.Sprintf("Events Script Path: %s", config.Events.ScriptPath))
 	Log("info", fmt.Sprintf("Events Webhook URL: %s", config.Events.Webhook))
+	for _, webhook := range config.Events.Webhooks {
+		Log("info", fmt.Sprintf("Events Webhook: %s", webhook.URL))
+	}
 	Log("info", "************************************************")
 
 	// Load font into runtime
@@ -236,59 +259,112 @@ func eventHandler(eventType string, payload []byte) {
 	// Log the event type
 	// Log("event", fmt.Sprintf("Event: %s", eventType))
 
-	// Webhook URL
-	if globalConfig.Events.Webhook != "" {
-		resp, err := http.Post(globalConfig.Events.Webhook, "application/json", bytes.NewReader(payload))
-		if err != nil {
-			Log("error", fmt.Sprintf("Failed to post to webhook: %s", err))
-		} else {
-			defer resp.Body.Close()
-		}
+	// Webhooks are queued and retried until delivered
+	webhookOutbox.Enqueue(eventType, globalConfig.CameraName, payload)
+
+	// Scripts run on a bounded pool, their runs are listed on /api/scripts/runs
+	var ids struct {
+		ID string `json:"id"`
 	}
+	json.Unmarshal(payload, &ids)
+	scriptRunner.Run(eventSinks.Event{ID: ids.ID, Type: eventType, CameraID: globalConfig.CameraName, CameraName: globalConfig.CameraName}, payload)
 
-	// Script Path
-	if globalConfig.Events.ScriptPath != "" {
-		cmd := exec.Command(globalConfig.Events.ScriptPath)
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			Log("error", fmt.Sprintf("Failed to get stdin pipe: %s", err))
-			return
+	// Send to the notifiers routed to this event, Slack included
+	if notifications.Wants(eventType, globalConfig.CameraName) {
+		go notifications.Notify(context.Background(), notificationMessage(eventType, eventText(payload)))
+	}
+
+	// Send to MQTT over the shared connection
+	if mqttClient != nil {
+		if err := mqttClient.PublishEvent(eventType, globalConfig.CameraName, payload); err != nil {
+			Log("error", fmt.Sprintf("Failed to send to MQTT: %s", err))
 		}
+	}
+}
 
-		go func() {
-			defer stdin.Close()
-			_, err := stdin.Write(payload)
-			if err != nil {
-				Log("error", fmt.Sprintf("Failed to write to stdin: %s", err))
-			}
-		}()
+// openScriptRunner starts the runner for scriptPath and the scripts list. Returns nil if none are configured.
+func openScriptRunner(configPath string, config Config) (*eventSinks.ScriptRunner, error) {
+	scripts := config.Events.Scripts
+	if config.Events.ScriptPath != "" {
+		scripts = append([]eventSinks.ScriptConfig{{Path: config.Events.ScriptPath}}, scripts...)
+	}
+	if len(scripts) == 0 {
+		return nil, nil
+	}
 
-		if err := cmd.Start(); err != nil {
-			Log("error", fmt.Sprintf("Failed to start script: %s", err))
-		}
+	logPath := config.Events.ScriptLog
+	if logPath == "" {
+		logPath = "scripts.log"
+	}
+	if !filepath.IsAbs(logPath) {
+		logPath = filepath.Join(filepath.Dir(configPath), logPath)
+	}
+	runner, err := eventSinks.NewScriptRunner(scripts, config.Events.ScriptWorkers, logPath)
+	if err != nil {
+		return nil, err
 	}
+	runner.SetActionHandler(handleScriptAction)
+	return runner, nil
+}
 
-	// Send to Slack
-	if globalConfig.Events.Slack.Url != "" {
-		slackMessage := map[string]interface{}{
-			"text": fmt.Sprintf("Event: %s\nPayload: %s", eventType, string(payload)),
+// handleScriptAction carries out an action returned by an event script.
+// record starts a high resolution recording for seconds (default 30).
+func handleScriptAction(e eventSinks.Event, a eventSinks.ScriptAction) error {
+	switch a.Action {
+	case "record":
+		var params struct {
+			Seconds int `json:"seconds"`
 		}
-		slackPayload, _ := json.Marshal(slackMessage)
-		resp, err := http.Post(globalConfig.Events.Slack.Url, "application/json", bytes.NewReader(slackPayload))
-		if err != nil {
-			Log("error", fmt.Sprintf("Failed to post to Slack: %s", err))
-		} else {
-			defer resp.Body.Close()
+		if err := json.Unmarshal(a.Raw, &params); err != nil {
+			return err
+		}
+		if params.Seconds <= 0 {
+			params.Seconds = 30
 		}
+		filename := filepath.Join(globalConfig.Video.HiResPath, fmt.Sprintf("script-%s.ts", time.Now().Format("20060102-150405")))
+		if err := sendRecordMsg(RecordMsg{Record: true, Filename: filename}); err != nil {
+			return err
+		}
+		Log("event", fmt.Sprintf("Script for %s event started recording %s for %ds", e.Type, filename, params.Seconds))
+		time.AfterFunc(time.Duration(params.Seconds)*time.Second, func() {
+			if err := sendRecordMsg(RecordMsg{Record: false}); err != nil {
+				Log("error", fmt.Sprintf("Failed to stop script recording: %v", err))
+			}
+		})
+		return nil
+	default:
+		return fmt.Errorf("unknown action: %s", a.Action)
+	}
+}
+
+// sendRecordMsg hands a message to the high resolution recorder, which is not listening while it restarts
+func sendRecordMsg(msg RecordMsg) error {
+	select {
+	case runtimeConfig.HiResControlChannel <- msg:
+		return nil
+	case <-time.After(5 * time.Second):
+		return errors.New("recorder is not running")
 	}
+}
 
-	// Send to MQTT
-	if globalConfig.Events.Mqtt.Host != "" && globalConfig.Events.Mqtt.Port != 0 && globalConfig.Events.Mqtt.Topic != "" {
-		err := sendToMQTT(globalConfig.Events.Mqtt.Topic, string(payload), globalConfig.Events.Mqtt.Host, globalConfig.Events.Mqtt.Port, globalConfig.Events.Mqtt.User, globalConfig.Events.Mqtt.Pass)
-		if err != nil {
-			Log("error", fmt.Sprintf("Failed to send to MQTT: %s", err))
-		}
+// openWebhookOutbox starts delivery to webhookUrl and the webhooks list. Returns nil if none are configured.
+func openWebhookOutbox(configPath string, config Config) (*eventSinks.Outbox, error) {
+	webhooks := config.Events.Webhooks
+	if config.Events.Webhook != "" {
+		webhooks = append([]eventSinks.WebhookConfig{{URL: config.Events.Webhook}}, webhooks...)
+	}
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	dir := config.Events.WebhookOutbox
+	if dir == "" {
+		dir = "webhook-outbox"
 	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(configPath), dir)
+	}
+	return eventSinks.NewOutbox(dir, webhooks)
 }
 
 func Log(level, msg string) {
@@ -421,49 +497,19 @@ func processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg) {
 		return
 	}
 
-	frameCount := 0
-	frameData := bytes.NewBuffer(nil)
-	isFrameStarted := false
-
-	buffer := make([]byte, 8192) // Buffer size
-	for {
-		n, err := pipe.Read(buffer)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			msgChannel <- FrameMsg{Error: err.Error()}
-			return
-		}
-
-		frameData.Write(buffer[:n])
-
-		if bytes.HasPrefix(frameData.Bytes(), []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}) {
-			isFrameStarted = true
-		}
-
-		if isFrameStarted && bytes.HasSuffix(frameData.Bytes(), []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}) {
-			img, err := png.Decode(bytes.NewReader(frameData.Bytes()))
-			if err != nil {
-				msgChannel <- FrameMsg{Error: "Failed to decode PNG: " + err.Error()}
-			} else {
-				msgChannel <- FrameMsg{Frame: img}
-			}
-
-			frameCount++
-			frameData.Reset()
-			isFrameStarted = false
-		}
-
-		if frameData.Len() > 2*1024*1024 {
-			startIdx := bytes.Index(frameData.Bytes(), []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A})
-			if startIdx != -1 {
-				frameData.Next(startIdx)
-				isFrameStarted = true
-			} else {
-				frameData.Reset()
-				isFrameStarted = false
-			}
+	// Frame boundaries come from the PNG chunks, not from where a read ends
+	splitter := frameSplitter.New(frameSplitter.PNG, frameSplitter.DefaultMaxFrameSize)
+	err = splitter.Split(pipe, func(frame []byte) {
+		img, err := png.Decode(bytes.NewReader(frame))
+		if err != nil {
+			msgChannel <- FrameMsg{Error: "Failed to decode PNG: " + err.Error()}
+		} else {
+			msgChannel <- FrameMsg{Frame: img}
 		}
+	})
+	if err != nil {
+		msgChannel <- FrameMsg{Error: err.Error()}
+		return
 	}
 
 	err = cmd.Wait()
@@ -667,8 +713,32 @@ func main() {
 	// Read the config file
 	globalConfig = readConfig(os.Args[1])
 
+	var err error
+	webhookOutbox, err = openWebhookOutbox(os.Args[1], globalConfig)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error starting webhooks: %v", err))
+		os.Exit(1)
+	}
+	scriptRunner, err = openScriptRunner(os.Args[1], globalConfig)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error starting scripts: %v", err))
+		os.Exit(1)
+	}
+	notifications, err = openNotifiers(globalConfig)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error starting notifications: %v", err))
+		os.Exit(1)
+	}
+	if globalConfig.Events.Mqtt.Host != "" {
+		mqttClient, err = eventSinks.NewMQTTClient(globalConfig.Events.Mqtt)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error starting MQTT: %v", err))
+			os.Exit(1)
+		}
+	}
+
 	// Check if ffmpeg/ffprobe binaries are available
-	_, err := CheckFFmpegAndFFprobe()
+	_, err = CheckFFmpegAndFFprobe()
 	if err != nil {
 		Log("error", fmt.Sprintf("Unable to find ffmpeg/ffprobe binaries. Please install them: %s", err))
 		os.Exit(2)
@@ -773,6 +843,7 @@ func main() {
 			// defer close(runtimeConfig.HiResControlChannel)
 			time.Sleep(5 * time.Second)
 			Log("warning", "Restarting HI RTSP feed")
+			restartCounter.Inc(globalConfig.CameraName, "hi")
 		}
 	}()
 
@@ -784,20 +855,34 @@ func main() {
 			//*********** EXITS BELOW ***********//
 			time.Sleep(5 * time.Second)
 			Log("warning", "Restarting LO RTSP feed")
+			restartCounter.Inc(globalConfig.CameraName, "lo")
 		}
 	}(frameChannel)
 	// go dumpRtspFrames(globalConfig.DeviceUrl, "/Volumes/RAMDisk/", 4) // 1 means mod every nTh frame
 	// go readFramesFromRam(frameChannel, "/Volumes/RAMDisk/")
 
+	var lastFrame time.Time
+	var inputFPS float64
 	for msg := range frameChannel {
 		if msg.Error != "" {
 			Log("error", msg.Error)
+			feedErrorCounter.Inc(globalConfig.CameraName, feedErrorReason(msg.Error))
 			continue
 		}
 
 		if msg.Frame != nil {
 			ptime.Start() // DEBUG TIMER
 
+			// Smoothed input rate for the metrics endpoint
+			now := time.Now()
+			if dt := now.Sub(lastFrame).Seconds(); !lastFrame.IsZero() && dt > 0 {
+				inputFPS = 0.8*inputFPS + 0.2/dt
+			}
+			lastFrame = now
+			frameCounter.Inc(globalConfig.CameraName)
+			inputFPSGauge.Set(inputFPS, globalConfig.CameraName)
+			lastFrameGauge.Set(float64(now.UnixMilli())/1000, globalConfig.CameraName)
+
 			rgba, ok := msg.Frame.(*image.RGBA)
 			if !ok {
 				// Convert to RGBA if it's not already
@@ -830,9 +915,30 @@ func streamImage(img *image.RGBA, stream *mjpeg.Stream) {
 	stream.UpdateJPEG(buf.Bytes())
 }
 
+// feedErrorReason maps a feed error message to the reason label of the error counter
+func feedErrorReason(msg string) string {
+	switch {
+	case strings.HasPrefix(msg, "Failed to decode PNG"):
+		return "decode"
+	case strings.HasPrefix(msg, "FFmpeg exited"):
+		return "exit"
+	case strings.HasPrefix(msg, "FFmpeg STDERR"):
+		return "stderr"
+	}
+	return "error"
+}
+
 func startWebcamStream(stream *mjpeg.Stream) {
 	// start http server
-	http.Handle("/", stream)
+	viewers := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viewerGauge.Add(1, globalConfig.CameraName)
+		defer viewerGauge.Add(-1, globalConfig.CameraName)
+		stream.ServeHTTP(w, r)
+	})
+	http.Handle("/", promMetrics.InstrumentHandler(viewers, httpDuration, "/"))
+	http.Handle("/metrics", metricsRegistry)
+	http.Handle("/api/webhooks/deliveries", promMetrics.InstrumentHandler(webhookOutbox, httpDuration, "/api/webhooks/deliveries"))
+	http.Handle("/api/scripts/runs", promMetrics.InstrumentHandler(scriptRunner, httpDuration, "/api/scripts/runs"))
 
 	server := &http.Server{
 		Addr:         globalConfig.OutputStreamAddr,
@@ -904,169 +1010,53 @@ func saveJPEG(filename string, img *image.RGBA, quality int) {
 	}
 }
 
-func sendToMQTT(topic string, message string, host string, port int, user string, pass string) error {
-	// MQTT client options
-	opts := mqtt.NewClientOptions().AddBroker(fmt.Sprintf("tcp://%s:%d", host, port))
-
-	if user != "" && pass != "" {
-		opts.SetUsername(user)
-		opts.SetPassword(pass)
-	}
-
-	// Create and connect the client
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		Log("error", fmt.Sprintf("Failed to connect to MQTT: %s", token.Error()))
-		return token.Error() // Return the connection error
-	}
-	defer client.Disconnect(250)
-
-	// Publish the message
-	token := client.Publish(topic, 0, false, message)
-	token.Wait()
-	if token.Error() != nil {
-		Log("error", fmt.Sprintf("Failed to publish to MQTT: %s", token.Error()))
-		return token.Error() // Return the publishing error
+// notificationMessage returns a message about this camera
+func notificationMessage(eventType string, text string) notifier.Message {
+	return notifier.Message{
+		Title:      fmt.Sprintf("%s: %s", globalConfig.CameraName, eventType),
+		Text:       text,
+		EventType:  eventType,
+		CameraID:   globalConfig.CameraName,
+		CameraName: globalConfig.CameraName,
+		Time:       time.Now(),
 	}
-
-	return nil // Return nil if there were no errors
 }
 
-func sendPushoverNotification(userKey string, appToken string, msg string, img *image.RGBA) error {
-	// Convert the image to JPEG format
-	var imgBuffer bytes.Buffer
-	if err := jpeg.Encode(&imgBuffer, img, nil); err != nil {
-		return fmt.Errorf("error encoding image: %v", err)
-	}
-
-	// Create a new HTTP request
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
-	// Set up form fields
-	if err := w.WriteField("token", appToken); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-	if err := w.WriteField("user", userKey); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-	if err := w.WriteField("message", msg); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-
-	// Attach the in-memory image as an attachment
-	fw, err := w.CreateFormFile("attachment", "image.jpg")
-	if err != nil {
-		return fmt.Errorf("CreateFormFile Error: %v", err)
-	}
-	if _, err := io.Copy(fw, &imgBuffer); err != nil {
-		return fmt.Errorf("copy File Error: %v", err)
-	}
-
-	// Close the writer
-	w.Close()
-
-	// Create a HTTP request to Pushover API
-	req, err := http.NewRequest("POST", "https://api.pushover.net/1/messages.json", &b)
-	if err != nil {
-		return fmt.Errorf("NewRequest Error: %v", err)
-	}
-
-	// Set the content type, this will include the boundary.
-	req.Header.Set("Content-Type", w.FormDataContentType())
-
-	// Execute the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error executing request: %v", err)
+// eventText formats the top level fields of an event payload as one "key: value" line each
+func eventText(payload []byte) string {
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return string(payload)
 	}
-	defer resp.Body.Close()
-
-	// Check the response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Non-OK HTTP status: %s", resp.Status)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return nil
-}
-
-// CreateGIF creates a GIF file from a slice of *image.RGBA images
-func CreateGIF(images []image.RGBA, outputPath string, delay int) error {
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
-
-	anim := &gif.GIF{}
-	for _, srcImg := range images {
-		// Convert image.RGBA to *image.Paletted
-		bounds := srcImg.Bounds()
-		palettedImage := image.NewPaletted(bounds, palette.Plan9)
-		draw.Draw(palettedImage, palettedImage.Rect, &srcImg, bounds.Min, draw.Over)
-
-		anim.Image = append(anim.Image, palettedImage)
-		anim.Delay = append(anim.Delay, delay)
+	var lines []string
+	for _, k := range keys {
+		switch v := fields[k].(type) {
+		case string, float64, bool:
+			lines = append(lines, fmt.Sprintf("%s: %v", k, v))
+		case nil:
+		default:
+			// Nested values stay compact JSON
+			data, _ := json.Marshal(v)
+			lines = append(lines, fmt.Sprintf("%s: %s", k, data))
+		}
 	}
-
-	return gif.EncodeAll(outFile, anim)
+	return strings.Join(lines, "\n")
 }
 
-func sendPushoverNotificationGif(userKey string, appToken string, msg string, gifPath string) error {
-	// Open the GIF file
-	file, err := os.Open(gifPath)
-	if err != nil {
-		return fmt.Errorf("Error opening GIF file: %v", err)
-	}
-	defer file.Close()
-
-	// Create a new HTTP request
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
-	// Set up form fields
-	if err := w.WriteField("token", appToken); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-	if err := w.WriteField("user", userKey); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-	if err := w.WriteField("message", msg); err != nil {
-		return fmt.Errorf("WriteField Error: %v", err)
-	}
-
-	// Attach the GIF file as an attachment
-	fw, err := w.CreateFormFile("attachment", "image.gif")
-	if err != nil {
-		return fmt.Errorf("CreateFormFile Error: %v", err)
-	}
-	if _, err := io.Copy(fw, file); err != nil {
-		return fmt.Errorf("Copy File Error: %v", err)
-	}
-
-	// Close the writer
-	w.Close()
-
-	// Create a HTTP request to Pushover API
-	req, err := http.NewRequest("POST", "https://api.pushover.net/1/messages.json", &b)
-	if err != nil {
-		return fmt.Errorf("NewRequest Error: %v", err)
-	}
-
-	// Set the content type, this will include the boundary.
-	req.Header.Set("Content-Type", w.FormDataContentType())
-
-	// Execute the request
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error executing request: %v", err)
+// openNotifiers creates the notifiers, including the legacy Pushover and Slack settings
+func openNotifiers(config Config) (*notifier.Router, error) {
+	configs := config.Notifications.Notifiers
+	if config.Notifications.EnablePushoverAlerts {
+		configs = append(configs, notifier.Config{Type: notifier.TypePushover, Token: config.Notifications.PushoverAppToken, User: config.Notifications.PushoverUserKey})
 	}
-	defer resp.Body.Close()
-
-	// Check the response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Non-OK HTTP status: %s", resp.Status)
+	if config.Events.Slack.Url != "" {
+		configs = append(configs, notifier.Config{Type: notifier.TypeSlack, URL: config.Events.Slack.Url})
 	}
-
-	return nil
+	return notifier.NewRouter(configs, config.Notifications.Limits)
 }
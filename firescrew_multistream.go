@@ -17,15 +17,9 @@ func main() {
 		log.Fatalf("Failed to create stream manager: %v", err)
 	}
 
-	// Start all enabled cameras
+	// Start always-on and currently scheduled cameras, on-demand cameras start with their first viewer
 	cameras := sm.GetAllCameras()
-	for _, camera := range cameras {
-		if camera.Enabled {
-			if err := sm.StartStream(camera.ID); err != nil {
-				log.Printf("Failed to start stream for camera %s: %v", camera.ID, err)
-			}
-		}
-	}
+	sm.Start()
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
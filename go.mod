@@ -15,6 +15,7 @@ require (
 	github.com/hybridgroup/mjpeg v0.0.0-20140228234708-4680f319790e
 	github.com/pion/rtp v1.8.1
 	github.com/tj/go-naturaldate v1.3.0
+	golang.org/x/image v0.33.0
 )
 
 require (
@@ -24,7 +25,6 @@ require (
 	github.com/pion/randutil v0.1.0 // indirect
 	github.com/pion/rtcp v1.2.10 // indirect
 	github.com/pion/sdp/v3 v3.0.6 // indirect
-	golang.org/x/image v0.33.0 // indirect
 	golang.org/x/net v0.14.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
@@ -0,0 +1,268 @@
+// Package eventSinks routes camera events to external systems: webhooks, MQTT brokers
+// and local scripts. Each sink has its own queue and filter, so a slow or failing sink
+// never delays the others or the code that produced the event.
+package eventSinks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// sinkQueueSize is the number of events buffered per sink before new events are dropped
+const sinkQueueSize = 256
+
+// Event is a camera event delivered to sinks as JSON
+type Event struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Time       time.Time      `json:"time"`
+	CameraID   string         `json:"cameraId,omitempty"`
+	CameraName string         `json:"cameraName,omitempty"`
+	Data       map[string]any `json:"data,omitempty"`
+}
+
+// Filter selects the events a sink receives
+type Filter struct {
+	Types   []string `json:"types,omitempty"`   // Event types, empty matches every type
+	Cameras []string `json:"cameras,omitempty"` // Camera IDs, empty matches every camera
+}
+
+// Match reports whether the filter selects an event
+func (f Filter) Match(e Event) bool {
+	return matchAny(f.Types, e.Type) && (e.CameraID == "" || matchAny(f.Cameras, e.CameraID))
+}
+
+// matchAny reports whether values is empty or contains v
+func matchAny(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Config lists the sinks events are sent to
+type Config struct {
+	Webhooks  []WebhookConfig `json:"webhooks,omitempty"`
+	OutboxDir string          `json:"outboxDir,omitempty"` // Directory of queued webhook deliveries, empty keeps them in memory
+	MQTT      []MQTTConfig    `json:"mqtt,omitempty"`
+	Scripts   []ScriptConfig  `json:"scripts,omitempty"`
+
+	ScriptWorkers int    `json:"scriptWorkers,omitempty"` // Scripts run at the same time, default 2
+	ScriptLog     string `json:"scriptLog,omitempty"`     // File the output of every script run is appended to, empty keeps runs in memory only
+}
+
+// Sink delivers events to one destination
+type Sink interface {
+	Name() string
+	Send(e Event, payload []byte) error
+}
+
+// route is a sink with its filter and queue
+type route struct {
+	sink   Sink
+	filter Filter
+	queue  chan Event
+}
+
+// Dispatcher fans events out to the configured sinks
+type Dispatcher struct {
+	enrich func(e *Event)
+	routes []*route
+	outbox *Outbox       // Webhook deliveries, nil without webhooks
+	script *ScriptRunner // Script runs, nil without scripts
+	queue  chan Event
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// New validates the config and starts a dispatcher for its sinks.
+// enrich, if not nil, fills in event fields before routing. It runs on the dispatcher's
+// goroutine, so it may take locks the producer of the event holds.
+func New(cfg Config, enrich func(e *Event)) (*Dispatcher, error) {
+	// Validate everything before starting connections that would have to be torn down again
+	for i, c := range cfg.MQTT {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("mqtt %d: %w", i, err)
+		}
+	}
+	for i, c := range cfg.Scripts {
+		if c.Path == "" {
+			return nil, fmt.Errorf("script %d: path is required", i)
+		}
+	}
+
+	d := &Dispatcher{enrich: enrich, queue: make(chan Event, sinkQueueSize)}
+	if len(cfg.Scripts) > 0 {
+		runner, err := NewScriptRunner(cfg.Scripts, cfg.ScriptWorkers, cfg.ScriptLog)
+		if err != nil {
+			return nil, err
+		}
+		d.script = runner
+	}
+	if len(cfg.Webhooks) > 0 {
+		outbox, err := NewOutbox(cfg.OutboxDir, cfg.Webhooks)
+		if err != nil {
+			d.script.Close()
+			return nil, err
+		}
+		d.outbox = outbox
+		// Each webhook applies its own filter when the event is queued
+		d.add(outboxSink{outbox}, Filter{})
+	}
+	if d.script != nil {
+		// Each script applies its own filter when the event is queued
+		d.add(scriptSink{d.script}, Filter{})
+	}
+	for _, c := range cfg.MQTT {
+		client, err := NewMQTTClient(c)
+		if err != nil {
+			// Only if the TLS files changed since validation
+			log.Printf("Skipping MQTT broker %s: %v", c.Host, err)
+			continue
+		}
+		d.add(&mqttSink{client: client}, c.Filter)
+	}
+
+	d.wg.Add(1)
+	go d.run()
+	return d, nil
+}
+
+// add starts a worker for a sink
+func (d *Dispatcher) add(sink Sink, filter Filter) {
+	r := &route{sink: sink, filter: filter, queue: make(chan Event, sinkQueueSize)}
+	d.routes = append(d.routes, r)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for e := range r.queue {
+			payload, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if err := r.sink.Send(e, payload); err != nil {
+				log.Printf("Failed to send %s event to %s: %v", e.Type, r.sink.Name(), err)
+			}
+		}
+	}()
+}
+
+// Dispatch queues an event for delivery without blocking. A nil dispatcher drops the event.
+func (d *Dispatcher) Dispatch(e Event) {
+	if d == nil || len(d.routes) == 0 {
+		return
+	}
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	select {
+	case d.queue <- e:
+	default:
+		log.Printf("Event queue full, dropping %s event", e.Type)
+	}
+}
+
+// run routes queued events to the sinks whose filter matches
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+	for e := range d.queue {
+		if d.enrich != nil {
+			d.enrich(&e)
+		}
+		for _, r := range d.routes {
+			if !r.filter.Match(e) {
+				continue
+			}
+			select {
+			case r.queue <- e:
+			default:
+				log.Printf("Queue of %s full, dropping %s event", r.sink.Name(), e.Type)
+			}
+		}
+	}
+	for _, r := range d.routes {
+		close(r.queue)
+	}
+}
+
+// MQTTClients returns the connections to the configured brokers
+func (d *Dispatcher) MQTTClients() []*MQTTClient {
+	if d == nil {
+		return nil
+	}
+	var clients []*MQTTClient
+	for _, r := range d.routes {
+		if s, ok := r.sink.(*mqttSink); ok {
+			clients = append(clients, s.client)
+		}
+	}
+	return clients
+}
+
+// Outbox returns the webhook deliveries, nil if no webhooks are configured
+func (d *Dispatcher) Outbox() *Outbox {
+	if d == nil {
+		return nil
+	}
+	return d.outbox
+}
+
+// Scripts returns the script runner, nil if no scripts are configured
+func (d *Dispatcher) Scripts() *ScriptRunner {
+	if d == nil {
+		return nil
+	}
+	return d.script
+}
+
+// Close stops accepting events, waits for queued events to be sent and scripts to finish, and
+// disconnects from the brokers. Webhook deliveries still pending stay in the outbox.
+// Dispatch must not be called after Close.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() { close(d.queue) })
+	d.wg.Wait()
+	d.outbox.Close()
+	d.script.Close()
+	for _, r := range d.routes {
+		if closer, ok := r.sink.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
+
+// outboxSink queues events for the webhooks
+type outboxSink struct {
+	outbox *Outbox
+}
+
+func (s outboxSink) Name() string {
+	return "webhook outbox"
+}
+
+func (s outboxSink) Send(e Event, payload []byte) error {
+	s.outbox.Enqueue(e.Type, e.CameraID, payload)
+	return nil
+}
+
+// newEventID returns a random event ID receivers can use to drop duplicates
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+package eventSinks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		event  Event
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, event: Event{Type: "motion_start", CameraID: "a"}, want: true},
+		{name: "type match", filter: Filter{Types: []string{"camera_offline"}}, event: Event{Type: "camera_offline"}, want: true},
+		{name: "type mismatch", filter: Filter{Types: []string{"camera_offline"}}, event: Event{Type: "motion_start"}, want: false},
+		{name: "camera mismatch", filter: Filter{Cameras: []string{"a"}}, event: Event{Type: "motion_start", CameraID: "b"}, want: false},
+		{name: "event without camera", filter: Filter{Cameras: []string{"a"}}, event: Event{Type: "config_changed"}, want: true},
+		{name: "both match", filter: Filter{Types: []string{"motion_end"}, Cameras: []string{"a", "b"}}, event: Event{Type: "motion_end", CameraID: "b"}, want: true},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Match(test.event); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	received := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		received <- e
+	}))
+	defer server.Close()
+
+	// The script copies the event to a file
+	out := filepath.Join(t.TempDir(), "event.json")
+	script := filepath.Join(t.TempDir(), "handler.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\ncat > \"$1\"\n"), 0755)
+
+	d, err := New(Config{
+		Webhooks:  []WebhookConfig{{URL: server.URL, Filter: Filter{Types: []string{"camera_offline"}}}},
+		OutboxDir: t.TempDir(),
+		Scripts:   []ScriptConfig{{Path: script, Args: []string{out}, Filter: Filter{Cameras: []string{"a"}}}},
+	}, func(e *Event) { e.CameraName = "Camera " + e.CameraID })
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Dispatch(Event{Type: "motion_start", CameraID: "a"})
+	d.Dispatch(Event{Type: "camera_offline", CameraID: "b"})
+
+	// Webhooks are delivered from the outbox, independently of Close
+	select {
+	case e := <-received:
+		if e.Type != "camera_offline" || e.CameraName != "Camera b" || e.ID == "" {
+			t.Errorf("webhook got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	d.Close()
+	if len(received) != 0 {
+		t.Errorf("webhook received %d more events, want 0", len(received))
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil || e.Type != "motion_start" {
+		t.Errorf("script got %s", data)
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "mqtt without host", cfg: Config{MQTT: []MQTTConfig{{Topic: "events"}}}},
+		{name: "mqtt qos", cfg: Config{MQTT: []MQTTConfig{{Host: "localhost", QoS: 3}}}},
+		{name: "mqtt missing CA", cfg: Config{MQTT: []MQTTConfig{{Host: "localhost", TLS: true, CAFile: "/nonexistent/ca.pem"}}}},
+		{name: "script without path", cfg: Config{Scripts: []ScriptConfig{{Args: []string{"x"}}}}},
+		{name: "duplicate webhook", cfg: Config{Webhooks: []WebhookConfig{{URL: "http://a"}, {URL: "http://a"}}}},
+	}
+	for _, test := range tests {
+		if _, err := New(test.cfg, nil); err == nil {
+			t.Errorf("%s: accepted", test.name)
+		}
+	}
+}
+
+func TestMQTTTopics(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    MQTTConfig
+		eventType string
+		camera    string
+		want      string
+	}{
+		{name: "defaults", config: MQTTConfig{}, eventType: "motion_start", camera: "front", want: "firescrew/front/motion_start"},
+		{name: "prefix", config: MQTTConfig{Prefix: "home/cams"}, eventType: "camera_offline", camera: "a", want: "home/cams/a/camera_offline"},
+		{name: "template", config: MQTTConfig{Topic: "alerts/{type}/{camera}"}, eventType: "stream_stalled", camera: "a", want: "alerts/stream_stalled/a"},
+		{name: "no camera", config: MQTTConfig{}, eventType: "config_changed", want: "firescrew/server/config_changed"},
+	}
+	for _, test := range tests {
+		if got := test.config.withDefaults().EventTopic(test.eventType, test.camera); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	config := MQTTConfig{Prefix: "site1", TLS: true}.withDefaults()
+	if config.AvailabilityTopic() != "site1/status" || config.Port != defaultMQTTTLSPort {
+		t.Errorf("got availability %q port %d", config.AvailabilityTopic(), config.Port)
+	}
+}
@@ -0,0 +1,273 @@
+package eventSinks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMQTTPort        = 1883
+	defaultMQTTTLSPort     = 8883
+	defaultMQTTPrefix      = "firescrew"
+	defaultMQTTTopic       = "{prefix}/{camera}/{type}"
+	defaultDiscoveryPrefix = "homeassistant"
+	mqttPublishTimeout     = 10 * time.Second
+)
+
+// Payloads of the retained availability topic
+const (
+	AvailabilityOnline  = "online"
+	AvailabilityOffline = "offline"
+)
+
+// MQTTConfig publishes events to an MQTT broker
+type MQTTConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"` // Default 1883, 8883 with TLS
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	ClientID string `json:"clientId,omitempty"` // Default firescrew- and a random suffix
+
+	TLS                bool   `json:"tls,omitempty"`
+	CAFile             string `json:"caFile,omitempty"`   // PEM CA bundle, default the system roots
+	CertFile           string `json:"certFile,omitempty"` // Client certificate for mutual TLS
+	KeyFile            string `json:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	QoS      byte   `json:"qos,omitempty"`      // 0, 1 or 2
+	Retain   bool   `json:"retain,omitempty"`   // Retain event messages
+	Prefix   string `json:"prefix,omitempty"`   // Default firescrew, availability is published to {prefix}/status
+	Topic    string `json:"topic,omitempty"`    // Default {prefix}/{camera}/{type}
+	Commands bool   `json:"commands,omitempty"` // Accept camera commands on {prefix}/cameras/{id}/set
+
+	HomeAssistant   bool   `json:"homeAssistant,omitempty"`   // Publish Home Assistant discovery configs
+	DiscoveryPrefix string `json:"discoveryPrefix,omitempty"` // Home Assistant discovery prefix, default homeassistant
+	Filter
+}
+
+// withDefaults fills in the unset fields
+func (c MQTTConfig) withDefaults() MQTTConfig {
+	if c.Port == 0 {
+		c.Port = defaultMQTTPort
+		if c.TLS {
+			c.Port = defaultMQTTTLSPort
+		}
+	}
+	if c.ClientID == "" {
+		c.ClientID = "firescrew-" + newEventID()[:8]
+	}
+	if c.Prefix == "" {
+		c.Prefix = defaultMQTTPrefix
+	}
+	if c.Topic == "" {
+		c.Topic = defaultMQTTTopic
+	}
+	if c.DiscoveryPrefix == "" {
+		c.DiscoveryPrefix = defaultDiscoveryPrefix
+	}
+	return c
+}
+
+// validate checks the config and that the TLS files load
+func (c MQTTConfig) validate() error {
+	if c.Host == "" {
+		return errors.New("host is required")
+	}
+	if c.QoS > 2 {
+		return fmt.Errorf("qos must be 0, 1 or 2, got %d", c.QoS)
+	}
+	if c.TLS {
+		if _, err := c.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tlsConfig loads the CA and client certificate
+func (c MQTTConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// AvailabilityTopic is the retained topic holding online or offline
+func (c MQTTConfig) AvailabilityTopic() string {
+	return c.Prefix + "/status"
+}
+
+// EventTopic expands the topic template for an event. Events without a camera use "server".
+func (c MQTTConfig) EventTopic(eventType, cameraID string) string {
+	if cameraID == "" {
+		cameraID = "server"
+	}
+	return strings.NewReplacer("{prefix}", c.Prefix, "{camera}", cameraID, "{type}", eventType).Replace(c.Topic)
+}
+
+// MQTTClient is a broker connection shared by everything that publishes. It reconnects on its own
+// and keeps a retained availability message, set to offline by the broker if the connection drops.
+type MQTTClient struct {
+	config MQTTConfig
+	client mqtt.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]MessageHandler // Renewed on every connect, the session is not kept
+	onConnect     []func()
+}
+
+// MessageHandler receives messages of a subscription
+type MessageHandler func(topic string, payload []byte)
+
+// NewMQTTClient starts connecting to the broker. It does not wait for the connection;
+// messages published before it is up fail (QoS 0) or are sent once connected (QoS 1 and 2).
+func NewMQTTClient(c MQTTConfig) (*MQTTClient, error) {
+	c = c.withDefaults()
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	scheme := "tcp"
+	if c.TLS {
+		scheme = "ssl"
+	}
+	opts := mqtt.NewClientOptions().AddBroker(fmt.Sprintf("%s://%s:%d", scheme, c.Host, c.Port))
+	opts.SetClientID(c.ClientID)
+	if c.User != "" {
+		opts.SetUsername(c.User)
+		opts.SetPassword(c.Pass)
+	}
+	if c.TLS {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetConnectTimeout(10 * time.Second)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(time.Minute)
+	opts.SetConnectRetry(true)
+	opts.SetConnectRetryInterval(10 * time.Second)
+	opts.SetWill(c.AvailabilityTopic(), AvailabilityOffline, 1, true)
+
+	m := &MQTTClient{config: c, subscriptions: make(map[string]MessageHandler)}
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Printf("MQTT connected to %s:%d", c.Host, c.Port)
+		client.Publish(c.AvailabilityTopic(), 1, true, AvailabilityOnline)
+		m.mu.Lock()
+		for filter, handler := range m.subscriptions {
+			m.subscribe(filter, handler)
+		}
+		callbacks := m.onConnect
+		m.mu.Unlock()
+		for _, fn := range callbacks {
+			go fn()
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		log.Printf("MQTT connection to %s:%d lost, reconnecting: %v", c.Host, c.Port, err)
+	})
+	m.client = mqtt.NewClient(opts)
+	m.client.Connect()
+	return m, nil
+}
+
+// Config returns the config with defaults filled in
+func (m *MQTTClient) Config() MQTTConfig {
+	return m.config
+}
+
+// Publish sends a message with the configured QoS
+func (m *MQTTClient) Publish(topic string, payload []byte, retain bool) error {
+	token := m.client.Publish(topic, m.config.QoS, retain, payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return errors.New("publish timed out")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	return nil
+}
+
+// PublishEvent sends an event to its templated topic
+func (m *MQTTClient) PublishEvent(eventType, cameraID string, payload []byte) error {
+	return m.Publish(m.config.EventTopic(eventType, cameraID), payload, m.config.Retain)
+}
+
+// Subscribe calls handler for messages matching the topic filter, also after reconnects.
+// The handler runs on the client's goroutine and must not block.
+func (m *MQTTClient) Subscribe(filter string, handler MessageHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[filter] = handler
+	if m.client.IsConnected() {
+		m.subscribe(filter, handler)
+	}
+}
+
+// OnConnect calls fn on its own goroutine after every connect, and right away if already connected
+func (m *MQTTClient) OnConnect(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onConnect = append(m.onConnect, fn)
+	if m.client.IsConnected() {
+		go fn()
+	}
+}
+
+// subscribe sends a subscription to the broker without waiting for it
+func (m *MQTTClient) subscribe(filter string, handler MessageHandler) {
+	m.client.Subscribe(filter, m.config.QoS, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+}
+
+// Close marks the client offline and disconnects. The will only covers dropped connections.
+func (m *MQTTClient) Close() {
+	if m.client.IsConnected() {
+		m.client.Publish(m.config.AvailabilityTopic(), 1, true, AvailabilityOffline).WaitTimeout(2 * time.Second)
+	}
+	m.client.Disconnect(250)
+}
+
+// mqttSink publishes events through a shared client
+type mqttSink struct {
+	client *MQTTClient
+}
+
+func (s *mqttSink) Name() string {
+	return fmt.Sprintf("mqtt %s:%d", s.client.config.Host, s.client.config.Port)
+}
+
+func (s *mqttSink) Send(e Event, payload []byte) error {
+	return s.client.PublishEvent(e.Type, e.CameraID, payload)
+}
+
+func (s *mqttSink) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,363 @@
+package eventSinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delivery states
+const (
+	DeliveryPending = "pending" // Waiting for the first attempt or a retry
+	DeliveryFailed  = "failed"  // Not delivered within the endpoint's max age
+)
+
+const (
+	retryBase   = 5 * time.Second  // Delay before the first retry, doubled for every further retry
+	retryMax    = 15 * time.Minute // Longest delay between retries
+	maxPending  = 10000            // Deliveries queued across all endpoints before new events are dropped
+	maxFailed   = 100              // Failed deliveries kept for inspection
+	idleRecheck = time.Hour        // Wake-up interval of an endpoint with nothing queued
+)
+
+// Delivery is one event queued for one webhook
+type Delivery struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"`
+	EventType   string          `json:"eventType"`
+	CameraID    string          `json:"cameraId,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Created     time.Time       `json:"created"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt *time.Time      `json:"nextAttempt,omitempty"` // Pending deliveries only
+	LastAttempt *time.Time      `json:"lastAttempt,omitempty"`
+	LastStatus  int             `json:"lastStatus,omitempty"` // HTTP status of the last attempt, 0 if there was no response
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Outbox queues webhook deliveries on disk and retries them with exponential backoff
+// until they succeed or exceed the endpoint's max age. Each endpoint has its own worker,
+// so an endpoint that is down does not delay the others.
+type Outbox struct {
+	dir       string // Empty keeps deliveries in memory only
+	endpoints []*endpoint
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewOutbox loads the deliveries left in dir and starts delivering to the webhooks.
+// Deliveries for URLs that are no longer configured are discarded.
+func NewOutbox(dir string, webhooks []WebhookConfig) (*Outbox, error) {
+	o := &Outbox{dir: dir, deliveries: make(map[string]*Delivery), stop: make(chan struct{})}
+	urls := make(map[string]bool)
+	for i, c := range webhooks {
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook %d: url is required", i)
+		}
+		if urls[c.URL] {
+			return nil, fmt.Errorf("webhook %d: duplicate url %s", i, c.URL)
+		}
+		urls[c.URL] = true
+		o.endpoints = append(o.endpoints, newEndpoint(c))
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create webhook outbox: %w", err)
+		}
+		if err := o.load(urls); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range o.endpoints {
+		o.wg.Add(1)
+		go o.run(e)
+	}
+	return o, nil
+}
+
+// load reads the deliveries saved in the outbox directory
+func (o *Outbox) load(urls map[string]bool) error {
+	files, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read webhook outbox: %w", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook outbox: %w", err)
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil || d.ID == "" {
+			log.Printf("Skipping unreadable webhook delivery %s", file)
+			continue
+		}
+		if !urls[d.URL] {
+			log.Printf("Discarding webhook delivery %s, %s is no longer configured", d.ID, d.URL)
+			os.Remove(file)
+			continue
+		}
+		o.deliveries[d.ID] = &d
+	}
+	if len(o.deliveries) > 0 {
+		log.Printf("Loaded %d webhook deliveries from %s", len(o.deliveries), o.dir)
+	}
+	return nil
+}
+
+// Enqueue queues an event for every webhook whose filter matches it. payload must be JSON.
+func (o *Outbox) Enqueue(eventType, cameraID string, payload []byte) {
+	if o == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, e := range o.endpoints {
+		if !e.config.Filter.Match(Event{Type: eventType, CameraID: cameraID}) {
+			continue
+		}
+
+		o.mu.Lock()
+		if o.count(DeliveryPending) >= maxPending {
+			o.mu.Unlock()
+			log.Printf("Webhook outbox full, dropping %s event for %s", eventType, e.config.URL)
+			continue
+		}
+		next := now
+		d := &Delivery{
+			ID:          newEventID(),
+			URL:         e.config.URL,
+			EventType:   eventType,
+			CameraID:    cameraID,
+			Payload:     append(json.RawMessage(nil), payload...),
+			Status:      DeliveryPending,
+			Created:     now,
+			NextAttempt: &next,
+		}
+		o.deliveries[d.ID] = d
+		o.save(d)
+		o.mu.Unlock()
+
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run delivers the endpoint's deliveries as they come due
+func (o *Outbox) run(e *endpoint) {
+	defer o.wg.Done()
+	timer := time.NewTimer(idleRecheck)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		default:
+		}
+
+		d, wait := o.next(e.config.URL)
+		if d != nil {
+			o.attempt(e, *d)
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-o.stop:
+			return
+		case <-e.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns a copy of the endpoint's oldest due delivery, or the time until one is due
+func (o *Outbox) next(url string) (*Delivery, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var due *Delivery
+	for _, d := range o.deliveries {
+		if d.URL != url || d.Status != DeliveryPending {
+			continue
+		}
+		if due == nil || d.NextAttempt.Before(*due.NextAttempt) ||
+			(d.NextAttempt.Equal(*due.NextAttempt) && d.Created.Before(due.Created)) {
+			due = d
+		}
+	}
+	if due == nil {
+		return nil, idleRecheck
+	}
+	if wait := time.Until(*due.NextAttempt); wait > 0 {
+		return nil, wait
+	}
+	d := *due
+	return &d, 0
+}
+
+// attempt sends a delivery and records the outcome
+func (o *Outbox) attempt(e *endpoint, d Delivery) {
+	status, err := e.send(d)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	current, ok := o.deliveries[d.ID]
+	if !ok {
+		return
+	}
+	if err == nil {
+		delete(o.deliveries, d.ID)
+		o.remove(d.ID)
+		return
+	}
+
+	now := time.Now().UTC()
+	current.Attempts++
+	current.LastAttempt = &now
+	current.LastStatus = status
+	current.LastError = err.Error()
+	if now.Sub(current.Created) >= e.maxAge {
+		log.Printf("Giving up on %s webhook to %s after %d attempts: %v", d.EventType, d.URL, current.Attempts, err)
+		current.Status = DeliveryFailed
+		current.NextAttempt = nil
+		o.pruneFailed()
+	} else {
+		next := now.Add(retryDelay(current.Attempts))
+		current.NextAttempt = &next
+		log.Printf("Failed to send %s webhook to %s (attempt %d), retrying at %s: %v",
+			d.EventType, d.URL, current.Attempts, next.Local().Format("15:04:05"), err)
+	}
+	o.save(current)
+}
+
+// retryDelay returns the delay after the given number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	if attempts > 20 {
+		return retryMax
+	}
+	delay := retryBase << (attempts - 1)
+	if delay > retryMax {
+		return retryMax
+	}
+	return delay
+}
+
+// count returns the number of deliveries in a state. Caller holds o.mu.
+func (o *Outbox) count(status string) int {
+	n := 0
+	for _, d := range o.deliveries {
+		if d.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// pruneFailed removes the oldest failed deliveries beyond maxFailed. Caller holds o.mu.
+func (o *Outbox) pruneFailed() {
+	var failed []*Delivery
+	for _, d := range o.deliveries {
+		if d.Status == DeliveryFailed {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) <= maxFailed {
+		return
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Created.Before(failed[j].Created) })
+	for _, d := range failed[:len(failed)-maxFailed] {
+		delete(o.deliveries, d.ID)
+		o.remove(d.ID)
+	}
+}
+
+// save writes a delivery to the outbox directory. Caller holds o.mu.
+func (o *Outbox) save(d *Delivery) {
+	if o.dir == "" {
+		return
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("Failed to encode webhook delivery %s: %v", d.ID, err)
+		return
+	}
+	// Write and rename so a crash never leaves a partial file
+	path := filepath.Join(o.dir, d.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		log.Printf("Failed to save webhook delivery %s: %v", d.ID, err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Printf("Failed to save webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// remove deletes a delivery from the outbox directory. Caller holds o.mu.
+func (o *Outbox) remove(id string) {
+	if o.dir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(o.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove webhook delivery %s: %v", id, err)
+	}
+}
+
+// Deliveries returns the queued and failed deliveries, newest first.
+// status selects pending or failed deliveries, empty returns both.
+func (o *Outbox) Deliveries(status string) []Delivery {
+	out := []Delivery{}
+	if o == nil {
+		return out
+	}
+	o.mu.Lock()
+	for _, d := range o.deliveries {
+		if status == "" || d.Status == status {
+			out = append(out, *d)
+		}
+	}
+	o.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+// ServeHTTP lists the deliveries. The optional status query parameter selects pending or failed ones.
+func (o *Outbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := strings.ToLower(r.URL.Query().Get("status"))
+	if status != "" && status != DeliveryPending && status != DeliveryFailed {
+		http.Error(w, "status must be pending or failed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.Deliveries(status))
+}
+
+// Close stops the workers. Deliveries still queued are sent after the next start.
+func (o *Outbox) Close() {
+	if o == nil {
+		return
+	}
+	o.once.Do(func() { close(o.stop) })
+	o.wg.Wait()
+}
@@ -0,0 +1,117 @@
+package eventSinks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 5, want: 80 * time.Second},
+		{attempts: 9, want: 15 * time.Minute},
+		{attempts: 100, want: 15 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := retryDelay(test.attempts); got != test.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	fail := true
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	config := WebhookConfig{URL: server.URL, Secret: "s3cret", Headers: map[string]string{"Authorization": "Bearer token"}}
+	// No workers, attempts are made by the test
+	o := &Outbox{dir: dir, deliveries: make(map[string]*Delivery), stop: make(chan struct{})}
+	e := newEndpoint(config)
+	o.endpoints = []*endpoint{e}
+
+	o.Enqueue("camera_offline", "a", []byte(`{"type":"camera_offline"}`))
+	d, _ := o.next(server.URL)
+	if d == nil {
+		t.Fatal("delivery not due")
+	}
+	o.attempt(e, *d)
+
+	pending := o.Deliveries(DeliveryPending)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastStatus != http.StatusServiceUnavailable {
+		t.Fatalf("after failure got %+v", pending)
+	}
+	if next, wait := o.next(server.URL); next != nil || wait <= 0 {
+		t.Error("failed delivery retried without backoff")
+	}
+
+	// A restart picks up the queued delivery
+	reloaded, err := NewOutbox(dir, []WebhookConfig{config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(reloaded.Deliveries(DeliveryPending))
+	reloaded.Close()
+	if n != 1 {
+		t.Errorf("reloaded %d deliveries, want 1", n)
+	}
+
+	fail = false
+	o.attempt(e, pending[0])
+	if left := o.Deliveries(""); len(left) != 0 {
+		t.Errorf("delivered event still queued: %+v", left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, d.ID+".json")); !os.IsNotExist(err) {
+		t.Error("delivered event still on disk")
+	}
+
+	if got := header.Get(HeaderSignature); got != "sha256="+Sign("s3cret", header.Get(HeaderTimestamp), body) {
+		t.Errorf("signature %q does not match the body", got)
+	}
+	if header.Get("Authorization") != "Bearer token" || header.Get(HeaderDelivery) != d.ID || header.Get(HeaderEvent) != "camera_offline" {
+		t.Errorf("unexpected headers %v", header)
+	}
+}
+
+func TestOutboxMaxAge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	o := &Outbox{deliveries: make(map[string]*Delivery), stop: make(chan struct{})}
+	e := newEndpoint(WebhookConfig{URL: server.URL, Filter: Filter{Types: []string{"motion_start"}}})
+	e.maxAge = 0
+	o.endpoints = []*endpoint{e}
+
+	o.Enqueue("motion_end", "a", []byte(`{}`))
+	o.Enqueue("motion_start", "a", []byte(`{}`))
+	d, _ := o.next(server.URL)
+	if d == nil || d.EventType != "motion_start" {
+		t.Fatalf("got delivery %+v, want only the filtered type", d)
+	}
+	o.attempt(e, *d)
+
+	failed := o.Deliveries(DeliveryFailed)
+	if len(failed) != 1 || failed[0].NextAttempt != nil || failed[0].LastError == "" {
+		t.Errorf("got failed deliveries %+v", failed)
+	}
+}
@@ -0,0 +1,406 @@
+package eventSinks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Script runner defaults
+const (
+	defaultScriptTimeout = 30 * time.Second
+	defaultScriptWorkers = 2
+	maxScriptRuns        = 200       // Runs kept for the runs API
+	maxScriptOutput      = 64 * 1024 // Bytes of stdout and stderr kept per run
+)
+
+// ScriptConfig runs a local program for events with the event JSON on stdin and its fields
+// in FIRESCREW_* environment variables. Several scripts may handle the same event type.
+type ScriptConfig struct {
+	Path    string   `json:"path"`
+	Args    []string `json:"args,omitempty"`
+	Timeout int      `json:"timeout,omitempty"` // Seconds before the script is killed, default 30
+	Actions bool     `json:"actions,omitempty"` // Carry out the actions the script prints as JSON
+	Filter
+}
+
+// ScriptAction is an action a script asks for by printing {"actions": [...]} as the last line of its output
+type ScriptAction struct {
+	Action   string          `json:"action"`
+	CameraID string          `json:"cameraId,omitempty"` // Default the event's camera
+	Raw      json.RawMessage `json:"-"`                  // The whole action, for fields specific to the action
+}
+
+// ActionHandler carries out an action returned by a script run for an event
+type ActionHandler func(e Event, a ScriptAction) error
+
+// ScriptRun is the result of one script run
+type ScriptRun struct {
+	Script     string    `json:"script"`
+	EventID    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	CameraID   string    `json:"cameraId,omitempty"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"` // -1 if the script did not start or was killed
+	TimedOut   bool      `json:"timedOut,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Stdout     string    `json:"stdout,omitempty"` // Truncated to 64 KiB
+	Stderr     string    `json:"stderr,omitempty"` // Truncated to 64 KiB
+	Actions    []string  `json:"actions,omitempty"`
+}
+
+// scriptJob is one script to run for an event
+type scriptJob struct {
+	config  ScriptConfig
+	event   Event
+	payload []byte
+}
+
+// ScriptRunner runs scripts for events on a bounded pool of workers
+type ScriptRunner struct {
+	scripts []ScriptConfig
+	jobs    chan scriptJob
+	wg      sync.WaitGroup
+	once    sync.Once
+
+	mu      sync.Mutex
+	actions ActionHandler
+	logFile *os.File    // Output of every run, nil to keep runs in memory only
+	runs    []ScriptRun // Oldest first, at most maxScriptRuns
+}
+
+// NewScriptRunner starts workers for the scripts. Output is appended to logPath if not empty.
+func NewScriptRunner(scripts []ScriptConfig, workers int, logPath string) (*ScriptRunner, error) {
+	for i, c := range scripts {
+		if c.Path == "" {
+			return nil, fmt.Errorf("script %d: path is required", i)
+		}
+	}
+	if workers <= 0 {
+		workers = defaultScriptWorkers
+	}
+
+	r := &ScriptRunner{scripts: scripts, jobs: make(chan scriptJob, sinkQueueSize)}
+	if logPath != "" {
+		file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open script log: %w", err)
+		}
+		r.logFile = file
+	}
+	for i := 0; i < workers; i++ {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for job := range r.jobs {
+				r.record(r.run(job))
+			}
+		}()
+	}
+	return r, nil
+}
+
+// SetActionHandler sets the handler for actions returned by scripts with actions enabled
+func (r *ScriptRunner) SetActionHandler(h ActionHandler) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = h
+}
+
+// Run queues the scripts whose filter matches the event without blocking.
+// A nil runner does nothing.
+func (r *ScriptRunner) Run(e Event, payload []byte) {
+	if r == nil {
+		return
+	}
+	for _, c := range r.scripts {
+		if !c.Filter.Match(e) {
+			continue
+		}
+		select {
+		case r.jobs <- scriptJob{config: c, event: e, payload: payload}:
+		default:
+			log.Printf("Script queue full, not running %s for %s event", c.Path, e.Type)
+		}
+	}
+}
+
+// run runs a script and waits for it, so failed runs are reported and never left as zombies
+func (r *ScriptRunner) run(job scriptJob) ScriptRun {
+	timeout := defaultScriptTimeout
+	if job.config.Timeout > 0 {
+		timeout = time.Duration(job.config.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, job.config.Path, job.config.Args...)
+	cmd.Stdin = bytes.NewReader(job.payload)
+	cmd.Env = append(os.Environ(), scriptEnv(job.payload)...)
+	stdout := &limitedBuffer{limit: maxScriptOutput}
+	stderr := &limitedBuffer{limit: maxScriptOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Children of a killed script may keep the output pipes open, stop waiting for them
+	cmd.WaitDelay = time.Second
+
+	run := ScriptRun{Script: job.config.Path, EventID: job.event.ID, EventType: job.event.Type, CameraID: job.event.CameraID, Start: time.Now().UTC()}
+	err := cmd.Run()
+	run.DurationMs = float64(time.Since(run.Start).Microseconds()) / 1000
+	run.Stdout, run.Stderr = stdout.String(), stderr.String()
+	run.ExitCode = -1
+	if cmd.ProcessState != nil {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		run.TimedOut = true
+		run.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		run.Error = err.Error()
+	case job.config.Actions:
+		r.runActions(job.event, &run)
+	}
+	if run.Error != "" {
+		log.Printf("Script %s failed for %s event: %s", job.config.Path, job.event.Type, run.Error)
+	}
+	return run
+}
+
+// runActions carries out the actions printed by a successful run
+func (r *ScriptRunner) runActions(e Event, run *ScriptRun) {
+	actions, err := parseScriptActions(run.Stdout)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	r.mu.Lock()
+	handler := r.actions
+	r.mu.Unlock()
+
+	var errs []string
+	for _, a := range actions {
+		if a.CameraID == "" {
+			a.CameraID = e.CameraID
+		}
+		run.Actions = append(run.Actions, a.Action)
+		if handler == nil {
+			errs = append(errs, a.Action+": actions are not supported")
+			continue
+		}
+		if err := handler(e, a); err != nil {
+			errs = append(errs, a.Action+": "+err.Error())
+		}
+	}
+	run.Error = strings.Join(errs, "; ")
+}
+
+// parseScriptActions reads the actions from the last line of a script's output.
+// Output not ending in a JSON object has no actions.
+func parseScriptActions(stdout string) ([]ScriptAction, error) {
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if !strings.HasPrefix(last, "{") {
+		return nil, nil
+	}
+
+	var result struct {
+		Actions []json.RawMessage `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(last), &result); err != nil {
+		return nil, fmt.Errorf("invalid actions: %w", err)
+	}
+	actions := make([]ScriptAction, 0, len(result.Actions))
+	for _, raw := range result.Actions {
+		var a ScriptAction
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, fmt.Errorf("invalid action: %w", err)
+		}
+		if a.Action == "" {
+			return nil, errors.New("invalid action: action is required")
+		}
+		a.Raw = raw
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// scriptEnv exposes the top level fields of an event payload as FIRESCREW_<FIELD>
+// and the fields of its data object as FIRESCREW_DATA_<FIELD>. Nested values are JSON.
+func scriptEnv(payload []byte) []string {
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+	var env []string
+	add := func(prefix string, fields map[string]any) {
+		for k, v := range fields {
+			var value string
+			switch v := v.(type) {
+			case nil:
+				continue
+			case string:
+				value = v
+			case float64, bool:
+				value = fmt.Sprint(v)
+			default:
+				data, _ := json.Marshal(v)
+				value = string(data)
+			}
+			env = append(env, prefix+envName(k)+"="+value)
+		}
+	}
+	if data, ok := fields["data"].(map[string]any); ok {
+		add("FIRESCREW_DATA_", data)
+		delete(fields, "data")
+	}
+	add("FIRESCREW_", fields)
+	sort.Strings(env)
+	return env
+}
+
+// envName converts a JSON field name such as cameraId or camera_name to CAMERA_ID or CAMERA_NAME
+func envName(field string) string {
+	var b strings.Builder
+	for i, c := range field {
+		switch {
+		case unicode.IsUpper(c) && i > 0:
+			b.WriteByte('_')
+			b.WriteRune(c)
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			b.WriteRune(unicode.ToUpper(c))
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// record keeps a run for the runs API and appends it to the log file
+func (r *ScriptRunner) record(run ScriptRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.runs) == maxScriptRuns {
+		copy(r.runs, r.runs[1:])
+		r.runs = r.runs[:maxScriptRuns-1]
+	}
+	r.runs = append(r.runs, run)
+
+	if r.logFile == nil {
+		return
+	}
+	var entry bytes.Buffer
+	fmt.Fprintf(&entry, "%s %s event=%s id=%s camera=%s exit=%d duration=%.0fms",
+		run.Start.Format(time.RFC3339), run.Script, run.EventType, run.EventID, run.CameraID, run.ExitCode, run.DurationMs)
+	if run.Error != "" {
+		fmt.Fprintf(&entry, " error=%q", run.Error)
+	}
+	entry.WriteByte('\n')
+	for _, output := range []struct{ name, text string }{{"stdout", run.Stdout}, {"stderr", run.Stderr}} {
+		scanner := bufio.NewScanner(strings.NewReader(output.text))
+		for scanner.Scan() {
+			fmt.Fprintf(&entry, "  %s: %s\n", output.name, scanner.Text())
+		}
+	}
+	if _, err := r.logFile.Write(entry.Bytes()); err != nil {
+		log.Printf("Failed to write script log: %v", err)
+	}
+}
+
+// Runs returns the recent runs, newest first
+func (r *ScriptRunner) Runs() []ScriptRun {
+	if r == nil {
+		return []ScriptRun{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]ScriptRun, len(r.runs))
+	for i, run := range r.runs {
+		runs[len(runs)-1-i] = run
+	}
+	return runs
+}
+
+// ServeHTTP lists the recent runs as JSON, ?failed=true only lists runs with an error
+func (r *ScriptRunner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runs := r.Runs()
+	if req.URL.Query().Get("failed") == "true" {
+		failed := []ScriptRun{}
+		for _, run := range runs {
+			if run.Error != "" {
+				failed = append(failed, run)
+			}
+		}
+		runs = failed
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// Close waits for queued scripts to finish. Run must not be called after Close.
+func (r *ScriptRunner) Close() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() { close(r.jobs) })
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.logFile != nil {
+		r.logFile.Close()
+		r.logFile = nil
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	// Report everything as written so the script is not stopped by a short write
+	return len(p), nil
+}
+
+// scriptSink hands events to the script runner, each script applies its own filter
+type scriptSink struct {
+	runner *ScriptRunner
+}
+
+func (s scriptSink) Name() string {
+	return "scripts"
+}
+
+func (s scriptSink) Send(e Event, payload []byte) error {
+	s.runner.Run(e, payload)
+	return nil
+}
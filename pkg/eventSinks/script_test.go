@@ -0,0 +1,151 @@
+package eventSinks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScriptEnv(t *testing.T) {
+	payload := `{"id":"e1","type":"camera_offline","cameraId":"garage","camera_name":"Garage","recodedToMp4":true,
+		"snapshots":["a.jpg"],"skip":null,"data":{"reason":"connection refused","seconds":30}}`
+	got := scriptEnv([]byte(payload))
+	want := []string{
+		"FIRESCREW_CAMERA_ID=garage",
+		"FIRESCREW_CAMERA_NAME=Garage",
+		"FIRESCREW_DATA_REASON=connection refused",
+		"FIRESCREW_DATA_SECONDS=30",
+		"FIRESCREW_ID=e1",
+		"FIRESCREW_RECODED_TO_MP4=true",
+		`FIRESCREW_SNAPSHOTS=["a.jpg"]`,
+		"FIRESCREW_TYPE=camera_offline",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if env := scriptEnv([]byte("not json")); env != nil {
+		t.Errorf("got %v for invalid payload", env)
+	}
+}
+
+func TestParseScriptActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		stdout  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no output"},
+		{name: "plain output", stdout: "done\n"},
+		{name: "actions on the last line", stdout: "checking\n" + `{"actions":[{"action":"overlay","ttl":5},{"action":"start","cameraId":"b"}]}` + "\n",
+			want: []string{"overlay", "start"}},
+		{name: "json before other output", stdout: `{"actions":[{"action":"start"}]}` + "\ndone"},
+		{name: "invalid json", stdout: `{"actions":`, wantErr: true},
+		{name: "action without name", stdout: `{"actions":[{"cameraId":"a"}]}`, wantErr: true},
+	}
+	for _, test := range tests {
+		actions, err := parseScriptActions(test.stdout)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		var got []string
+		for _, a := range actions {
+			got = append(got, a.Action)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScriptRunner(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755)
+		return path
+	}
+	ok := write("ok.sh", `echo "camera $FIRESCREW_CAMERA_ID"
+echo '{"actions":[{"action":"overlay","ttl":5}]}'
+`)
+	failing := write("fail.sh", "echo broken >&2\nexit 3\n")
+	slow := write("slow.sh", "sleep 5\n")
+	logPath := filepath.Join(dir, "scripts.log")
+
+	runner, err := NewScriptRunner([]ScriptConfig{
+		{Path: ok, Actions: true, Filter: Filter{Types: []string{"motion_start"}}},
+		{Path: failing, Filter: Filter{Types: []string{"motion_start"}}},
+		{Path: slow, Timeout: 1, Filter: Filter{Types: []string{"camera_offline"}}},
+	}, 2, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var handled []ScriptAction
+	runner.SetActionHandler(func(e Event, a ScriptAction) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, a)
+		return nil
+	})
+
+	for _, e := range []Event{{ID: "1", Type: "motion_start", CameraID: "garage"}, {ID: "2", Type: "camera_offline", CameraID: "garage"}} {
+		payload, _ := json.Marshal(e)
+		runner.Run(e, payload)
+	}
+	runner.Close()
+
+	runs := map[string]ScriptRun{}
+	for _, run := range runner.Runs() {
+		runs[filepath.Base(run.Script)] = run
+	}
+	if run := runs["ok.sh"]; run.ExitCode != 0 || run.Error != "" || !strings.Contains(run.Stdout, "camera garage") || len(run.Actions) != 1 {
+		t.Errorf("ok.sh: %+v", run)
+	}
+	if run := runs["fail.sh"]; run.ExitCode != 3 || run.Error == "" || strings.TrimSpace(run.Stderr) != "broken" {
+		t.Errorf("fail.sh: %+v", run)
+	}
+	if run := runs["slow.sh"]; !run.TimedOut || run.ExitCode != -1 || run.DurationMs > 4000 {
+		t.Errorf("slow.sh: %+v", run)
+	}
+	if len(handled) != 1 || handled[0].Action != "overlay" || handled[0].CameraID != "garage" || !strings.Contains(string(handled[0].Raw), `"ttl":5`) {
+		t.Errorf("handled %+v", handled)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"fail.sh event=motion_start id=1 camera=garage exit=3", "  stderr: broken", "  stdout: camera garage"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log lacks %q:\n%s", want, data)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	runner.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/scripts/runs?failed=true", nil))
+	var failed []ScriptRun
+	json.NewDecoder(rec.Body).Decode(&failed)
+	if len(failed) != 2 {
+		t.Errorf("got %d failed runs, want 2", len(failed))
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	for _, s := range []string{"ab", "cdef", "gh"} {
+		if n, _ := b.Write([]byte(s)); n != len(s) {
+			t.Errorf("Write(%q) = %d", s, n)
+		}
+	}
+	if b.String() != "abcd" {
+		t.Errorf("got %q", b.String())
+	}
+}
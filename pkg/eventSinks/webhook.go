@@ -0,0 +1,98 @@
+package eventSinks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultWebhookTimeout bounds a webhook request when no timeout is configured
+const defaultWebhookTimeout = 10 * time.Second
+
+// defaultWebhookMaxAge is how long a delivery is retried when no max age is configured
+const defaultWebhookMaxAge = 24 * time.Hour
+
+// Headers sent with every webhook request
+const (
+	HeaderEvent     = "X-Firescrew-Event"     // Event type
+	HeaderDelivery  = "X-Firescrew-Delivery"  // Delivery ID, the same for every retry
+	HeaderTimestamp = "X-Firescrew-Timestamp" // Unix time of the attempt
+	HeaderSignature = "X-Firescrew-Signature" // "sha256=" and the hex HMAC, only if a secret is set
+)
+
+// WebhookConfig posts events as JSON to a URL
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Timeout int               `json:"timeout,omitempty"` // Request timeout in seconds, default 10
+	MaxAge  int               `json:"maxAge,omitempty"`  // Seconds a delivery is retried before it fails, default 86400
+	Secret  string            `json:"secret,omitempty"`  // Signs requests with HMAC-SHA256
+	Headers map[string]string `json:"headers,omitempty"` // Added to every request
+	Filter
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.payload". Receivers recompute it from the
+// timestamp header and the raw body, and reject old timestamps to prevent replays.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// endpoint sends deliveries to one webhook
+type endpoint struct {
+	config WebhookConfig
+	client *http.Client
+	maxAge time.Duration
+	wake   chan struct{} // Signalled when a delivery is queued
+}
+
+func newEndpoint(c WebhookConfig) *endpoint {
+	timeout := defaultWebhookTimeout
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout) * time.Second
+	}
+	maxAge := defaultWebhookMaxAge
+	if c.MaxAge > 0 {
+		maxAge = time.Duration(c.MaxAge) * time.Second
+	}
+	return &endpoint{config: c, client: &http.Client{Timeout: timeout}, maxAge: maxAge, wake: make(chan struct{}, 1)}
+}
+
+// send posts a delivery. Returns the response status, 0 if there was none. Responses other than 2xx are errors.
+func (e *endpoint) send(d Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, e.config.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if e.config.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(e.config.Secret, timestamp, d.Payload))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
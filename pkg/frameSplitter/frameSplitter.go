@@ -0,0 +1,269 @@
+// Package frameSplitter splits a stream of concatenated JPEG or PNG images, such as
+// ffmpeg image2pipe output, into individual frames. Data may arrive in chunks of any
+// size; frame boundaries are found by walking JPEG markers and PNG chunks rather than
+// by looking at where a read happened to end.
+package frameSplitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Format selects the image format of the stream
+type Format int
+
+const (
+	JPEG Format = iota // Motion JPEG, as produced by ffmpeg -c:v mjpeg -f image2pipe
+	PNG                // Concatenated PNG images, as produced by ffmpeg -c:v png -f image2pipe
+)
+
+// DefaultMaxFrameSize is the largest frame kept when no limit is given
+const DefaultMaxFrameSize = 10 * 1024 * 1024
+
+var (
+	jpegSOI      = []byte{0xFF, 0xD8}
+	pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+)
+
+// Splitter extracts complete frames from stream data written to it.
+// It is not safe for concurrent use.
+type Splitter struct {
+	format  Format
+	maxSize int
+	buf     []byte
+	start   int   // Offset of the current frame, or of the data still to search
+	pos     int   // Parse position
+	inFrame bool  // A frame start was found at start
+	entropy bool  // JPEG parser is inside entropy-coded scan data
+	skipped int64 // Bytes discarded as garbage, corrupt or oversized frames
+}
+
+// New creates a splitter. Frames larger than maxFrameSize are discarded;
+// 0 uses DefaultMaxFrameSize.
+func New(format Format, maxFrameSize int) *Splitter {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	return &Splitter{format: format, maxSize: maxFrameSize}
+}
+
+// Write appends stream data. It never fails.
+func (s *Splitter) Write(p []byte) (int, error) {
+	// Drop consumed data before growing the buffer
+	if s.start > 0 {
+		n := copy(s.buf, s.buf[s.start:])
+		s.buf = s.buf[:n]
+		s.pos -= s.start
+		s.start = 0
+	}
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// Next returns the next complete frame from the data written so far, or nil when more
+// data is needed. The frame is only valid until the next call to Write or Next.
+func (s *Splitter) Next() []byte {
+	for {
+		if !s.inFrame && !s.findStart() {
+			return nil
+		}
+
+		var end int
+		var ok bool
+		if s.format == PNG {
+			end, ok = s.scanPNG()
+		} else {
+			end, ok = s.scanJPEG()
+		}
+
+		switch {
+		case ok && end > 0:
+			frame := s.buf[s.start:end]
+			s.start, s.pos, s.inFrame = end, end, false
+			return frame
+		case ok:
+			// Need more data, unless the frame already grew too large
+			if max(s.pos, len(s.buf))-s.start <= s.maxSize {
+				return nil
+			}
+			s.resync()
+		default:
+			s.resync()
+		}
+	}
+}
+
+// Skipped returns the number of bytes discarded so far
+func (s *Splitter) Skipped() int64 {
+	return s.skipped
+}
+
+// Split reads r until EOF and calls fn for every complete frame. The frame passed to fn
+// is only valid during the call. Returns nil at EOF or the first read error.
+func (s *Splitter) Split(r io.Reader, fn func(frame []byte)) error {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			s.Write(buffer[:n])
+			for frame := s.Next(); frame != nil; frame = s.Next() {
+				fn(frame)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// startMarker returns the byte sequence that begins a frame
+func (s *Splitter) startMarker() []byte {
+	if s.format == PNG {
+		return pngSignature
+	}
+	return jpegSOI
+}
+
+// findStart skips data up to the next frame start. Returns false if none was found.
+func (s *Splitter) findStart() bool {
+	marker := s.startMarker()
+	idx := bytes.Index(s.buf[s.start:], marker)
+	if idx < 0 {
+		// Keep a possible partial marker at the end
+		keep := len(marker) - 1
+		if n := len(s.buf) - s.start; n > keep {
+			s.skipped += int64(n - keep)
+			s.start = len(s.buf) - keep
+		}
+		s.pos = s.start
+		return false
+	}
+
+	s.skipped += int64(idx)
+	s.start += idx
+	s.pos = s.start + len(marker)
+	s.inFrame = true
+	s.entropy = false
+	return true
+}
+
+// resync abandons the current frame and searches for the next one after its start
+func (s *Splitter) resync() {
+	s.skipped++
+	s.start++
+	s.pos = s.start
+	s.inFrame = false
+	s.entropy = false
+}
+
+// scanJPEG walks JPEG markers from pos. Returns the frame end once EOI is found,
+// end 0 when more data is needed, or ok false when the data is not a valid JPEG.
+func (s *Splitter) scanJPEG() (end int, ok bool) {
+	buf := s.buf
+	for {
+		if s.entropy {
+			// Scan data ends at the first marker other than a stuffed 0xFF00 or a restart marker
+			for s.pos+1 < len(buf) {
+				if buf[s.pos] != 0xFF {
+					s.pos++
+					continue
+				}
+				next := buf[s.pos+1]
+				if next == 0x00 || (next >= 0xD0 && next <= 0xD7) {
+					s.pos += 2
+					continue
+				}
+				if next == 0xFF {
+					// Fill byte before a marker
+					s.pos++
+					continue
+				}
+				s.entropy = false
+				break
+			}
+			if s.entropy {
+				return 0, true
+			}
+		}
+
+		if s.pos+1 >= len(buf) {
+			return 0, true
+		}
+		if buf[s.pos] != 0xFF {
+			return 0, false
+		}
+		marker := buf[s.pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			s.pos++
+			continue
+		case marker == 0xD9:
+			return s.pos + 2, true
+		case marker == 0xD8:
+			// A new image started before this one ended
+			return 0, false
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Markers without a length
+			s.pos += 2
+			continue
+		case marker == 0x00:
+			return 0, false
+		}
+
+		if s.pos+3 >= len(buf) {
+			return 0, true
+		}
+		length := int(binary.BigEndian.Uint16(buf[s.pos+2:]))
+		if length < 2 {
+			return 0, false
+		}
+		s.pos += 2 + length
+		if marker == 0xDA {
+			// Start of scan is followed by entropy-coded data
+			s.entropy = true
+		}
+		if s.pos > len(buf) {
+			// Resume inside the segment once more data arrives; the position stays past it
+			return 0, true
+		}
+	}
+}
+
+// scanPNG walks PNG chunks from pos. Returns the frame end after the IEND chunk,
+// end 0 when more data is needed, or ok false when the data is not a valid PNG.
+func (s *Splitter) scanPNG() (end int, ok bool) {
+	buf := s.buf
+	for {
+		if s.pos+8 > len(buf) {
+			return 0, true
+		}
+		length := binary.BigEndian.Uint32(buf[s.pos:])
+		if length > uint32(s.maxSize) {
+			return 0, false
+		}
+		chunkType := buf[s.pos+4 : s.pos+8]
+		for _, c := range chunkType {
+			if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+				return 0, false
+			}
+		}
+
+		if string(chunkType) == "IEND" && length != 0 {
+			return 0, false
+		}
+
+		next := s.pos + 12 + int(length) // Length, type, data and CRC
+		if next > len(buf) {
+			return 0, true
+		}
+		s.pos = next
+		if string(chunkType) == "IEND" {
+			return next, true
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package frameSplitter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a small image with some detail so encoders produce varied data
+func testImage(w, h int, seed uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x*7) + seed, uint8(y*13) ^ seed, uint8(x * y), 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t testing.TB, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t testing.TB, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withAPP1 inserts an APP1 segment carrying payload right after the SOI marker,
+// like an EXIF block with an embedded thumbnail
+func withAPP1(frame, payload []byte) []byte {
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	out := append([]byte{}, frame[:2]...)
+	out = append(out, segment...)
+	out = append(out, payload...)
+	return append(out, frame[2:]...)
+}
+
+// withChunk inserts a PNG chunk right after the signature
+func withChunk(frame []byte, chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte{}, frame[:8]...)
+	out = append(out, chunk...)
+	return append(out, frame[8:]...)
+}
+
+// split feeds data in chunks of the given size and collects copies of the frames
+func split(format Format, maxSize int, data []byte, chunk int) [][]byte {
+	s := New(format, maxSize)
+	var frames [][]byte
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		s.Write(data[:n])
+		data = data[n:]
+		for frame := s.Next(); frame != nil; frame = s.Next() {
+			frames = append(frames, append([]byte{}, frame...))
+		}
+	}
+	return frames
+}
+
+func TestSplitJPEG(t *testing.T) {
+	thumbnail := encodeJPEG(t, testImage(8, 8, 1))
+	frames := [][]byte{
+		encodeJPEG(t, testImage(64, 48, 2)),
+		// An embedded thumbnail has its own EOI that must not end the frame
+		withAPP1(encodeJPEG(t, testImage(32, 32, 3)), thumbnail),
+		encodeJPEG(t, testImage(17, 9, 4)),
+	}
+
+	var stream []byte
+	stream = append(stream, "garbage before the first frame"...)
+	for _, f := range frames {
+		stream = append(stream, f...)
+	}
+
+	for _, chunk := range []int{1, 3, 7, 100, 4096, len(stream)} {
+		got := split(JPEG, 0, stream, chunk)
+		if len(got) != len(frames) {
+			t.Fatalf("chunk %d: got %d frames, want %d", chunk, len(got), len(frames))
+		}
+		for i := range frames {
+			if !bytes.Equal(got[i], frames[i]) {
+				t.Errorf("chunk %d: frame %d differs", chunk, i)
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(got[i])); err != nil {
+				t.Errorf("chunk %d: frame %d does not decode: %v", chunk, i, err)
+			}
+		}
+	}
+}
+
+func TestSplitPNG(t *testing.T) {
+	// A text chunk containing the IEND trailer must not end the frame
+	iendTrailer := []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82}
+	frames := [][]byte{
+		encodePNG(t, testImage(40, 30, 5)),
+		withChunk(encodePNG(t, testImage(20, 20, 6)), "tEXt", append([]byte("Comment\x00"), iendTrailer...)),
+	}
+
+	var stream []byte
+	for _, f := range frames {
+		stream = append(stream, f...)
+	}
+
+	for _, chunk := range []int{1, 5, 64, len(stream)} {
+		got := split(PNG, 0, stream, chunk)
+		if len(got) != len(frames) {
+			t.Fatalf("chunk %d: got %d frames, want %d", chunk, len(got), len(frames))
+		}
+		for i := range frames {
+			if !bytes.Equal(got[i], frames[i]) {
+				t.Errorf("chunk %d: frame %d differs", chunk, i)
+			}
+			if _, err := png.Decode(bytes.NewReader(got[i])); err != nil {
+				t.Errorf("chunk %d: frame %d does not decode: %v", chunk, i, err)
+			}
+		}
+	}
+}
+
+func TestSplitRecovers(t *testing.T) {
+	good := encodeJPEG(t, testImage(16, 16, 7))
+	large := encodeJPEG(t, testImage(128, 128, 8))
+
+	tests := []struct {
+		name    string
+		stream  [][]byte
+		maxSize int
+		want    int
+	}{
+		{name: "truncated frame", stream: [][]byte{good[:len(good)/2], good}, want: 1},
+		{name: "oversized frame", stream: [][]byte{large, good}, maxSize: len(good) + 16, want: 1},
+		{name: "corrupt marker", stream: [][]byte{{0xFF, 0xD8, 0x12, 0x34}, good, good}, want: 2},
+	}
+
+	for _, test := range tests {
+		got := split(JPEG, test.maxSize, bytes.Join(test.stream, nil), 1000)
+		if len(got) != test.want {
+			t.Errorf("%s: got %d frames, want %d", test.name, len(got), test.want)
+			continue
+		}
+		for i, frame := range got {
+			if !bytes.Equal(frame, good) {
+				t.Errorf("%s: frame %d is not the intact frame", test.name, i)
+			}
+		}
+	}
+}
+
+func TestSplitReader(t *testing.T) {
+	frame := encodeJPEG(t, testImage(24, 24, 9))
+	stream := bytes.Repeat(frame, 5)
+
+	count := 0
+	err := New(JPEG, 0).Split(bytes.NewReader(stream), func(f []byte) {
+		if !bytes.Equal(f, frame) {
+			t.Errorf("frame %d differs", count)
+		}
+		count++
+	})
+	if err != nil || count != 5 {
+		t.Errorf("got %d frames and error %v, want 5 frames", count, err)
+	}
+}
+
+// checkFrames verifies the splitter invariants for arbitrary input
+func checkFrames(t *testing.T, format Format, data []byte, chunk uint16) {
+	const maxSize = 64 * 1024
+	whole := split(format, maxSize, data, len(data)+1)
+	chunked := split(format, maxSize, data, int(chunk%512)+1)
+
+	// Frame boundaries must not depend on how the data was read
+	if len(whole) != len(chunked) {
+		t.Fatalf("got %d frames in one write and %d in chunks", len(whole), len(chunked))
+	}
+	for i := range whole {
+		if !bytes.Equal(whole[i], chunked[i]) {
+			t.Fatalf("frame %d differs between one write and chunks", i)
+		}
+		frame := whole[i]
+		if len(frame) > maxSize {
+			t.Fatalf("frame %d is %d bytes, above the limit", i, len(frame))
+		}
+		switch format {
+		case JPEG:
+			if !bytes.HasPrefix(frame, jpegSOI) || !bytes.HasSuffix(frame, []byte{0xFF, 0xD9}) {
+				t.Fatalf("frame %d is not delimited by SOI and EOI", i)
+			}
+		case PNG:
+			if !bytes.HasPrefix(frame, pngSignature) || !bytes.Equal(frame[len(frame)-8:len(frame)-4], []byte("IEND")) {
+				t.Fatalf("frame %d does not start with the signature and end with IEND", i)
+			}
+		}
+	}
+}
+
+func FuzzSplitJPEG(f *testing.F) {
+	a := encodeJPEG(f, testImage(16, 16, 1))
+	b := withAPP1(encodeJPEG(f, testImage(8, 8, 2)), a)
+	f.Add(a, uint16(1))
+	f.Add(append(append([]byte("junk"), a...), b...), uint16(13))
+	f.Add(append(a[:len(a)/2], b...), uint16(100))
+	f.Add([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0x00, 0xFF, 0xD0, 0xFF, 0xD9}, uint16(2))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint16) {
+		checkFrames(t, JPEG, data, chunk)
+	})
+}
+
+func FuzzSplitPNG(f *testing.F) {
+	a := encodePNG(f, testImage(8, 8, 3))
+	f.Add(a, uint16(1))
+	f.Add(append(append([]byte("junk"), a...), a...), uint16(7))
+	f.Add(append(a[:len(a)/2], a...), uint16(50))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint16) {
+		checkFrames(t, PNG, data, chunk)
+	})
+}
@@ -0,0 +1,184 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// email sends messages over SMTP, with the attachment as a MIME part
+type email struct {
+	name     string
+	host     string
+	port     int
+	user     string
+	password string
+	tls      bool // Implicit TLS, otherwise STARTTLS when the server offers it
+	from     string
+	to       []string
+}
+
+func newEmail(c Config) (*email, error) {
+	if c.Host == "" || c.From == "" || len(c.To) == 0 {
+		return nil, errors.New("email needs host, from and to")
+	}
+	port := c.Port
+	if port == 0 {
+		port = 587
+		if c.TLS {
+			port = 465
+		}
+	}
+	return &email{name: c.name(), host: c.Host, port: port, user: c.User, password: c.Password, tls: c.TLS, from: c.From, to: c.To}, nil
+}
+
+func (e *email) Name() string {
+	return e.name
+}
+
+// emailPriority maps a priority onto the X-Priority header, 1 is highest
+func emailPriority(p Priority) string {
+	switch {
+	case p < PriorityNormal:
+		return "5"
+	case p > PriorityNormal:
+		return "1"
+	}
+	return "3"
+}
+
+// buildEmail builds the MIME message
+func buildEmail(from string, to []string, m Message) ([]byte, error) {
+	var msg bytes.Buffer
+	date := m.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+	id := make([]byte, 12)
+	rand.Read(id)
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@firescrew>\r\n", hex.EncodeToString(id))
+	fmt.Fprintf(&msg, "X-Priority: %s\r\n", emailPriority(m.Priority))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	w := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	text, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(text, []byte(m.Text))
+
+	if a := m.Attachment; a != nil {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+func (e *email) Notify(ctx context.Context, m Message) error {
+	body, err := buildEmail(e.from, e.to, m)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	var conn net.Conn
+	if e.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: e.host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(requestTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if !e.tls {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+	if e.user != "" {
+		// PlainAuth refuses to send the password over a connection without TLS unless the host is local
+		if err := client.Auth(smtp.PlainAuth("", e.user, e.password, e.host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,45 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// gotify sends messages to a Gotify server. Gotify has no attachments, they are left out.
+type gotify struct {
+	name   string
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (g *gotify) Name() string {
+	return g.name
+}
+
+// gotifyPriority maps a priority onto Gotify's 0 to 10 scale, where 8 and above alert on Android
+func gotifyPriority(p Priority) int {
+	switch {
+	case p < PriorityNormal:
+		return 2
+	case p > PriorityNormal:
+		return 8
+	}
+	return 5
+}
+
+func (g *gotify) Notify(ctx context.Context, m Message) error {
+	payload, err := json.Marshal(map[string]any{"title": m.Title, "message": m.Text, "priority": gotifyPriority(m.Priority)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.base+"/message", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.token)
+	return do(g.client, req)
+}
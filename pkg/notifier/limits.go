@@ -0,0 +1,314 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy limits the notifications sent about one camera
+type Policy struct {
+	Cooldown   int          `json:"cooldown,omitempty"`   // Seconds after a notification before the next one of the same event type
+	MaxPerHour int          `json:"maxPerHour,omitempty"` // Notifications in any rolling hour, 0 for no limit
+	Dedup      int          `json:"dedup,omitempty"`      // Seconds during which repeats of an event type and zone are dropped
+	Digest     int          `json:"digest,omitempty"`     // Seconds after the first held back event before a summary is sent, 0 discards them
+	QuietHours []QuietHours `json:"quietHours,omitempty"` // Periods in which only high priority messages are sent
+}
+
+// QuietHours is a daily period in local time
+type QuietHours struct {
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM, before start if the period spans midnight
+	Days  []string `json:"days,omitempty"` // Days the period starts on (mon, tue, ...), empty for every day
+
+	start, end int // Minutes after midnight
+	days       map[time.Weekday]bool
+}
+
+// Limits applies a policy to every camera, or a camera's own policy if it has one
+type Limits struct {
+	Policy
+	Cameras map[string]Policy `json:"cameras,omitempty"` // Policies replacing the default for single cameras
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parse validates the period
+func (q *QuietHours) parse() error {
+	var err error
+	if q.start, err = parseClock(q.Start); err != nil {
+		return fmt.Errorf("quiet hours start: %w", err)
+	}
+	if q.end, err = parseClock(q.End); err != nil {
+		return fmt.Errorf("quiet hours end: %w", err)
+	}
+	if len(q.Days) > 0 {
+		q.days = make(map[time.Weekday]bool)
+		for _, d := range q.Days {
+			day, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return fmt.Errorf("quiet hours: unknown day %q", d)
+			}
+			q.days[day] = true
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether t falls in the period
+func (q *QuietHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	startDay := t.Weekday()
+	switch {
+	case q.start == q.end:
+		return false
+	case q.start < q.end:
+		if minute < q.start || minute >= q.end {
+			return false
+		}
+	case minute >= q.start:
+		// Evening part of a period spanning midnight
+	case minute < q.end:
+		// Morning part, the period started the day before
+		startDay = (startDay + 6) % 7
+	default:
+		return false
+	}
+	return q.days == nil || q.days[startDay]
+}
+
+// quiet reports whether t falls in one of the quiet hours
+func (p *Policy) quiet(t time.Time) bool {
+	for i := range p.QuietHours {
+		if p.QuietHours[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse validates the quiet hours of every policy
+func (l *Limits) parse() error {
+	if err := l.Policy.parse(); err != nil {
+		return err
+	}
+	for id, p := range l.Cameras {
+		if err := p.parse(); err != nil {
+			return fmt.Errorf("camera %s: %w", id, err)
+		}
+		l.Cameras[id] = p
+	}
+	return nil
+}
+
+func (p *Policy) parse() error {
+	// Copy so the caller's config is not shared with the gate
+	p.QuietHours = append([]QuietHours(nil), p.QuietHours...)
+	for i := range p.QuietHours {
+		if err := p.QuietHours[i].parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gate applies limits to the messages of each camera. A nil gate allows everything.
+type gate struct {
+	limits Limits
+	send   func(m Message)                 // Sends digests
+	now    func() time.Time                // Replaced in tests
+	after  func(d time.Duration, f func()) // Replaced in tests
+	mu     sync.Mutex
+	state  map[string]*cameraState // By camera ID
+}
+
+// cameraState is what a gate remembers about one camera
+type cameraState struct {
+	lastSent map[string]time.Time // By event type
+	sent     []time.Time          // Notifications in the last hour, oldest first
+	lastSeen map[string]time.Time // By event type and zone
+	digests  map[string]*digest   // Held back events by event type
+}
+
+// digest counts held back events of one type
+type digest struct {
+	count  int
+	first  time.Time
+	sample Message // The first held back message
+}
+
+// newGate returns a gate for the limits, or nil if there are none
+func newGate(limits *Limits, send func(m Message)) (*gate, error) {
+	if limits == nil {
+		return nil, nil
+	}
+	l := *limits
+	l.Cameras = make(map[string]Policy, len(limits.Cameras))
+	for id, p := range limits.Cameras {
+		l.Cameras[id] = p
+	}
+	if err := l.parse(); err != nil {
+		return nil, err
+	}
+	return &gate{
+		limits: l,
+		send:   send,
+		now:    time.Now,
+		after:  func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+		state:  make(map[string]*cameraState),
+	}, nil
+}
+
+// policy returns the policy of a camera
+func (g *gate) policy(cameraID string) *Policy {
+	if p, ok := g.limits.Cameras[cameraID]; ok {
+		return &p
+	}
+	return &g.limits.Policy
+}
+
+func (g *gate) camera(cameraID string) *cameraState {
+	s, ok := g.state[cameraID]
+	if !ok {
+		s = &cameraState{lastSent: make(map[string]time.Time), lastSeen: make(map[string]time.Time), digests: make(map[string]*digest)}
+		g.state[cameraID] = s
+	}
+	return s
+}
+
+// allow reports whether a message may be sent now and records it. Messages held back
+// are counted towards the camera's next digest.
+func (g *gate) allow(m Message) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	p := g.policy(m.CameraID)
+	quiet := p.quiet(now) && m.Priority < PriorityHigh
+	if m.Count > 0 {
+		// Digests are only held back by quiet hours, flush retries them
+		return !quiet
+	}
+
+	s := g.camera(m.CameraID)
+	key := m.EventType + "\x00" + m.Zone
+	if p.Dedup > 0 {
+		last, seen := s.lastSeen[key]
+		s.lastSeen[key] = now
+		if seen && now.Sub(last) < time.Duration(p.Dedup)*time.Second {
+			g.hold(s, p, m, now)
+			return false
+		}
+	}
+
+	if p.MaxPerHour > 0 {
+		hourAgo := now.Add(-time.Hour)
+		for len(s.sent) > 0 && !s.sent[0].After(hourAgo) {
+			s.sent = s.sent[1:]
+		}
+	}
+	last, sent := s.lastSent[m.EventType]
+	switch {
+	case quiet,
+		p.Cooldown > 0 && sent && now.Sub(last) < time.Duration(p.Cooldown)*time.Second,
+		p.MaxPerHour > 0 && len(s.sent) >= p.MaxPerHour:
+		g.hold(s, p, m, now)
+		return false
+	}
+
+	s.lastSent[m.EventType] = now
+	if p.MaxPerHour > 0 {
+		s.sent = append(s.sent, now)
+	}
+	return true
+}
+
+// hold counts a message towards the digest of its event type, starting the digest window
+// with the first one. Without a digest window the message is discarded.
+func (g *gate) hold(s *cameraState, p *Policy, m Message, now time.Time) {
+	if p.Digest <= 0 {
+		return
+	}
+	d, ok := s.digests[m.EventType]
+	if !ok {
+		m.Attachment = nil
+		d = &digest{first: now, sample: m}
+		s.digests[m.EventType] = d
+		cameraID, eventType := m.CameraID, m.EventType
+		g.after(time.Duration(p.Digest)*time.Second, func() { g.flush(cameraID, eventType) })
+	}
+	d.count++
+}
+
+// flush sends the digest of an event type, or waits another window during quiet hours
+func (g *gate) flush(cameraID, eventType string) {
+	g.mu.Lock()
+	s := g.camera(cameraID)
+	d, ok := s.digests[eventType]
+	if !ok {
+		g.mu.Unlock()
+		return
+	}
+	p := g.policy(cameraID)
+	now := g.now()
+	if p.quiet(now) && d.sample.Priority < PriorityHigh {
+		g.after(time.Duration(p.Digest)*time.Second, func() { g.flush(cameraID, eventType) })
+		g.mu.Unlock()
+		return
+	}
+	delete(s.digests, eventType)
+	g.mu.Unlock()
+
+	g.send(digestMessage(d, now))
+}
+
+// digestMessage summarises held back events, e.g. "14 motion_start events on Garage in the last 10 min"
+func digestMessage(d *digest, now time.Time) Message {
+	m := d.sample
+	camera := m.CameraName
+	if camera == "" {
+		camera = m.CameraID
+	}
+	noun := "events"
+	if d.count == 1 {
+		noun = "event"
+	}
+	text := fmt.Sprintf("%d %s %s", d.count, m.EventType, noun)
+	if m.Zone != "" {
+		text += " in " + m.Zone
+	}
+	if camera != "" {
+		text += " on " + camera
+	}
+	m.Text = text + " in the last " + formatWindow(now.Sub(d.first))
+	m.Count = d.count
+	m.Time = now
+	return m
+}
+
+// formatWindow formats a duration as seconds, minutes or hours
+func formatWindow(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d s", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d min", int(d.Round(time.Minute).Minutes()))
+	}
+	return fmt.Sprintf("%d h", int(d.Round(time.Hour).Hours()))
+}
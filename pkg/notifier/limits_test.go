@@ -0,0 +1,216 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// recorder is a notifier keeping the messages it was sent
+type recorder struct {
+	messages []Message
+}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Notify(ctx context.Context, m Message) error {
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+// testGate returns a gate on a fake clock. Digest windows are collected instead of scheduled.
+func testGate(t *testing.T, limits Limits, sent *[]Message) (*gate, *time.Time, *[]func()) {
+	g, err := newGate(&limits, func(m Message) { *sent = append(*sent, m) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local) // Wednesday
+	var pending []func()
+	g.now = func() time.Time { return now }
+	g.after = func(d time.Duration, f func()) { pending = append(pending, f) }
+	return g, &now, &pending
+}
+
+func TestQuietHours(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local) // 12th is a Monday
+	}
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		t     time.Time
+		want  bool
+	}{
+		{"inside", QuietHours{Start: "09:00", End: "17:00"}, at(12, 12, 0), true},
+		{"end is exclusive", QuietHours{Start: "09:00", End: "17:00"}, at(12, 17, 0), false},
+		{"evening across midnight", QuietHours{Start: "22:00", End: "07:00"}, at(12, 23, 30), true},
+		{"morning across midnight", QuietHours{Start: "22:00", End: "07:00"}, at(12, 6, 59), true},
+		{"daytime across midnight", QuietHours{Start: "22:00", End: "07:00"}, at(12, 12, 0), false},
+		{"weekday", QuietHours{Start: "09:00", End: "17:00", Days: []string{"mon"}}, at(12, 10, 0), true},
+		{"other weekday", QuietHours{Start: "09:00", End: "17:00", Days: []string{"mon"}}, at(13, 10, 0), false},
+		// Saturday morning belongs to the period starting Friday night
+		{"started the day before", QuietHours{Start: "22:00", End: "07:00", Days: []string{"Fri"}}, at(17, 6, 0), true},
+		{"not started the day before", QuietHours{Start: "22:00", End: "07:00", Days: []string{"fri"}}, at(16, 6, 0), false},
+	}
+	for _, test := range tests {
+		if err := test.quiet.parse(); err != nil {
+			t.Fatal(err)
+		}
+		if got := test.quiet.contains(test.t); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	for _, invalid := range []QuietHours{{Start: "25:00", End: "07:00"}, {Start: "22:00"}, {Start: "22:00", End: "07:00", Days: []string{"someday"}}} {
+		if err := invalid.parse(); err == nil {
+			t.Errorf("%+v parsed", invalid)
+		}
+	}
+}
+
+func TestGate(t *testing.T) {
+	motion := Message{EventType: "motion_start", CameraID: "garage", CameraName: "Garage"}
+	offline := Message{EventType: "camera_offline", CameraID: "garage", Priority: PriorityHigh}
+
+	type step struct {
+		after time.Duration // Clock advance before the message
+		m     Message
+		want  bool
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		steps  []step
+	}{
+		{
+			name:   "cooldown per event type",
+			limits: Limits{Policy: Policy{Cooldown: 60}},
+			steps: []step{
+				{0, motion, true},
+				{30 * time.Second, motion, false},
+				{0, offline, true},
+				{31 * time.Second, motion, true},
+			},
+		},
+		{
+			name:   "max per rolling hour",
+			limits: Limits{Policy: Policy{MaxPerHour: 2}},
+			steps: []step{
+				{0, motion, true},
+				{20 * time.Minute, motion, true},
+				{20 * time.Minute, offline, false},
+				{21 * time.Minute, motion, true},
+			},
+		},
+		{
+			name:   "dedup by type and zone",
+			limits: Limits{Policy: Policy{Dedup: 60}},
+			steps: []step{
+				{0, motion, true},
+				{0, Message{EventType: "motion_start", CameraID: "garage", Zone: "door"}, true},
+				{50 * time.Second, motion, false},
+				// Repeats extend the window
+				{50 * time.Second, motion, false},
+				{61 * time.Second, motion, true},
+			},
+		},
+		{
+			name:   "quiet hours let high priority through",
+			limits: Limits{Policy: Policy{QuietHours: []QuietHours{{Start: "11:00", End: "13:00"}}}},
+			steps: []step{
+				{0, motion, false},
+				{0, offline, true},
+				{2 * time.Hour, motion, true},
+			},
+		},
+		{
+			name:   "camera policy replaces the default",
+			limits: Limits{Policy: Policy{Cooldown: 60}, Cameras: map[string]Policy{"front": {}}},
+			steps: []step{
+				{0, Message{EventType: "motion_start", CameraID: "front"}, true},
+				{0, Message{EventType: "motion_start", CameraID: "front"}, true},
+				{0, motion, true},
+				{0, motion, false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var sent []Message
+		g, now, _ := testGate(t, test.limits, &sent)
+		for i, s := range test.steps {
+			*now = now.Add(s.after)
+			if got := g.allow(s.m); got != s.want {
+				t.Errorf("%s: step %d got %v, want %v", test.name, i, got, s.want)
+			}
+		}
+	}
+
+	var nilGate *gate
+	if !nilGate.allow(motion) {
+		t.Error("nil gate held back a message")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	var sent []Message
+	g, now, pending := testGate(t, Limits{Policy: Policy{Cooldown: 600, Digest: 600,
+		QuietHours: []QuietHours{{Start: "12:10", End: "12:20"}}}}, &sent)
+	motion := Message{Title: "Motion detected", EventType: "motion_start", CameraID: "garage", CameraName: "Garage",
+		Attachment: &Attachment{Name: "snapshot.jpg"}}
+
+	if !g.allow(motion) {
+		t.Fatal("first message held back")
+	}
+	for i := 0; i < 14; i++ {
+		*now = now.Add(10 * time.Second)
+		g.allow(motion)
+	}
+	if len(*pending) != 1 {
+		t.Fatalf("%d digest windows started, want 1", len(*pending))
+	}
+
+	// The window ends in quiet hours, the digest waits for another window
+	*now = now.Add(10 * time.Minute)
+	(*pending)[0]()
+	if len(sent) != 0 || len(*pending) != 2 {
+		t.Fatalf("digest sent during quiet hours: %+v", sent)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	(*pending)[1]()
+	if len(sent) != 1 {
+		t.Fatalf("got %d digests", len(sent))
+	}
+	d := sent[0]
+	if d.Count != 14 || d.Text != "14 motion_start events on Garage in the last 22 min" || d.Attachment != nil || d.Title != "Motion detected" {
+		t.Errorf("got %+v", d)
+	}
+	// Digests pass the cooldown
+	if !g.allow(d) {
+		t.Error("digest held back")
+	}
+}
+
+func TestRouterLimits(t *testing.T) {
+	all, limited := &recorder{}, &recorder{}
+	r, err := NewRouter(nil, &Limits{Policy: Policy{MaxPerHour: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add(all, nil, nil, nil)
+	r.Add(limited, nil, nil, &Limits{Policy: Policy{Cooldown: 3600}})
+
+	for i := 0; i < 5; i++ {
+		r.Notify(context.Background(), Message{EventType: "motion_start", CameraID: "garage"})
+	}
+	if len(all.messages) != 3 || len(limited.messages) != 1 {
+		t.Errorf("got %d and %d messages, want 3 and 1", len(all.messages), len(limited.messages))
+	}
+
+	if _, err := NewRouter(nil, &Limits{Policy: Policy{QuietHours: []QuietHours{{Start: "late"}}}}); err == nil {
+		t.Error("invalid quiet hours accepted")
+	}
+}
@@ -0,0 +1,278 @@
+// Package notifier sends human-readable notifications to push, chat and email services.
+// Every service implements Notifier; a Router fans a message out to the notifiers
+// configured for its camera and event type.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+)
+
+// requestTimeout bounds a request to a notification service
+const requestTimeout = 30 * time.Second
+
+// Priority of a notification, mapped onto each service's own scale
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 // Delivered quietly
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1 // Bypasses quiet settings where the service supports it
+)
+
+// Attachment is an image or clip sent with a notification
+type Attachment struct {
+	Name        string // File name, e.g. snapshot.jpg
+	ContentType string // image/jpeg, image/gif or video/mp4
+	Data        []byte
+}
+
+// Message is a notification about an event
+type Message struct {
+	Title      string
+	Text       string
+	Priority   Priority
+	Attachment *Attachment // Optional
+
+	// Used for routing and limits, and shown where the service has room for details
+	EventType  string
+	CameraID   string
+	CameraName string
+	Zone       string // Part of the image the event is about, repeats are deduplicated by type and zone
+	Time       time.Time
+
+	Count int // Number of events summarised by a digest, 0 for a single event
+}
+
+// Notifier delivers messages to one service
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, m Message) error
+}
+
+// Notifier types
+const (
+	TypePushover = "pushover"
+	TypeTelegram = "telegram"
+	TypeNtfy     = "ntfy"
+	TypeGotify   = "gotify"
+	TypeEmail    = "email"
+	TypeSlack    = "slack"
+)
+
+// Config configures one notifier. Which fields apply depends on the type.
+type Config struct {
+	Type string `json:"type"`           // pushover, telegram, ntfy, gotify, email or slack
+	Name string `json:"name,omitempty"` // Shown in logs, default the type
+	URL  string `json:"url,omitempty"`  // Service base URL, or the Slack webhook URL. Defaults to the public service
+
+	Token  string `json:"token,omitempty"`  // Pushover app token, Telegram bot token, ntfy access token or Gotify app token
+	User   string `json:"user,omitempty"`   // Pushover user key, or the SMTP user
+	ChatID string `json:"chatId,omitempty"` // Telegram chat
+	Topic  string `json:"topic,omitempty"`  // ntfy topic
+
+	Host     string   `json:"host,omitempty"` // SMTP server
+	Port     int      `json:"port,omitempty"` // SMTP port, default 587, or 465 with tls
+	Password string   `json:"password,omitempty"`
+	TLS      bool     `json:"tls,omitempty"` // Implicit TLS instead of STARTTLS
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+
+	Cameras []string `json:"cameras,omitempty"` // Camera IDs routed to this notifier, empty routes every camera
+	Types   []string `json:"types,omitempty"`   // Event types routed to this notifier, empty routes every type
+	Limits  *Limits  `json:"limits,omitempty"`  // Limits of this notifier on top of the router's
+}
+
+// New creates a notifier from its config
+func New(c Config) (Notifier, error) {
+	client := &http.Client{Timeout: requestTimeout}
+	switch c.Type {
+	case TypePushover:
+		if c.Token == "" || c.User == "" {
+			return nil, errors.New("pushover needs token and user")
+		}
+		return &pushover{name: c.name(), base: baseURL(c.URL, "https://api.pushover.net"), token: c.Token, user: c.User, client: client}, nil
+	case TypeTelegram:
+		if c.Token == "" || c.ChatID == "" {
+			return nil, errors.New("telegram needs token and chatId")
+		}
+		return &telegram{name: c.name(), base: baseURL(c.URL, "https://api.telegram.org"), token: c.Token, chatID: c.ChatID, client: client}, nil
+	case TypeNtfy:
+		if c.Topic == "" {
+			return nil, errors.New("ntfy needs topic")
+		}
+		return &ntfy{name: c.name(), base: baseURL(c.URL, "https://ntfy.sh"), topic: c.Topic, token: c.Token, client: client}, nil
+	case TypeGotify:
+		if c.URL == "" || c.Token == "" {
+			return nil, errors.New("gotify needs url and token")
+		}
+		return &gotify{name: c.name(), base: baseURL(c.URL, ""), token: c.Token, client: client}, nil
+	case TypeEmail:
+		return newEmail(c)
+	case TypeSlack:
+		if c.URL == "" {
+			return nil, errors.New("slack needs the webhook url")
+		}
+		return &slack{name: c.name(), url: c.URL, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+}
+
+func (c Config) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+// baseURL returns the configured URL without a trailing slash, or the default
+func baseURL(configured, fallback string) string {
+	if configured == "" {
+		return fallback
+	}
+	return strings.TrimRight(configured, "/")
+}
+
+// do sends a request and turns responses other than 2xx into errors with the start of the body
+func do(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if body = bytes.TrimSpace(body); len(body) > 0 {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// route is a notifier with the cameras and event types it receives
+type route struct {
+	notifier Notifier
+	filter   eventSinks.Filter // Selects messages the same way as the event sinks
+	gate     *gate             // Limits of this notifier, nil for none
+}
+
+// match reports whether the route receives a message
+func (r *route) match(m Message) bool {
+	return r.filter.Match(eventSinks.Event{Type: m.EventType, CameraID: m.CameraID})
+}
+
+// Router sends messages to the notifiers routed to their camera and event type,
+// within the limits of the router and of each notifier
+type Router struct {
+	routes []*route
+	gate   *gate // Limits across notifiers, nil for none
+}
+
+// NewRouter creates the configured notifiers. limits, if not nil, applies to every notifier.
+func NewRouter(configs []Config, limits *Limits) (*Router, error) {
+	r := &Router{}
+	var err error
+	if r.gate, err = newGate(limits, r.digest); err != nil {
+		return nil, fmt.Errorf("notification limits: %w", err)
+	}
+	for i, c := range configs {
+		n, err := New(c)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i, err)
+		}
+		if err := r.Add(n, c.Cameras, c.Types, c.Limits); err != nil {
+			return nil, fmt.Errorf("notifier %d: %w", i, err)
+		}
+	}
+	return r, nil
+}
+
+// Add routes messages for the cameras and event types to a notifier. Empty lists match everything.
+// limits, if not nil, applies to this notifier only.
+func (r *Router) Add(n Notifier, cameras, types []string, limits *Limits) error {
+	route := &route{notifier: n, filter: eventSinks.Filter{Types: types, Cameras: cameras}}
+	var err error
+	route.gate, err = newGate(limits, func(m Message) {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		if err := n.Notify(ctx, m); err != nil {
+			log.Printf("Failed to send %s notification: %v", n.Name(), err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+// Wants reports whether any notifier receives messages of an event type and camera,
+// so callers can skip building attachments nobody receives. A nil router wants nothing.
+func (r *Router) Wants(eventType, cameraID string) bool {
+	if r == nil {
+		return false
+	}
+	m := Message{EventType: eventType, CameraID: cameraID}
+	for _, route := range r.routes {
+		if route.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify sends a message to the matching notifiers in parallel and waits for them.
+// Messages held back by the limits are dropped or summarised in a later digest.
+// Failures are logged and returned joined.
+func (r *Router) Notify(ctx context.Context, m Message) error {
+	if r == nil {
+		return nil
+	}
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	if !r.gate.allow(m) {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for _, route := range r.routes {
+		if !route.match(m) || !route.gate.allow(m) {
+			continue
+		}
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+			if err := n.Notify(ctx, m); err != nil {
+				log.Printf("Failed to send %s notification: %v", n.Name(), err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+				mu.Unlock()
+			}
+		}(route.notifier)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// digest sends a digest of the router's limits to the matching notifiers
+func (r *Router) digest(m Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	r.Notify(ctx, m)
+}
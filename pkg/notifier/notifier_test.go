@@ -0,0 +1,277 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// request is what a stand-in service received
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+	form   map[string]string // Multipart fields, file parts by field name as their content
+	files  map[string]string // File names of multipart file parts by field name
+}
+
+// standIn starts a server recording the requests it receives
+func standIn(t *testing.T) (*httptest.Server, func() []request) {
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.Path, header: r.Header.Clone(), form: map[string]string{}, files: map[string]string{}}
+		if mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					break
+				}
+				data, _ := io.ReadAll(part)
+				req.form[part.FormName()] = string(data)
+				if part.FileName() != "" {
+					req.files[part.FormName()] = part.FileName()
+				}
+			}
+		} else {
+			req.body, _ = io.ReadAll(r.Body)
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	jpeg := &Attachment{Name: "snapshot.jpg", ContentType: "image/jpeg", Data: []byte("jpeg")}
+	gif := &Attachment{Name: "motion.gif", ContentType: "image/gif", Data: []byte("gif")}
+
+	tests := []struct {
+		name    string
+		config  Config
+		message Message
+		check   func(t *testing.T, r request)
+	}{
+		{
+			name:    "pushover",
+			config:  Config{Type: TypePushover, Token: "app", User: "user"},
+			message: Message{Title: "Motion", Text: "Front door", Priority: PriorityHigh, Attachment: jpeg},
+			check: func(t *testing.T, r request) {
+				if r.path != "/1/messages.json" || r.form["token"] != "app" || r.form["user"] != "user" ||
+					r.form["priority"] != "1" || r.form["attachment"] != "jpeg" || r.files["attachment"] != "snapshot.jpg" {
+					t.Errorf("got %s %v", r.path, r.form)
+				}
+			},
+		},
+		{
+			name:    "telegram text",
+			config:  Config{Type: TypeTelegram, Token: "123:abc", ChatID: "42"},
+			message: Message{Title: "Offline", Text: "Garage"},
+			check: func(t *testing.T, r request) {
+				var payload map[string]any
+				json.Unmarshal(r.body, &payload)
+				if r.path != "/bot123:abc/sendMessage" || payload["chat_id"] != "42" || payload["text"] != "Offline\nGarage" {
+					t.Errorf("got %s %s", r.path, r.body)
+				}
+			},
+		},
+		{
+			name:    "telegram gif",
+			config:  Config{Type: TypeTelegram, Token: "123:abc", ChatID: "42"},
+			message: Message{Title: "Motion", Text: "Garage", Priority: PriorityLow, Attachment: gif},
+			check: func(t *testing.T, r request) {
+				if r.path != "/bot123:abc/sendAnimation" || r.form["animation"] != "gif" || r.form["caption"] != "Motion\nGarage" ||
+					r.form["disable_notification"] != "true" {
+					t.Errorf("got %s %v", r.path, r.form)
+				}
+			},
+		},
+		{
+			name:    "ntfy",
+			config:  Config{Type: TypeNtfy, Topic: "cams", Token: "tk"},
+			message: Message{Title: "Bewegung – Tür", Text: "Front door", Priority: PriorityHigh, EventType: "motion_start"},
+			check: func(t *testing.T, r request) {
+				title, _ := new(mime.WordDecoder).DecodeHeader(r.header.Get("Title"))
+				if r.method != http.MethodPost || r.path != "/cams" || string(r.body) != "Front door" || title != "Bewegung – Tür" ||
+					r.header.Get("Priority") != "5" || r.header.Get("Authorization") != "Bearer tk" {
+					t.Errorf("got %s %s %v %s", r.method, r.path, r.header, r.body)
+				}
+			},
+		},
+		{
+			name:    "ntfy attachment",
+			config:  Config{Type: TypeNtfy, Topic: "cams"},
+			message: Message{Title: "Motion", Text: "Front door", Attachment: jpeg},
+			check: func(t *testing.T, r request) {
+				if r.method != http.MethodPut || string(r.body) != "jpeg" || r.header.Get("Filename") != "snapshot.jpg" ||
+					r.header.Get("Message") != "Front door" {
+					t.Errorf("got %s %v %s", r.method, r.header, r.body)
+				}
+			},
+		},
+		{
+			name:    "gotify",
+			config:  Config{Type: TypeGotify, Token: "gt"},
+			message: Message{Title: "Offline", Text: "Garage", Priority: PriorityHigh, Attachment: jpeg},
+			check: func(t *testing.T, r request) {
+				var payload map[string]any
+				json.Unmarshal(r.body, &payload)
+				if r.path != "/message" || r.header.Get("X-Gotify-Key") != "gt" || payload["priority"] != float64(8) || payload["message"] != "Garage" {
+					t.Errorf("got %s %v %s", r.path, r.header, r.body)
+				}
+			},
+		},
+		{
+			name:    "slack",
+			config:  Config{Type: TypeSlack},
+			message: Message{Title: "Offline", Text: "Garage", CameraID: "garage", EventType: "camera_offline"},
+			check: func(t *testing.T, r request) {
+				var payload struct {
+					Text   string           `json:"text"`
+					Blocks []map[string]any `json:"blocks"`
+				}
+				json.Unmarshal(r.body, &payload)
+				if payload.Text != "Offline: Garage" || len(payload.Blocks) != 3 || payload.Blocks[0]["type"] != "header" {
+					t.Errorf("got %s", r.body)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := standIn(t)
+			test.config.URL = server.URL
+			n, err := New(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := n.Notify(context.Background(), test.message); err != nil {
+				t.Fatal(err)
+			}
+			got := requests()
+			if len(got) != 1 {
+				t.Fatalf("got %d requests", len(got))
+			}
+			test.check(t, got[0])
+		})
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	tests := []Config{
+		{Type: "pager"},
+		{Type: TypePushover, Token: "app"},
+		{Type: TypeTelegram, Token: "123:abc"},
+		{Type: TypeNtfy},
+		{Type: TypeGotify, Token: "gt"},
+		{Type: TypeEmail, Host: "mail", From: "cam@example.com"},
+		{Type: TypeSlack},
+	}
+	for _, c := range tests {
+		if _, err := New(c); err == nil {
+			t.Errorf("New(%+v) succeeded", c)
+		}
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	n, _ := New(Config{Type: TypeGotify, URL: server.URL, Token: "gt"})
+	err := n.Notify(context.Background(), Message{Text: "x"})
+	if err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	server, requests := standIn(t)
+	r, err := NewRouter([]Config{
+		{Type: TypeNtfy, URL: server.URL, Topic: "all"},
+		{Type: TypeNtfy, URL: server.URL, Topic: "garage", Cameras: []string{"garage"}},
+		{Type: TypeNtfy, URL: server.URL, Topic: "offline", Types: []string{"camera_offline"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message Message
+		topics  []string
+	}{
+		{Message{CameraID: "front", EventType: "motion_start"}, []string{"/all"}},
+		{Message{CameraID: "garage", EventType: "motion_start"}, []string{"/all", "/garage"}},
+		{Message{CameraID: "garage", EventType: "camera_offline"}, []string{"/all", "/garage", "/offline"}},
+		{Message{EventType: "camera_offline"}, []string{"/all", "/garage", "/offline"}},
+	}
+	seen := 0
+	for _, test := range tests {
+		if !r.Wants(test.message.EventType, test.message.CameraID) {
+			t.Errorf("Wants(%s, %s) = false", test.message.EventType, test.message.CameraID)
+		}
+		if err := r.Notify(context.Background(), test.message); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, req := range requests()[seen:] {
+			got[req.path] = true
+		}
+		seen = len(requests())
+		if len(got) != len(test.topics) {
+			t.Errorf("%+v: got %v, want %v", test.message, got, test.topics)
+			continue
+		}
+		for _, topic := range test.topics {
+			if !got[topic] {
+				t.Errorf("%+v: got %v, want %v", test.message, got, test.topics)
+			}
+		}
+	}
+
+	var nilRouter *Router
+	if nilRouter.Wants("motion_start", "front") || nilRouter.Notify(context.Background(), Message{}) != nil {
+		t.Error("nil router is not a no-op")
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	m := Message{Title: "Kamera offline", Text: "Garage", Priority: PriorityHigh,
+		Attachment: &Attachment{Name: "snapshot.jpg", ContentType: "image/jpeg", Data: []byte("jpeg")}}
+	data, err := buildEmail("cam@example.com", []string{"a@example.com", "b@example.com"}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(data)
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: Kamera offline\r\n",
+		"X-Priority: 1\r\n",
+		"Content-Type: multipart/mixed; boundary=",
+		"Content-Disposition: attachment; filename=snapshot.jpg",
+		"R2FyYWdl\r\n", // Garage
+		"anBlZw==\r\n", // jpeg
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
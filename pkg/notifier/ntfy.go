@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ntfy publishes messages to an ntfy topic
+type ntfy struct {
+	name   string
+	base   string
+	topic  string
+	token  string // Optional access token
+	client *http.Client
+}
+
+func (n *ntfy) Name() string {
+	return n.name
+}
+
+// ntfyPriority maps a priority onto ntfy's 1 (min) to 5 (max) scale
+func ntfyPriority(p Priority) string {
+	switch {
+	case p < PriorityNormal:
+		return "2"
+	case p > PriorityNormal:
+		return "5"
+	}
+	return "3"
+}
+
+func (n *ntfy) Notify(ctx context.Context, m Message) error {
+	// The body is the message, or the attachment with the message in a header
+	method, body := http.MethodPost, []byte(m.Text)
+	if m.Attachment != nil {
+		method, body = http.MethodPut, m.Attachment.Data
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, n.base+"/"+url.PathEscape(n.topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Headers must be ASCII, ntfy decodes RFC 2047 encoded words
+	if m.Title != "" {
+		req.Header.Set("Title", mime.QEncoding.Encode("utf-8", m.Title))
+	}
+	if m.Attachment != nil {
+		req.Header.Set("Filename", m.Attachment.Name)
+		req.Header.Set("Message", mime.QEncoding.Encode("utf-8", strings.ReplaceAll(m.Text, "\n", " ")))
+	}
+	req.Header.Set("Priority", ntfyPriority(m.Priority))
+	if m.EventType != "" {
+		req.Header.Set("Tags", m.EventType)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return do(n.client, req)
+}
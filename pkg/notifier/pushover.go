@@ -0,0 +1,49 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// pushover sends messages through the Pushover API
+type pushover struct {
+	name   string
+	base   string
+	token  string
+	user   string
+	client *http.Client
+}
+
+func (p *pushover) Name() string {
+	return p.name
+}
+
+func (p *pushover) Notify(ctx context.Context, m Message) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("token", p.token)
+	w.WriteField("user", p.user)
+	w.WriteField("title", m.Title)
+	w.WriteField("message", m.Text)
+	w.WriteField("priority", strconv.Itoa(int(m.Priority)))
+	if a := m.Attachment; a != nil {
+		fw, err := w.CreateFormFile("attachment", a.Name)
+		if err != nil {
+			return err
+		}
+		fw.Write(a.Data)
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.base+"/1/messages.json", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return do(p.client, req)
+}
@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// slack posts Block Kit messages to an incoming webhook. Webhooks cannot upload files,
+// attachments are left out.
+type slack struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func (s *slack) Name() string {
+	return s.name
+}
+
+// slackBlocks lays out a message as a header, the text and a context line with the camera and time
+func slackBlocks(m Message) []map[string]any {
+	var blocks []map[string]any
+	if m.Title != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "header",
+			"text": map[string]any{"type": "plain_text", "text": m.Title},
+		})
+	}
+	if m.Text != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]any{"type": "mrkdwn", "text": m.Text},
+		})
+	}
+
+	var details []map[string]any
+	if camera := m.CameraName; camera != "" || m.CameraID != "" {
+		if camera == "" {
+			camera = m.CameraID
+		}
+		details = append(details, map[string]any{"type": "mrkdwn", "text": "*Camera:* " + camera})
+	}
+	if m.EventType != "" {
+		details = append(details, map[string]any{"type": "mrkdwn", "text": "*Event:* " + m.EventType})
+	}
+	if !m.Time.IsZero() {
+		details = append(details, map[string]any{"type": "mrkdwn", "text": m.Time.Format("2006-01-02 15:04:05")})
+	}
+	if len(details) > 0 {
+		blocks = append(blocks, map[string]any{"type": "context", "elements": details})
+	}
+	return blocks
+}
+
+func (s *slack) Notify(ctx context.Context, m Message) error {
+	// text is the fallback shown in notifications
+	text := m.Text
+	if m.Title != "" {
+		text = m.Title + ": " + text
+	}
+	payload, err := json.Marshal(map[string]any{"text": text, "blocks": slackBlocks(m)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.client, req)
+}
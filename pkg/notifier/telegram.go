@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// telegramCaptionLimit is the longest caption Telegram accepts on media
+const telegramCaptionLimit = 1024
+
+// telegram sends messages through a Telegram bot
+type telegram struct {
+	name   string
+	base   string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func (t *telegram) Name() string {
+	return t.name
+}
+
+func (t *telegram) Notify(ctx context.Context, m Message) error {
+	text := m.Text
+	if m.Title != "" {
+		text = m.Title + "\n" + text
+	}
+	quiet := m.Priority == PriorityLow
+
+	if m.Attachment == nil {
+		payload, err := json.Marshal(map[string]any{"chat_id": t.chatID, "text": text, "disable_notification": quiet})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.method("sendMessage"), bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return do(t.client, req)
+	}
+
+	// Photos are recompressed by Telegram, GIFs and clips are sent as animations and videos
+	method, field := "sendPhoto", "photo"
+	switch {
+	case m.Attachment.ContentType == "image/gif":
+		method, field = "sendAnimation", "animation"
+	case strings.HasPrefix(m.Attachment.ContentType, "video/"):
+		method, field = "sendVideo", "video"
+	}
+	if len(text) > telegramCaptionLimit {
+		text = text[:telegramCaptionLimit]
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("chat_id", t.chatID)
+	w.WriteField("caption", text)
+	if quiet {
+		w.WriteField("disable_notification", "true")
+	}
+	fw, err := w.CreateFormFile(field, m.Attachment.Name)
+	if err != nil {
+		return err
+	}
+	fw.Write(m.Attachment.Data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.method(method), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return do(t.client, req)
+}
+
+// method returns the URL of a bot API method
+func (t *telegram) method(name string) string {
+	return t.base + "/bot" + t.token + "/" + name
+}
@@ -0,0 +1,144 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Formats a preview can be rendered in
+const (
+	FormatGIF = "gif"
+	FormatMP4 = "mp4"
+)
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatMP4 {
+		return "video/mp4"
+	}
+	return "image/gif"
+}
+
+// Render encodes frames in a format
+func Render(ctx context.Context, format string, frames []Frame) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatGIF, "":
+		err = EncodeGIF(&buf, frames)
+	case FormatMP4:
+		err = EncodeMP4(ctx, &buf, frames)
+	default:
+		err = fmt.Errorf("unknown preview format %q", format)
+	}
+	return buf.Bytes(), err
+}
+
+// delays returns the display time of each frame, the gap to the next frame, the last
+// frame shown as long as the one before it
+func delays(frames []Frame) []time.Duration {
+	d := make([]time.Duration, len(frames))
+	for i := range frames {
+		switch {
+		case i+1 < len(frames):
+			d[i] = frames[i+1].Time.Sub(frames[i].Time)
+		case i > 0:
+			d[i] = d[i-1]
+		default:
+			d[i] = 200 * time.Millisecond
+		}
+	}
+	return d
+}
+
+// EncodeGIF writes frames as a looping GIF with one median-cut palette shared by all frames,
+// dithered with Floyd-Steinberg
+func EncodeGIF(w io.Writer, frames []Frame) error {
+	if len(frames) == 0 {
+		return errors.New("no frames")
+	}
+	images := make([]*image.RGBA, len(frames))
+	for i, f := range frames {
+		images[i] = f.Image
+	}
+	palette := MedianCut(images, 256)
+	bounds := frames[0].Image.Bounds()
+
+	anim := &gif.GIF{Config: image.Config{ColorModel: palette, Width: bounds.Dx(), Height: bounds.Dy()}}
+	for i, d := range delays(frames) {
+		paletted := image.NewPaletted(bounds, palette)
+		draw.FloydSteinberg.Draw(paletted, bounds, images[i], images[i].Bounds().Min)
+		anim.Image = append(anim.Image, paletted)
+		// GIF delays are in hundredths of a second, browsers slow down anything under 2
+		anim.Delay = append(anim.Delay, max(2, int(d/(10*time.Millisecond))))
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// EncodeMP4 writes frames as an H.264 MP4 clip using ffmpeg. The frame rate is the average
+// rate of the frames.
+func EncodeMP4(ctx context.Context, w io.Writer, frames []Frame) error {
+	if len(frames) == 0 {
+		return errors.New("no frames")
+	}
+	fps := 5.0
+	if n := len(frames); n > 1 {
+		if span := frames[n-1].Time.Sub(frames[0].Time).Seconds(); span > 0 {
+			fps = float64(n-1) / span
+		}
+	}
+	bounds := frames[0].Image.Bounds()
+
+	// Fragmented MP4 can be written to a pipe, faststart would need a seekable file
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", bounds.Dx(), bounds.Dy()),
+		"-r", strconv.FormatFloat(fps, 'f', 3, 64),
+		"-i", "pipe:0",
+		"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4", "pipe:1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	go func() {
+		defer stdin.Close()
+		for _, f := range frames {
+			if _, err := stdin.Write(frameBytes(f.Image, bounds)); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// frameBytes returns the RGBA pixels of img in bounds, all frames of a clip must have the same size
+func frameBytes(img *image.RGBA, bounds image.Rectangle) []byte {
+	if img.Bounds() == bounds && img.Stride == 4*bounds.Dx() {
+		return img.Pix
+	}
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, img, img.Bounds().Min, draw.Src)
+	return dst.Pix
+}
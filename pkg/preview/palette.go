@@ -0,0 +1,104 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// maxPaletteSamples bounds the pixels sampled across all images when building a palette
+const maxPaletteSamples = 200000
+
+// colorBox is a set of sampled colours split by median cut
+type colorBox struct {
+	pixels [][3]uint8
+}
+
+// widest returns the channel with the largest range and that range
+func (b *colorBox) widest() (int, int) {
+	channel, widest := 0, -1
+	for c := 0; c < 3; c++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, p := range b.pixels {
+			if p[c] < lo {
+				lo = p[c]
+			}
+			if p[c] > hi {
+				hi = p[c]
+			}
+		}
+		if r := int(hi) - int(lo); r > widest {
+			channel, widest = c, r
+		}
+	}
+	return channel, widest
+}
+
+// mean returns the average colour of the box
+func (b *colorBox) mean() color.RGBA {
+	var sum [3]int
+	for _, p := range b.pixels {
+		sum[0] += int(p[0])
+		sum[1] += int(p[1])
+		sum[2] += int(p[2])
+	}
+	n := len(b.pixels)
+	return color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 255}
+}
+
+// MedianCut builds a palette of at most n colours for the images. The sampled colours are
+// split into boxes at the median of their widest channel, the box with the widest range
+// first, and each box contributes its mean colour.
+func MedianCut(images []*image.RGBA, n int) color.Palette {
+	total := 0
+	for _, img := range images {
+		total += img.Bounds().Dx() * img.Bounds().Dy()
+	}
+	if total == 0 || n <= 0 {
+		return color.Palette{color.Black}
+	}
+	step := total/maxPaletteSamples + 1
+
+	samples := make([][3]uint8, 0, total/step+1)
+	i := 0
+	for _, img := range images {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if i%step == 0 {
+					o := img.PixOffset(x, y)
+					samples = append(samples, [3]uint8{img.Pix[o], img.Pix[o+1], img.Pix[o+2]})
+				}
+				i++
+			}
+		}
+	}
+
+	boxes := []*colorBox{{pixels: samples}}
+	for len(boxes) < n {
+		// Split the box with the widest channel range
+		split, channel, widest := -1, 0, 0
+		for i, b := range boxes {
+			if len(b.pixels) < 2 {
+				continue
+			}
+			if c, r := b.widest(); r > widest {
+				split, channel, widest = i, c, r
+			}
+		}
+		if split < 0 {
+			break
+		}
+		b := boxes[split]
+		sort.Slice(b.pixels, func(i, j int) bool { return b.pixels[i][channel] < b.pixels[j][channel] })
+		median := len(b.pixels) / 2
+		boxes[split] = &colorBox{pixels: b.pixels[:median]}
+		boxes = append(boxes, &colorBox{pixels: b.pixels[median:]})
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, b := range boxes {
+		palette = append(palette, b.mean())
+	}
+	return palette
+}
@@ -0,0 +1,91 @@
+// Package preview keeps a rolling buffer of downscaled frames and renders the frames
+// around an event as an animated GIF or a short H.264 MP4 clip.
+package preview
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Frame is a downscaled frame and when it was captured
+type Frame struct {
+	Image *image.RGBA
+	Time  time.Time
+}
+
+// Buffer keeps the most recent frames at a reduced size and rate
+type Buffer struct {
+	width    int           // Width frames are scaled to, 0 keeps the source width
+	interval time.Duration // Minimum time between kept frames
+	keep     time.Duration // Age after which frames are dropped
+
+	mu     sync.Mutex
+	frames []Frame // Oldest first
+}
+
+// NewBuffer keeps frames scaled to width at up to fps frames per second for the last keep duration
+func NewBuffer(width int, fps float64, keep time.Duration) *Buffer {
+	b := &Buffer{width: width, keep: keep}
+	if fps > 0 {
+		b.interval = time.Duration(float64(time.Second) / fps)
+	}
+	return b
+}
+
+// Add offers a frame captured at t. It is skipped if the previous frame is too recent,
+// otherwise a scaled copy is kept, so the caller may reuse img.
+func (b *Buffer) Add(img *image.RGBA, t time.Time) {
+	b.mu.Lock()
+	if n := len(b.frames); n > 0 && t.Sub(b.frames[n-1].Time) < b.interval {
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+
+	frame := Frame{Image: scale(img, b.width), Time: t}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.frames = append(b.frames, frame)
+	cutoff := t.Add(-b.keep)
+	drop := 0
+	for drop < len(b.frames)-1 && b.frames[drop].Time.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		b.frames = append(b.frames[:0:0], b.frames[drop:]...)
+	}
+}
+
+// Frames returns the frames captured between from and to. Frames are never modified once added.
+func (b *Buffer) Frames(from, to time.Time) []Frame {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var frames []Frame
+	for _, f := range b.frames {
+		if !f.Time.Before(from) && !f.Time.After(to) {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+// scale copies img at the given width keeping the aspect ratio. Both sides are rounded
+// down to even numbers, as H.264 with 4:2:0 chroma requires.
+func scale(img *image.RGBA, width int) *image.RGBA {
+	b := img.Bounds()
+	if width <= 0 || width > b.Dx() {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	width, height = width&^1, height&^1
+	if width == 0 || height == 0 {
+		width, height = 2, 2
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
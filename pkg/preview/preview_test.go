@@ -0,0 +1,130 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// solid returns an image filled with one colour
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer(101, 5, 2*time.Second)
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// 25 fps for 4 seconds
+	for i := 0; i < 100; i++ {
+		b.Add(solid(640, 360, color.RGBA{255, 0, 0, 255}), start.Add(time.Duration(i)*40*time.Millisecond))
+	}
+
+	all := b.Frames(start, start.Add(time.Hour))
+	// 5 fps over the last 2 seconds
+	if len(all) < 10 || len(all) > 11 {
+		t.Fatalf("kept %d frames", len(all))
+	}
+	if got := all[0].Image.Bounds().Size(); got != image.Pt(100, 56) {
+		t.Errorf("scaled to %v, want even sides keeping the aspect ratio", got)
+	}
+	for i := 1; i < len(all); i++ {
+		if d := all[i].Time.Sub(all[i-1].Time); d < 200*time.Millisecond {
+			t.Errorf("frames %s apart", d)
+		}
+	}
+
+	last := all[len(all)-1].Time
+	if got := b.Frames(last.Add(-time.Second), last); len(got) != 5 && len(got) != 6 {
+		t.Errorf("got %d frames in the last second", len(got))
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	red, blue := color.RGBA{250, 10, 10, 255}, color.RGBA{10, 10, 250, 255}
+	img := solid(10, 10, red)
+	for y := 5; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetRGBA(x, y, blue)
+		}
+	}
+
+	palette := MedianCut([]*image.RGBA{img}, 16)
+	// Two colours cannot be split further than into two boxes
+	if len(palette) != 2 {
+		t.Fatalf("got %d colours", len(palette))
+	}
+	for _, want := range []color.RGBA{red, blue} {
+		if palette[palette.Index(want)] != want {
+			t.Errorf("palette %v lacks %v", palette, want)
+		}
+	}
+
+	// A gradient uses the whole palette
+	gradient := image.NewRGBA(image.Rect(0, 0, 256, 4))
+	for x := 0; x < 256; x++ {
+		for y := 0; y < 4; y++ {
+			gradient.SetRGBA(x, y, color.RGBA{uint8(x), uint8(255 - x), 128, 255})
+		}
+	}
+	if got := len(MedianCut([]*image.RGBA{gradient}, 64)); got != 64 {
+		t.Errorf("got %d colours, want 64", got)
+	}
+}
+
+func TestEncodeGIF(t *testing.T) {
+	start := time.Now()
+	frames := []Frame{
+		{Image: solid(16, 8, color.RGBA{255, 0, 0, 255}), Time: start},
+		{Image: solid(16, 8, color.RGBA{0, 255, 0, 255}), Time: start.Add(200 * time.Millisecond)},
+		{Image: solid(16, 8, color.RGBA{0, 0, 255, 255}), Time: start.Add(500 * time.Millisecond)},
+	}
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, frames); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || anim.Config.Width != 16 || anim.Config.Height != 8 {
+		t.Fatalf("got %d frames of %dx%d", len(anim.Image), anim.Config.Width, anim.Config.Height)
+	}
+	if want := []int{20, 30, 30}; anim.Delay[0] != want[0] || anim.Delay[1] != want[1] || anim.Delay[2] != want[2] {
+		t.Errorf("delays %v, want %v", anim.Delay, want)
+	}
+	r, g, b, _ := anim.Image[1].At(3, 3).RGBA()
+	if r>>8 != 0 || g>>8 != 255 || b>>8 != 0 {
+		t.Errorf("second frame is %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+
+	if err := EncodeGIF(&buf, nil); err == nil {
+		t.Error("encoded no frames")
+	}
+}
+
+func TestEncodeMP4(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	start := time.Now()
+	var frames []Frame
+	for i := 0; i < 10; i++ {
+		frames = append(frames, Frame{Image: solid(64, 36, color.RGBA{uint8(i * 25), 0, 0, 255}), Time: start.Add(time.Duration(i) * 200 * time.Millisecond)})
+	}
+	data, err := Render(context.Background(), FormatMP4, frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		t.Errorf("not an MP4 file: % x", data[:min(len(data), 12)])
+	}
+}
@@ -0,0 +1,362 @@
+// Package promMetrics exposes metrics in the Prometheus text format without
+// depending on the Prometheus client library. Counters and histograms updated by
+// the application live in vectors; values that already exist elsewhere are written
+// by collector functions when the endpoint is scraped.
+package promMetrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to HTTP request latencies
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector writes metric families when the registry is scraped
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// CollectorFunc adapts a function to a Collector
+type CollectorFunc func(w *Writer)
+
+// Collect calls f(w)
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+// Registry holds the collectors exposed on one endpoint
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds collectors. They are written in the order they were registered.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// WriteTo writes all metrics in the text format
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	w := &Writer{}
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+	return w.buf.WriteTo(out)
+}
+
+// ServeHTTP serves the metrics endpoint
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// Writer formats metric families. All samples of a family must follow its Family call.
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Family starts a metric family with its type and help text
+func (w *Writer) Family(name, typ, help string) {
+	w.buf.WriteString("# HELP ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(escapeHelp(help))
+	w.buf.WriteString("\n# TYPE ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(typ)
+	w.buf.WriteByte('\n')
+}
+
+// Sample writes one sample. labels are name and value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) >= 2 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i])
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(escapeLabel(labels[i+1]))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(formatValue(value))
+	w.buf.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// formatValue formats a sample value, spelling infinities and NaN the Prometheus way
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// pairs zips label names and values into the pairs taken by Writer.Sample
+func pairs(names, values []string) []string {
+	labels := make([]string, 0, 2*len(names)+2)
+	for i, name := range names {
+		labels = append(labels, name, values[i])
+	}
+	return labels
+}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// sortedKeys returns the keys of a vector's values in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Vec is a counter or gauge family keyed by label values
+type Vec struct {
+	name   string
+	typ    string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*vecValue
+}
+
+type vecValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec creates a counter family with the given label names
+func NewCounterVec(name, help string, labels ...string) *Vec {
+	return &Vec{name: name, typ: Counter, help: help, labels: labels, values: make(map[string]*vecValue)}
+}
+
+// NewGaugeVec creates a gauge family with the given label names
+func NewGaugeVec(name, help string, labels ...string) *Vec {
+	return &Vec{name: name, typ: Gauge, help: help, labels: labels, values: make(map[string]*vecValue)}
+}
+
+// value returns the entry for the label values, creating it on first use. The caller holds v.mu.
+func (v *Vec) value(labelValues []string) *vecValue {
+	if len(labelValues) != len(v.labels) {
+		panic("promMetrics: " + v.name + ": wrong number of label values")
+	}
+	key := labelKey(labelValues)
+	val, ok := v.values[key]
+	if !ok {
+		val = &vecValue{labels: append([]string(nil), labelValues...)}
+		v.values[key] = val
+	}
+	return val
+}
+
+// Add adds delta to the value with the given label values
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value(labelValues).value += delta
+}
+
+// Inc adds one to the value with the given label values
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Set sets the value with the given label values
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value(labelValues).value = value
+}
+
+// Delete removes the value with the given label values
+func (v *Vec) Delete(labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.values, labelKey(labelValues))
+}
+
+// Collect writes the family
+func (v *Vec) Collect(w *Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	w.Family(v.name, v.typ, v.help)
+	for _, key := range sortedKeys(v.values) {
+		val := v.values[key]
+		w.Sample(v.name, val.value, pairs(v.labels, val.labels)...)
+	}
+}
+
+// HistogramVec is a histogram family keyed by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // Observations per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec creates a histogram family. nil buckets uses DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+}
+
+// Observe records a value
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic("promMetrics: " + h.name + ": wrong number of label values")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labelKey(labelValues)
+	val, ok := h.values[key]
+	if !ok {
+		val = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = val
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		val.counts[i]++
+	}
+	val.sum += value
+	val.count++
+}
+
+// Collect writes the family with cumulative buckets
+func (h *HistogramVec) Collect(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Family(h.name, Histogram, h.help)
+	for _, key := range sortedKeys(h.values) {
+		val := h.values[key]
+		labels := pairs(h.labels, val.labels)
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += val.counts[i]
+			w.Sample(h.name+"_bucket", float64(cumulative), append(labels, "le", formatValue(upper))...)
+		}
+		w.Sample(h.name+"_bucket", float64(val.count), append(labels, "le", "+Inf")...)
+		w.Sample(h.name+"_sum", val.sum, labels...)
+		w.Sample(h.name+"_count", float64(val.count), labels...)
+	}
+}
+
+// statusWriter captures the status code written by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// InstrumentHandler records how long each request to next takes in duration, which must
+// have the labels handler, method and code. handler is the route name, not the request
+// path, so the number of series stays bounded.
+func InstrumentHandler(next http.Handler, duration *HistogramVec, handler string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			duration.Observe(time.Since(start).Seconds(), handler, r.Method, strconv.Itoa(status))
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
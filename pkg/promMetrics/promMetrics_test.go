@@ -0,0 +1,86 @@
+package promMetrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func collect(c Collector) string {
+	r := NewRegistry()
+	r.Register(c)
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	return buf.String()
+}
+
+func TestWriterSample(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  float64
+		labels []string
+		want   string
+	}{
+		{name: "up", value: 1, want: "up 1\n"},
+		{name: "fps", value: 12.5, labels: []string{"camera", "front"}, want: `fps{camera="front"} 12.5` + "\n"},
+		{name: "x", value: math.Inf(1), labels: []string{"a", "1", "b", "2"}, want: `x{a="1",b="2"} +Inf` + "\n"},
+		{name: "x", value: 0, labels: []string{"path", "a\\b\"c\nd"}, want: `x{path="a\\b\"c\nd"} 0` + "\n"},
+	}
+
+	for _, test := range tests {
+		w := &Writer{}
+		w.Sample(test.name, test.value, test.labels...)
+		if got := w.buf.String(); got != test.want {
+			t.Errorf("Sample(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestVec(t *testing.T) {
+	v := NewCounterVec("restarts_total", "Restarts.", "camera")
+	v.Inc("b")
+	v.Add(2, "a")
+	v.Inc("a")
+
+	want := "# HELP restarts_total Restarts.\n" +
+		"# TYPE restarts_total counter\n" +
+		`restarts_total{camera="a"} 3` + "\n" +
+		`restarts_total{camera="b"} 1` + "\n"
+	if got := collect(v); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		h.Observe(v, "/api")
+	}
+
+	want := "# HELP latency_seconds Latency.\n" +
+		"# TYPE latency_seconds histogram\n" +
+		`latency_seconds_bucket{route="/api",le="0.1"} 2` + "\n" +
+		`latency_seconds_bucket{route="/api",le="1"} 3` + "\n" +
+		`latency_seconds_bucket{route="/api",le="+Inf"} 4` + "\n" +
+		`latency_seconds_sum{route="/api"} 3.65` + "\n" +
+		`latency_seconds_count{route="/api"} 4` + "\n"
+	if got := collect(h); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	h := NewHistogramVec("http_request_duration_seconds", "Requests.", nil, "handler", "method", "code")
+	handler := InstrumentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}), h, "/api/cameras/")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/cameras/x", nil))
+	got := collect(h)
+	if !strings.Contains(got, `http_request_duration_seconds_count{handler="/api/cameras/",method="GET",code="404"} 1`) {
+		t.Errorf("request not recorded:\n%s", got)
+	}
+}
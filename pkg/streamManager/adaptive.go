@@ -0,0 +1,274 @@
+package streamManager
+
+import (
+	"bufio"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Adaptive frame rate defaults
+const (
+	defaultAdaptiveInterval = 2    // Seconds between adjustments
+	defaultHighCPU          = 85.0 // Host CPU percent above which frame rates are lowered
+	defaultLowCPU           = 60.0 // Host CPU percent below which frame rates are raised
+	defaultMaxLatencyMs     = 200  // Frame processing latency above which frame rates are lowered
+	defaultMinFPS           = 1.0  // Lowest frame rate a camera is throttled to
+	adaptiveStep            = 0.1  // Fraction of the min-max range changed per adjustment
+)
+
+// AdaptiveConfig configures load-based frame rate adaptation
+type AdaptiveConfig struct {
+	Enabled      bool    `json:"enabled"`
+	Interval     int     `json:"interval,omitempty"`     // Seconds between adjustments, default 2
+	HighCPU      float64 `json:"highCpu,omitempty"`      // Lower frame rates above this CPU percent, default 85
+	LowCPU       float64 `json:"lowCpu,omitempty"`       // Raise frame rates below this CPU percent, default 60
+	MaxLatencyMs int     `json:"maxLatencyMs,omitempty"` // Lower frame rates above this processing latency, default 200
+}
+
+// frameRate tracks the input rate, processing latency and frame rate cap of a stream.
+// Fields are protected by the owning StreamInfo's mu.
+type frameRate struct {
+	targetFPS    float64   // Current cap, 0 means unlimited
+	lastAccepted time.Time // Time of the last frame let through
+	lastInput    time.Time // Time of the last frame received
+	inputFPS     float64   // Smoothed rate of frames received
+	latency      float64   // Smoothed frame processing time in seconds
+}
+
+// allowFrame records an incoming frame and reports whether it fits the frame rate cap
+func (si *StreamInfo) allowFrame() bool {
+	return si.allowFrameAt(time.Now())
+}
+
+// allowFrameAt is allowFrame for a frame received at now
+func (si *StreamInfo) allowFrameAt(now time.Time) bool {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	r := &si.rate
+	if !r.lastInput.IsZero() {
+		if dt := now.Sub(r.lastInput).Seconds(); dt > 0 {
+			r.inputFPS = smooth(r.inputFPS, 1/dt)
+		}
+	}
+	r.lastInput = now
+
+	// Allow a little jitter so a cap equal to the input rate does not drop frames
+	if r.targetFPS > 0 && now.Sub(r.lastAccepted).Seconds() < 0.9/r.targetFPS {
+		si.metrics.throttled.Add(1)
+		return false
+	}
+	r.lastAccepted = now
+	return true
+}
+
+// recordLatency records how long a frame took from decode to encoded output
+func (si *StreamInfo) recordLatency(d time.Duration) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.rate.latency = smooth(si.rate.latency, d.Seconds())
+}
+
+// effective returns the frame rate a stream is running at: the cap, or the input rate when lower
+func (r *frameRate) effective() float64 {
+	if r.targetFPS > 0 && (r.inputFPS == 0 || r.targetFPS < r.inputFPS) {
+		return r.targetFPS
+	}
+	return r.inputFPS
+}
+
+// smooth returns an exponentially weighted moving average
+func smooth(avg, sample float64) float64 {
+	if avg == 0 {
+		return sample
+	}
+	return 0.8*avg + 0.2*sample
+}
+
+// fpsRange returns the min and max frame rate of a camera given its measured input rate
+func (c *Camera) fpsRange(inputFPS float64) (float64, float64) {
+	minFPS := c.MinFPS
+	if minFPS <= 0 {
+		minFPS = defaultMinFPS
+	}
+	maxFPS := c.MaxFPS
+	if maxFPS <= 0 {
+		maxFPS = inputFPS
+	}
+	if maxFPS < minFPS {
+		maxFPS = minFPS
+	}
+	return minFPS, maxFPS
+}
+
+// cpuSampler computes host CPU usage from /proc/stat
+type cpuSampler struct {
+	idle, total uint64
+}
+
+// sample returns the CPU usage percent since the previous call, or -1 if unavailable
+func (c *cpuSampler) sample() float64 {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return -1
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return -1
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return -1
+	}
+
+	var idle, total uint64
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return -1
+		}
+		total += v
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += v
+		}
+	}
+
+	prevIdle, prevTotal := c.idle, c.total
+	c.idle, c.total = idle, total
+	if prevTotal == 0 || total <= prevTotal {
+		return -1
+	}
+	return 100 * (1 - float64(idle-prevIdle)/float64(total-prevTotal))
+}
+
+// adaptiveLevels tracks the fraction of each camera's min-max frame rate range in use,
+// separately for priority and background cameras
+type adaptiveLevels struct {
+	highCPU, lowCPU float64
+	maxLatency      float64 // Seconds
+	priority        float64
+	background      float64
+}
+
+// newAdaptiveLevels returns levels at full frame rate with defaults filled in
+func newAdaptiveLevels(cfg AdaptiveConfig) *adaptiveLevels {
+	a := &adaptiveLevels{
+		highCPU:    cfg.HighCPU,
+		lowCPU:     cfg.LowCPU,
+		maxLatency: (time.Duration(cfg.MaxLatencyMs) * time.Millisecond).Seconds(),
+		priority:   1,
+		background: 1,
+	}
+	if a.highCPU <= 0 {
+		a.highCPU = defaultHighCPU
+	}
+	if a.lowCPU <= 0 {
+		a.lowCPU = defaultLowCPU
+	}
+	if a.maxLatency <= 0 {
+		a.maxLatency = (defaultMaxLatencyMs * time.Millisecond).Seconds()
+	}
+	return a
+}
+
+// update moves the levels one step for a CPU usage sample (-1 if unknown) and the worst
+// processing latency in seconds. Background cameras are lowered first and raised last.
+// It reports whether a level changed.
+func (a *adaptiveLevels) update(usage, worstLatency float64) bool {
+	overloaded := usage > a.highCPU || worstLatency > a.maxLatency
+	underloaded := (usage < 0 || usage < a.lowCPU) && worstLatency < a.maxLatency/2
+
+	prevPriority, prevBackground := a.priority, a.background
+	switch {
+	case overloaded && a.background > 0:
+		a.background = stepLevel(a.background, -adaptiveStep)
+	case overloaded:
+		a.priority = stepLevel(a.priority, -adaptiveStep)
+	case underloaded && a.priority < 1:
+		a.priority = stepLevel(a.priority, adaptiveStep)
+	case underloaded:
+		a.background = stepLevel(a.background, adaptiveStep)
+	}
+	return a.priority != prevPriority || a.background != prevBackground
+}
+
+// stepLevel moves a level by delta within 0..1, rounded to whole steps so repeated steps
+// land exactly on 0 and 1
+func stepLevel(level, delta float64) float64 {
+	level = math.Round((level+delta)/adaptiveStep) * adaptiveStep
+	return min(1, max(0, level))
+}
+
+// runAdaptiveFPS periodically raises or lowers camera frame rates based on host load.
+// Cameras with viewers, attached virtual cameras or motion are throttled last and restored first.
+func (sm *StreamManager) runAdaptiveFPS(cfg AdaptiveConfig) {
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultAdaptiveInterval * time.Second
+	}
+
+	levels := newAdaptiveLevels(cfg)
+	var cpu cpuSampler
+	cpu.sample()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		usage := cpu.sample()
+		worstLatency := sm.worstLatency()
+		if levels.update(usage, worstLatency) {
+			log.Printf("Adaptive FPS: cpu %.0f%%, latency %.0fms, priority level %.1f, background level %.1f",
+				usage, worstLatency*1000, levels.priority, levels.background)
+		}
+
+		sm.applyFPSLevels(levels.priority, levels.background)
+	}
+}
+
+// worstLatency returns the highest smoothed frame processing latency of all streams in seconds
+func (sm *StreamManager) worstLatency() float64 {
+	var worst float64
+	sm.streams.Range(func(_, value any) bool {
+		info := value.(*StreamInfo)
+		info.mu.Lock()
+		if info.rate.latency > worst {
+			worst = info.rate.latency
+		}
+		info.mu.Unlock()
+		return true
+	})
+	return worst
+}
+
+// applyFPSLevels sets each running camera's frame rate cap from its priority level
+func (sm *StreamManager) applyFPSLevels(priorityLevel, backgroundLevel float64) {
+	for _, camera := range sm.GetAllCameras() {
+		streamInfo, err := sm.GetStreamInfo(camera.ID)
+		if err != nil {
+			continue
+		}
+
+		streamInfo.mu.Lock()
+		level := backgroundLevel
+		if streamInfo.ViewerCount > 0 || len(streamInfo.subscribers) > 0 || streamInfo.motion.active {
+			level = priorityLevel
+		}
+
+		minFPS, maxFPS := camera.fpsRange(streamInfo.rate.inputFPS)
+		target := minFPS + (maxFPS-minFPS)*level
+		if level >= 1 && camera.MaxFPS <= 0 {
+			// No configured cap and no pressure, let every frame through
+			target = 0
+		}
+		streamInfo.rate.targetFPS = target
+		streamInfo.mu.Unlock()
+	}
+}
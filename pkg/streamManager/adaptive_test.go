@@ -0,0 +1,120 @@
+package streamManager
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAllowFrameAt(t *testing.T) {
+	tests := []struct {
+		name      string
+		targetFPS float64
+		accepted  int
+	}{
+		{name: "unlimited", targetFPS: 0, accepted: 25},
+		{name: "capped below the input rate", targetFPS: 5, accepted: 5},
+		{name: "cap equal to the input rate", targetFPS: 25, accepted: 25},
+	}
+
+	for _, test := range tests {
+		info := &StreamInfo{}
+		info.rate.targetFPS = test.targetFPS
+
+		// One second of a 25 fps camera
+		start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+		accepted := 0
+		for i := 0; i < 25; i++ {
+			if info.allowFrameAt(start.Add(time.Duration(i) * 40 * time.Millisecond)) {
+				accepted++
+			}
+		}
+
+		if accepted != test.accepted {
+			t.Errorf("%s: accepted %d frames, want %d", test.name, accepted, test.accepted)
+		}
+		if got := info.metrics.throttled.Load(); got != uint64(25-test.accepted) {
+			t.Errorf("%s: %d frames throttled, want %d", test.name, got, 25-test.accepted)
+		}
+		if math.Abs(info.rate.inputFPS-25) > 0.01 {
+			t.Errorf("%s: input rate %.2f, want 25", test.name, info.rate.inputFPS)
+		}
+	}
+}
+
+func TestAdaptiveLevels(t *testing.T) {
+	levels := newAdaptiveLevels(AdaptiveConfig{Enabled: true})
+	at := func(priority, background float64) bool {
+		return math.Abs(levels.priority-priority) < 1e-9 && math.Abs(levels.background-background) < 1e-9
+	}
+
+	// Under load background cameras step down to their minimum before priority cameras slow down
+	for i := 0; i < 10; i++ {
+		if !levels.update(95, 0.01) {
+			t.Fatalf("step %d: high CPU did not lower a level", i)
+		}
+	}
+	if !at(1, 0) {
+		t.Fatalf("after 10 overloaded samples levels are %.1f/%.1f, want 1/0", levels.priority, levels.background)
+	}
+	levels.update(50, 0.5) // Slow frame processing counts as overload too
+	levels.update(95, 0.01)
+	if !at(0.8, 0) {
+		t.Fatalf("priority level %.1f, want 0.8", levels.priority)
+	}
+
+	// Between the thresholds nothing changes
+	if levels.update(70, 0.01) || levels.update(40, 0.15) {
+		t.Error("levels changed without being over or under loaded")
+	}
+
+	// Once the load drops priority cameras recover first
+	levels.update(40, 0.01)
+	levels.update(-1, 0.01) // CPU usage unknown, latency alone decides
+	if !at(1, 0) {
+		t.Fatalf("after recovering levels are %.1f/%.1f, want 1/0", levels.priority, levels.background)
+	}
+	for i := 0; i < 10; i++ {
+		levels.update(40, 0.01)
+	}
+	if !at(1, 1) {
+		t.Fatalf("after recovering levels are %.1f/%.1f, want 1/1", levels.priority, levels.background)
+	}
+	if levels.update(40, 0.01) {
+		t.Error("levels went above full frame rate")
+	}
+}
+
+func TestApplyFPSLevels(t *testing.T) {
+	sm := &StreamManager{config: &Config{Cameras: []Camera{
+		{ID: "watched", MinFPS: 2, MaxFPS: 20},
+		{ID: "idle", MinFPS: 2, MaxFPS: 20},
+		{ID: "uncapped"},
+	}}}
+	streams := make(map[string]*StreamInfo)
+	for _, camera := range sm.config.Cameras {
+		info := &StreamInfo{}
+		info.rate.inputFPS = 25
+		streams[camera.ID] = info
+		sm.streams.Store(camera.ID, info)
+	}
+	streams["watched"].ViewerCount = 1
+
+	tests := []struct {
+		priority, background float64
+		want                 map[string]float64
+	}{
+		{priority: 1, background: 1, want: map[string]float64{"watched": 20, "idle": 20, "uncapped": 0}},
+		{priority: 1, background: 0.5, want: map[string]float64{"watched": 20, "idle": 11, "uncapped": 13}},
+		{priority: 0.5, background: 0, want: map[string]float64{"watched": 11, "idle": 2, "uncapped": 1}},
+	}
+
+	for _, test := range tests {
+		sm.applyFPSLevels(test.priority, test.background)
+		for id, want := range test.want {
+			if got := streams[id].rate.targetFPS; math.Abs(got-want) > 1e-9 {
+				t.Errorf("levels %.1f/%.1f: camera %s capped at %.1f fps, want %.1f", test.priority, test.background, id, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package streamManager
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Decoder backend names used in the camera and global backend preferences
+const (
+	BackendCPU     = "cpu"     // Software decoding
+	BackendCUDA    = "cuda"    // NVIDIA NVDEC
+	BackendVAAPI   = "vaapi"   // Intel and AMD VA-API
+	BackendQSV     = "qsv"     // Intel Quick Sync Video
+	BackendV4L2M2M = "v4l2m2m" // V4L2 memory-to-memory decoders found on ARM boards
+)
+
+// defaultBackendOrder is tried when neither the camera nor the config sets a preference
+var defaultBackendOrder = []string{BackendCUDA, BackendQSV, BackendVAAPI, BackendV4L2M2M, BackendCPU}
+
+// DecoderBackend describes how ffmpeg decodes a camera feed
+type DecoderBackend interface {
+	Name() string
+	Hardware() bool                   // Hardware backends use a GPU session
+	Available(caps Capabilities) bool // Whether the local ffmpeg build supports the backend
+	InputArgs(device string) []string // Options placed before -i, device may be empty
+	Filter(decimate string) string    // Filter chain producing software frames, decimate may be empty
+	IsError(message string) bool      // Whether an ffmpeg error was caused by the backend
+}
+
+// Capabilities lists what the local ffmpeg build supports
+type Capabilities struct {
+	HWAccels map[string]bool // From ffmpeg -hwaccels
+	Decoders map[string]bool // From ffmpeg -decoders
+}
+
+// Prober discovers the capabilities of the local ffmpeg build
+type Prober interface {
+	Probe() (Capabilities, error)
+}
+
+// ffmpegProber asks the ffmpeg binary for its hardware accelerators and decoders
+type ffmpegProber struct{}
+
+// Probe runs ffmpeg -hwaccels and ffmpeg -decoders
+func (ffmpegProber) Probe() (Capabilities, error) {
+	hwaccels, err := exec.Command("ffmpeg", "-hide_banner", "-hwaccels").CombinedOutput()
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to list ffmpeg hardware accelerators: %w", err)
+	}
+	decoders, err := exec.Command("ffmpeg", "-hide_banner", "-decoders").CombinedOutput()
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("failed to list ffmpeg decoders: %w", err)
+	}
+	return Capabilities{
+		HWAccels: parseHWAccels(string(hwaccels)),
+		Decoders: parseDecoders(string(decoders)),
+	}, nil
+}
+
+// parseHWAccels parses the output of ffmpeg -hwaccels
+func parseHWAccels(output string) map[string]bool {
+	accels := make(map[string]bool)
+	listing := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Hardware acceleration methods") {
+			listing = true
+			continue
+		}
+		if listing && line != "" {
+			accels[line] = true
+		}
+	}
+	return accels
+}
+
+// parseDecoders parses the output of ffmpeg -decoders.
+// Entries look like " V....D h264_v4l2m2m   V4L2 mem2mem H.264 decoder wrapper".
+func parseDecoders(output string) map[string]bool {
+	decoders := make(map[string]bool)
+	listing := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// The legend ends with a " ------" separator line
+		if len(fields) == 1 && strings.HasPrefix(fields[0], "---") {
+			listing = true
+			continue
+		}
+		if listing && len(fields) >= 2 && len(fields[0]) == 6 {
+			decoders[fields[1]] = true
+		}
+	}
+	return decoders
+}
+
+// joinFilters chains filter expressions, skipping empty ones
+func joinFilters(filters ...string) string {
+	var parts []string
+	for _, f := range filters {
+		if f != "" {
+			parts = append(parts, f)
+		}
+	}
+	if len(parts) == 0 {
+		return "null"
+	}
+	return strings.Join(parts, ",")
+}
+
+// hwaccelArgs selects an ffmpeg hwaccel that keeps frames on the device
+func hwaccelArgs(hwaccel, device string) []string {
+	args := []string{"-hwaccel", hwaccel, "-hwaccel_output_format", hwaccel}
+	if device != "" {
+		args = append(args, "-hwaccel_device", device)
+	}
+	return args
+}
+
+// containsAny reports whether s contains any of the patterns
+func containsAny(s string, patterns []string) bool {
+	for _, p := range patterns {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// cpuBackend decodes in software and is always available
+type cpuBackend struct{}
+
+func (cpuBackend) Name() string                     { return BackendCPU }
+func (cpuBackend) Hardware() bool                   { return false }
+func (cpuBackend) Available(caps Capabilities) bool { return true }
+func (cpuBackend) InputArgs(device string) []string { return nil }
+func (cpuBackend) Filter(decimate string) string    { return joinFilters(decimate) }
+func (cpuBackend) IsError(message string) bool      { return false }
+
+// cudaBackend decodes on NVIDIA GPUs with NVDEC
+type cudaBackend struct{}
+
+func (cudaBackend) Name() string   { return BackendCUDA }
+func (cudaBackend) Hardware() bool { return true }
+func (cudaBackend) Available(caps Capabilities) bool {
+	return caps.HWAccels["cuda"]
+}
+func (cudaBackend) InputArgs(device string) []string {
+	return hwaccelArgs("cuda", device)
+}
+func (cudaBackend) Filter(decimate string) string {
+	return joinFilters("scale_cuda=format=yuv420p", "hwdownload", "format=yuv420p", decimate)
+}
+func (cudaBackend) IsError(message string) bool { return isGPUError(message) }
+
+// vaapiBackend decodes on Intel and AMD GPUs through VA-API
+type vaapiBackend struct{}
+
+func (vaapiBackend) Name() string   { return BackendVAAPI }
+func (vaapiBackend) Hardware() bool { return true }
+func (vaapiBackend) Available(caps Capabilities) bool {
+	return caps.HWAccels["vaapi"]
+}
+func (vaapiBackend) InputArgs(device string) []string {
+	return hwaccelArgs("vaapi", device)
+}
+func (vaapiBackend) Filter(decimate string) string {
+	return joinFilters("scale_vaapi=format=nv12", "hwdownload", "format=nv12", decimate)
+}
+func (vaapiBackend) IsError(message string) bool {
+	return containsAny(message, []string{
+		"Failed to initialise VAAPI",
+		"Failed to create a VAAPI device",
+		"No VA display found",
+		"vaInitialize failed",
+		"hwaccel initialisation returned error",
+		"Impossible to convert between the formats",
+	})
+}
+
+// qsvBackend decodes on Intel GPUs with Quick Sync Video
+type qsvBackend struct{}
+
+func (qsvBackend) Name() string   { return BackendQSV }
+func (qsvBackend) Hardware() bool { return true }
+func (qsvBackend) Available(caps Capabilities) bool {
+	return caps.HWAccels["qsv"]
+}
+func (qsvBackend) InputArgs(device string) []string {
+	return hwaccelArgs("qsv", device)
+}
+func (qsvBackend) Filter(decimate string) string {
+	return joinFilters("vpp_qsv=format=nv12", "hwdownload", "format=nv12", decimate)
+}
+func (qsvBackend) IsError(message string) bool {
+	return containsAny(message, []string{
+		"Error initializing an internal MFX session",
+		"Error creating a MFX session",
+		"Error initializing the MFX video decoder",
+		"Failed to create a QSV device",
+		"hwaccel initialisation returned error",
+		"Impossible to convert between the formats",
+	})
+}
+
+// v4l2m2mBackend decodes H.264 with a V4L2 memory-to-memory decoder such as on Raspberry Pi
+type v4l2m2mBackend struct{}
+
+func (v4l2m2mBackend) Name() string   { return BackendV4L2M2M }
+func (v4l2m2mBackend) Hardware() bool { return true }
+func (v4l2m2mBackend) Available(caps Capabilities) bool {
+	return caps.Decoders["h264_v4l2m2m"]
+}
+func (v4l2m2mBackend) InputArgs(device string) []string {
+	// The decoder finds its own /dev/video node
+	return []string{"-c:v", "h264_v4l2m2m"}
+}
+func (v4l2m2mBackend) Filter(decimate string) string { return joinFilters(decimate) }
+func (v4l2m2mBackend) IsError(message string) bool {
+	return containsAny(message, []string{
+		"Could not find a valid device",
+		"can't configure decoder",
+		"VIDIOC_",
+	})
+}
+
+// allBackends lists every known backend
+var allBackends = []DecoderBackend{cpuBackend{}, cudaBackend{}, vaapiBackend{}, qsvBackend{}, v4l2m2mBackend{}}
+
+// backendSelector chooses a decoder backend per camera from the probed capabilities
+type backendSelector struct {
+	backends   map[string]DecoderBackend
+	caps       Capabilities
+	hardware   bool     // Whether hardware backends may be used at all
+	preference []string // Order used when a camera sets none
+}
+
+// newBackendSelector probes ffmpeg once and builds a selector.
+// A failed probe leaves only the CPU backend.
+func newBackendSelector(prober Prober, hardware bool, preference []string) *backendSelector {
+	bs := &backendSelector{
+		backends:   make(map[string]DecoderBackend),
+		hardware:   hardware,
+		preference: preference,
+	}
+	for _, b := range allBackends {
+		bs.backends[b.Name()] = b
+	}
+	if len(bs.preference) == 0 {
+		bs.preference = defaultBackendOrder
+	}
+
+	if hardware {
+		caps, err := prober.Probe()
+		if err != nil {
+			log.Printf("⚠ Decoder capability probe failed, using CPU decoding: %v", err)
+		}
+		bs.caps = caps
+	}
+	return bs
+}
+
+// available returns the names of the usable backends in default preference order
+func (bs *backendSelector) available() []string {
+	var names []string
+	for _, name := range defaultBackendOrder {
+		if b := bs.backends[name]; bs.usable(b) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// usable reports whether a backend may be selected on this host
+func (bs *backendSelector) usable(b DecoderBackend) bool {
+	if b == nil {
+		return false
+	}
+	if b.Hardware() && !bs.hardware {
+		return false
+	}
+	return b.Available(bs.caps)
+}
+
+// selectFor returns the first usable backend from the camera preference, or the
+// global preference when the camera has none, skipping backends that failed.
+// The CPU backend is the last resort.
+func (bs *backendSelector) selectFor(preference []string, failed map[string]bool) DecoderBackend {
+	if len(preference) == 0 {
+		preference = bs.preference
+	}
+	for _, name := range preference {
+		b := bs.backends[name]
+		if failed[name] || !bs.usable(b) {
+			continue
+		}
+		return b
+	}
+	return bs.backends[BackendCPU]
+}
+
+// validateBackends rejects unknown backend names
+func validateBackends(names []string) error {
+	for _, name := range names {
+		if _, ok := backendByName(name); !ok {
+			return fmt.Errorf("unknown decoder backend %q", name)
+		}
+	}
+	return nil
+}
+
+// backendByName looks up a known backend
+func backendByName(name string) (DecoderBackend, bool) {
+	for _, b := range allBackends {
+		if b.Name() == name {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// backendState tracks the backend and GPU device a camera decodes with and the ones that failed for it
+type backendState struct {
+	mu      sync.Mutex
+	current DecoderBackend
+	device  *gpuDevice      // nil when decoding on the CPU
+	failed  map[string]bool // Backends that failed on every device
+	avoid   map[string]bool // GPU devices that failed for this camera
+	errors  int             // Consecutive errors of the current backend and device
+}
+
+// set records the backend and device of a new decoder run
+func (bs *backendState) set(b DecoderBackend, device *gpuDevice) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.current == nil || bs.current.Name() != b.Name() || bs.device != device {
+		bs.errors = 0
+	}
+	bs.current = b
+	bs.device = device
+}
+
+// currentDevice returns the GPU device of the running decoder
+func (bs *backendState) currentDevice() *gpuDevice {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.device
+}
+
+// failedSet returns a copy of the failed backends
+func (bs *backendState) failedSet() map[string]bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return copySet(bs.failed)
+}
+
+// avoidSet returns a copy of the GPU devices that failed for this camera
+func (bs *backendState) avoidSet() map[string]bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return copySet(bs.avoid)
+}
+
+// copySet copies a string set
+func copySet(set map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(set))
+	for k := range set {
+		c[k] = true
+	}
+	return c
+}
+
+// backendFailure describes what a camera stopped using after repeated backend errors
+type backendFailure struct {
+	device  string // GPU device the camera no longer uses
+	backend string // Backend the camera no longer uses, set once no device is left for it
+}
+
+// recordError counts a backend error. After limit consecutive errors the camera stops using
+// the current device, and the backend itself once none of its devices are left.
+// devicesFor lists the GPU devices that can run a backend.
+func (bs *backendState) recordError(message string, limit int, devicesFor func(backend string) []string) (backendFailure, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.current == nil || !bs.current.Hardware() || !bs.current.IsError(message) {
+		bs.errors = 0
+		return backendFailure{}, false
+	}
+	bs.errors++
+	if bs.errors < limit {
+		return backendFailure{}, true
+	}
+	bs.errors = 0
+
+	var failure backendFailure
+	if bs.device != nil {
+		if bs.avoid == nil {
+			bs.avoid = make(map[string]bool)
+		}
+		bs.avoid[bs.device.Device] = true
+		failure.device = bs.device.name()
+	}
+	for _, d := range devicesFor(bs.current.Name()) {
+		if !bs.avoid[d] {
+			return failure, true
+		}
+	}
+
+	if bs.failed == nil {
+		bs.failed = make(map[string]bool)
+	}
+	bs.failed[bs.current.Name()] = true
+	failure.backend = bs.current.Name()
+	return failure, true
+}
+
+// resetErrors clears the consecutive error count after a good frame
+func (bs *backendState) resetErrors() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.errors = 0
+}
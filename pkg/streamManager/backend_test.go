@@ -0,0 +1,158 @@
+package streamManager
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeProber returns fixed capabilities instead of running ffmpeg
+type fakeProber struct {
+	caps   Capabilities
+	err    error
+	probed int
+}
+
+func (p *fakeProber) Probe() (Capabilities, error) {
+	p.probed++
+	return p.caps, p.err
+}
+
+func TestSelectBackend(t *testing.T) {
+	caps := Capabilities{
+		HWAccels: map[string]bool{"vaapi": true, "qsv": true},
+		Decoders: map[string]bool{"h264": true, "h264_v4l2m2m": true},
+	}
+
+	tests := []struct {
+		name       string
+		hardware   bool
+		global     []string
+		preference []string
+		failed     map[string]bool
+		want       string
+	}{
+		{name: "default order skips missing cuda", hardware: true, want: BackendQSV},
+		{name: "hardware disabled", hardware: false, want: BackendCPU},
+		{name: "camera preference", hardware: true, preference: []string{BackendVAAPI, BackendCPU}, want: BackendVAAPI},
+		{name: "camera preference wins over global", hardware: true, global: []string{BackendQSV}, preference: []string{BackendV4L2M2M}, want: BackendV4L2M2M},
+		{name: "global preference", hardware: true, global: []string{BackendVAAPI, BackendQSV}, want: BackendVAAPI},
+		{name: "unavailable preference falls back to cpu", hardware: true, preference: []string{BackendCUDA}, want: BackendCPU},
+		{name: "failed backend skipped", hardware: true, preference: []string{BackendQSV, BackendVAAPI}, failed: map[string]bool{BackendQSV: true}, want: BackendVAAPI},
+		{name: "all failed", hardware: true, preference: []string{BackendQSV}, failed: map[string]bool{BackendQSV: true}, want: BackendCPU},
+		{name: "cpu preferred", hardware: true, preference: []string{BackendCPU, BackendQSV}, want: BackendCPU},
+	}
+
+	for _, test := range tests {
+		prober := &fakeProber{caps: caps}
+		bs := newBackendSelector(prober, test.hardware, test.global)
+		got := bs.selectFor(test.preference, test.failed)
+		if got.Name() != test.want {
+			t.Errorf("%s: got backend %s, want %s", test.name, got.Name(), test.want)
+		}
+		if test.hardware != (prober.probed == 1) {
+			t.Errorf("%s: probed %d times with hardware=%v", test.name, prober.probed, test.hardware)
+		}
+	}
+}
+
+func TestSelectBackendProbeFailure(t *testing.T) {
+	bs := newBackendSelector(&fakeProber{err: errors.New("ffmpeg not found")}, true, nil)
+	if got := bs.selectFor([]string{BackendCUDA}, nil); got.Name() != BackendCPU {
+		t.Errorf("got backend %s after failed probe, want cpu", got.Name())
+	}
+	if got := bs.available(); len(got) != 1 || got[0] != BackendCPU {
+		t.Errorf("got available backends %v after failed probe, want [cpu]", got)
+	}
+}
+
+func TestBackendFallback(t *testing.T) {
+	devices := map[string][]string{BackendCUDA: {"0", "1"}, BackendVAAPI: {""}}
+	devicesFor := func(backend string) []string { return devices[backend] }
+	gpu0 := &gpuDevice{GPUDevice: GPUDevice{Device: "0"}}
+	gpu1 := &gpuDevice{GPUDevice: GPUDevice{Device: "1"}}
+
+	var state backendState
+	state.set(cudaBackend{}, gpu0)
+	for i := 1; i < 3; i++ {
+		if failure, isErr := state.recordError("Cannot load libnvcuvid.so.1", 3, devicesFor); failure != (backendFailure{}) || !isErr {
+			t.Fatalf("error %d: got %+v isErr=%v, want a backend error without failure", i, failure, isErr)
+		}
+	}
+
+	// The first failing device is avoided while another one is left
+	if failure, _ := state.recordError("Cannot load libnvcuvid.so.1", 3, devicesFor); failure.device != "0" || failure.backend != "" {
+		t.Fatalf("got %+v after 3 errors on device 0, want device 0 avoided", failure)
+	}
+	if !state.avoidSet()["0"] || state.failedSet()[BackendCUDA] {
+		t.Fatalf("got avoid=%v failed=%v, want device 0 avoided and cuda usable", state.avoidSet(), state.failedSet())
+	}
+
+	// Once every device failed the backend is given up
+	state.set(cudaBackend{}, gpu1)
+	var failure backendFailure
+	for i := 0; i < 3; i++ {
+		failure, _ = state.recordError("Cannot load libnvcuvid.so.1", 3, devicesFor)
+	}
+	if failure.device != "1" || failure.backend != BackendCUDA {
+		t.Fatalf("got %+v after 3 errors on device 1, want cuda failed", failure)
+	}
+	if !state.failedSet()[BackendCUDA] {
+		t.Errorf("cuda not recorded as failed")
+	}
+
+	// Unrelated errors never fail a backend
+	state.set(vaapiBackend{}, &gpuDevice{})
+	for i := 0; i < 5; i++ {
+		if failure, isErr := state.recordError("Connection refused", 3, devicesFor); failure != (backendFailure{}) || isErr {
+			t.Fatalf("got %+v isErr=%v for a network error", failure, isErr)
+		}
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	hwaccels := parseHWAccels("Hardware acceleration methods:\nvdpau\ncuda\nvaapi\n\n")
+	for _, name := range []string{"vdpau", "cuda", "vaapi"} {
+		if !hwaccels[name] {
+			t.Errorf("hwaccel %s not parsed", name)
+		}
+	}
+	if hwaccels["Hardware acceleration methods:"] {
+		t.Errorf("header parsed as hwaccel")
+	}
+
+	decoders := parseDecoders(`Decoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D h264                 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10
+ V..... h264_v4l2m2m         V4L2 mem2mem H.264 decoder wrapper (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+`)
+	for _, name := range []string{"h264", "h264_v4l2m2m", "aac"} {
+		if !decoders[name] {
+			t.Errorf("decoder %s not parsed", name)
+		}
+	}
+	if decoders["="] || decoders["Video"] {
+		t.Errorf("legend parsed as decoder")
+	}
+}
+
+func TestBackendFilter(t *testing.T) {
+	tests := []struct {
+		backend  DecoderBackend
+		decimate string
+		want     string
+	}{
+		{cpuBackend{}, "", "null"},
+		{cpuBackend{}, `select=not(mod(n\,10))`, `select=not(mod(n\,10))`},
+		{cudaBackend{}, "", "scale_cuda=format=yuv420p,hwdownload,format=yuv420p"},
+		{vaapiBackend{}, `select=not(mod(n\,5))`, `scale_vaapi=format=nv12,hwdownload,format=nv12,select=not(mod(n\,5))`},
+		{v4l2m2mBackend{}, "", "null"},
+	}
+	for _, test := range tests {
+		if got := test.backend.Filter(test.decimate); got != test.want {
+			t.Errorf("%s filter: got %q, want %q", test.backend.Name(), got, test.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package streamManager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+)
+
+// Camera command actions accepted on {prefix}/cameras/{id}/set
+const (
+	CommandEnable        = "enable"         // Enable the camera and save the config
+	CommandDisable       = "disable"        // Disable the camera and save the config
+	CommandStart         = "start"          // Start the stream
+	CommandStop          = "stop"           // Stop the stream
+	CommandSnapshot      = "snapshot"       // Publish the next frame as JPEG to {prefix}/cameras/{id}/snapshot
+	CommandOverlay       = "overlay"        // Draw elements for ttl seconds
+	CommandClearOverlays = "clear_overlays" // Remove the overlays added by commands
+	CommandArm           = "arm"            // Enable motion detection and save the config
+	CommandDisarm        = "disarm"         // Disable motion detection and save the config
+)
+
+// CameraCommand is the JSON payload of a command topic. A payload that is not JSON is taken as the action.
+type CameraCommand struct {
+	Action   string        `json:"action"`
+	ID       string        `json:"id,omitempty"`       // Returned in the acknowledgement
+	Elements []DrawElement `json:"elements,omitempty"` // Overlay elements
+	TTL      int           `json:"ttl,omitempty"`      // Overlay lifetime in seconds, default 10
+}
+
+// CommandResult acknowledges a command on {prefix}/cameras/{id}/response
+type CommandResult struct {
+	ID       string    `json:"id,omitempty"`
+	CameraID string    `json:"cameraId"`
+	Action   string    `json:"action,omitempty"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// parseCommand reads a command payload
+func parseCommand(payload []byte) (CameraCommand, error) {
+	var cmd CameraCommand
+	payload = bytes.TrimSpace(payload)
+	if len(payload) > 0 && payload[0] == '{' {
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			return cmd, fmt.Errorf("invalid command: %w", err)
+		}
+	} else {
+		cmd.Action = string(payload)
+	}
+	cmd.Action = strings.ToLower(strings.TrimSpace(cmd.Action))
+	if cmd.Action == "" {
+		return cmd, errors.New("action is required")
+	}
+	return cmd, nil
+}
+
+// cameraTopic returns a topic under a camera, {prefix}/cameras/{id}/{name}
+func cameraTopic(prefix, cameraID, name string) string {
+	return prefix + "/cameras/" + cameraID + "/" + name
+}
+
+// commandCamera returns the camera ID of a {prefix}/cameras/{id}/set topic
+func commandCamera(prefix, topic string) (string, bool) {
+	id, ok := strings.CutPrefix(topic, prefix+"/cameras/")
+	if !ok {
+		return "", false
+	}
+	id, ok = strings.CutSuffix(id, "/set")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// ExecuteCommand runs a camera command. Returns the JPEG of a snapshot command.
+func (sm *StreamManager) ExecuteCommand(cameraID string, cmd CameraCommand) ([]byte, error) {
+	if _, err := sm.GetCamera(cameraID); err != nil {
+		return nil, err
+	}
+
+	switch cmd.Action {
+	case CommandEnable, CommandDisable:
+		return nil, sm.modifyCamera(cameraID, func(c *Camera) { c.Enabled = cmd.Action == CommandEnable })
+	case CommandStart:
+		if err := sm.StartStream(cameraID); err != nil {
+			return nil, err
+		}
+		// Nobody may be watching, an on-demand camera stops again once idle
+		sm.checkIdle(cameraID)
+		return nil, nil
+	case CommandStop:
+		return nil, sm.StopStream(cameraID)
+	case CommandSnapshot:
+		return sm.Snapshot(cameraID)
+	case CommandOverlay:
+		return nil, sm.AddOverlay(cameraID, cmd.Elements, time.Duration(cmd.TTL)*time.Second)
+	case CommandClearOverlays:
+		return nil, sm.ClearOverlays(cameraID)
+	case CommandArm, CommandDisarm:
+		return nil, sm.modifyCamera(cameraID, func(c *Camera) {
+			motion := MotionConfig{}
+			if c.Motion != nil {
+				motion = *c.Motion
+			}
+			motion.Enabled = cmd.Action == CommandArm
+			c.Motion = &motion
+		})
+	default:
+		return nil, fmt.Errorf("unknown action: %s", cmd.Action)
+	}
+}
+
+// modifyCamera applies a change to the camera through UpdateCameraFunc and saves the config
+func (sm *StreamManager) modifyCamera(cameraID string, change func(c *Camera)) error {
+	if err := sm.UpdateCameraFunc(cameraID, change); err != nil {
+		return err
+	}
+	return sm.SaveConfig("")
+}
+
+// subscribeCommands listens for camera commands on the brokers that enable them
+func (sm *StreamManager) subscribeCommands() {
+	for _, client := range sm.sinks.MQTTClients() {
+		config := client.Config()
+		if !config.Commands {
+			continue
+		}
+		client.Subscribe(cameraTopic(config.Prefix, "+", "set"), func(topic string, payload []byte) {
+			// Snapshots wait for a frame, the client's goroutine must not block
+			go sm.handleCommand(client, topic, payload)
+		})
+		log.Printf("Accepting MQTT camera commands on %s", cameraTopic(config.Prefix, "{id}", "set"))
+	}
+}
+
+// handleCommand runs a command received over MQTT and publishes the acknowledgement
+func (sm *StreamManager) handleCommand(client *eventSinks.MQTTClient, topic string, payload []byte) {
+	prefix := client.Config().Prefix
+	cameraID, ok := commandCamera(prefix, topic)
+	if !ok {
+		return
+	}
+
+	result := CommandResult{CameraID: cameraID}
+	cmd, err := parseCommand(payload)
+	if err == nil {
+		result.ID, result.Action = cmd.ID, cmd.Action
+		var snapshot []byte
+		if snapshot, err = sm.ExecuteCommand(cameraID, cmd); err == nil && snapshot != nil {
+			err = client.Publish(cameraTopic(prefix, cameraID, "snapshot"), snapshot, false)
+		}
+	}
+	result.OK = err == nil
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("MQTT command for camera %s failed: %v", cameraID, err)
+	} else {
+		log.Printf("MQTT command %s for camera %s done", cmd.Action, cameraID)
+	}
+	result.Time = time.Now().UTC()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := client.Publish(cameraTopic(prefix, cameraID, "response"), data, false); err != nil {
+		log.Printf("Failed to acknowledge MQTT command for camera %s: %v", cameraID, err)
+	}
+}
@@ -0,0 +1,238 @@
+package streamManager
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    CameraCommand
+		wantErr bool
+	}{
+		{name: "plain action", payload: " Enable\n", want: CameraCommand{Action: CommandEnable}},
+		{name: "json", payload: `{"action":"snapshot","id":"42"}`, want: CameraCommand{Action: CommandSnapshot, ID: "42"}},
+		{name: "overlay", payload: `{"action":"overlay","ttl":5,"elements":[{"type":"text","text":"Door open"}]}`,
+			want: CameraCommand{Action: CommandOverlay, TTL: 5, Elements: []DrawElement{{Type: "text", Text: "Door open"}}}},
+		{name: "empty", payload: "", wantErr: true},
+		{name: "json without action", payload: `{"id":"1"}`, wantErr: true},
+		{name: "invalid json", payload: `{"action":`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseCommand([]byte(test.payload))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if got.Action != test.want.Action || got.ID != test.want.ID || got.TTL != test.want.TTL || len(got.Elements) != len(test.want.Elements) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCommandCamera(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  string
+		ok    bool
+	}{
+		{topic: "firescrew/cameras/front/set", want: "front", ok: true},
+		{topic: "firescrew/cameras/front/response", ok: false},
+		{topic: "other/cameras/front/set", ok: false},
+		{topic: "firescrew/cameras//set", ok: false},
+		{topic: "firescrew/cameras/a/b/set", ok: false},
+	}
+	for _, test := range tests {
+		got, ok := commandCamera("firescrew", test.topic)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.topic, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestActiveOverlays(t *testing.T) {
+	now := time.Now()
+	info := &StreamInfo{overlays: []timedOverlay{
+		{elements: []DrawElement{{Type: "text"}}, expires: now.Add(-time.Second)},
+		{elements: []DrawElement{{Type: "rectangle"}, {Type: "polyline"}}, expires: now.Add(time.Second)},
+	}}
+
+	if got := info.activeOverlays(now); len(got) != 2 || got[0].Type != "rectangle" {
+		t.Errorf("got %+v, want the unexpired elements", got)
+	}
+	if len(info.overlays) != 1 {
+		t.Errorf("expired overlay kept")
+	}
+	if got := info.activeOverlays(now.Add(2 * time.Second)); len(got) != 0 || len(info.overlays) != 0 {
+		t.Errorf("got %+v after every overlay expired", got)
+	}
+}
+
+func TestAddOverlayLimits(t *testing.T) {
+	sm := &StreamManager{}
+	info := &StreamInfo{}
+	sm.streams.Store("cam", info)
+	text := func(n int) []DrawElement {
+		elements := make([]DrawElement, n)
+		for i := range elements {
+			elements[i] = DrawElement{Type: "text", Text: "Door open"}
+		}
+		return elements
+	}
+
+	if err := sm.AddOverlay("cam", text(maxOverlayElements+1), time.Minute); err == nil {
+		t.Error("accepted an overlay with too many elements")
+	}
+
+	// Fill the overlay slots, the next overlay is rejected
+	for i := 0; i < maxOverlays; i++ {
+		if err := sm.AddOverlay("cam", text(1), time.Minute); err != nil {
+			t.Fatalf("overlay %d: %v", i, err)
+		}
+	}
+	if err := sm.AddOverlay("cam", text(1), time.Minute); err == nil {
+		t.Errorf("accepted overlay %d", maxOverlays+1)
+	}
+
+	// Expired overlays free their slots
+	info.mu.Lock()
+	for i := range info.overlays {
+		info.overlays[i].expires = time.Now().Add(-time.Second)
+	}
+	info.mu.Unlock()
+	if err := sm.AddOverlay("cam", text(maxOverlayElements-1), time.Minute); err != nil {
+		t.Fatalf("overlay after the others expired: %v", err)
+	}
+
+	// The element limit counts every active overlay
+	if err := sm.AddOverlay("cam", text(2), time.Minute); err == nil {
+		t.Error("accepted more elements than the limit")
+	}
+	if err := sm.AddOverlay("cam", text(1), time.Minute); err != nil {
+		t.Errorf("overlay up to the element limit: %v", err)
+	}
+	if got := len(info.activeOverlays(time.Now())); got != maxOverlayElements {
+		t.Errorf("%d active elements, want %d", got, maxOverlayElements)
+	}
+}
+
+func TestAddOverlayRejectsOversizedElements(t *testing.T) {
+	sm := &StreamManager{}
+	info := &StreamInfo{}
+	sm.streams.Store("cam", info)
+	at := []Point{{X: 20, Y: 40}}
+
+	tests := []struct {
+		name    string
+		element DrawElement
+		valid   bool
+	}{
+		{name: "text", element: DrawElement{Type: "text", Text: "Door open", Points: at, FontSize: 24}, valid: true},
+		{name: "largest text", element: DrawElement{Type: "text", Text: "Door open", Points: at, FontSize: maxOverlayFontSize}, valid: true},
+		{name: "huge font", element: DrawElement{Type: "text", Text: "Door open", Points: at, FontSize: 100000}},
+		{name: "negative font", element: DrawElement{Type: "text", Text: "Door open", Points: at, FontSize: -1}},
+		{name: "long text", element: DrawElement{Type: "text", Text: strings.Repeat("x", maxOverlayText+1), Points: at}},
+		{name: "polyline", element: DrawElement{Type: "polyline", Points: []Point{{X: 0, Y: 0}, {X: 100, Y: 100}}, Thickness: 4}, valid: true},
+		{name: "huge thickness", element: DrawElement{Type: "polyline", Points: []Point{{X: 0, Y: 0}, {X: 100, Y: 100}}, Thickness: 100000}},
+		{name: "too many points", element: DrawElement{Type: "polyline", Points: make([]Point, maxOverlayPoints+1)}},
+		{name: "far away point", element: DrawElement{Type: "polyline", Points: []Point{{X: 0, Y: 0}, {X: 1 << 30, Y: 0}}}},
+		{name: "negative point", element: DrawElement{Type: "rectangle", Points: []Point{{X: -5, Y: 0}, {X: 100, Y: 100}}}},
+		{name: "unknown type", element: DrawElement{Type: "circle", Points: at}},
+	}
+
+	for _, test := range tests {
+		err := sm.AddOverlay("cam", []DrawElement{test.element}, time.Minute)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+	if got := len(info.activeOverlays(time.Now())); got != 3 {
+		t.Errorf("%d overlay elements stored, want only the 3 valid ones", got)
+	}
+}
+
+func TestStartCommandSchedulesIdleStop(t *testing.T) {
+	sm := &StreamManager{config: &Config{Cameras: []Camera{
+		{ID: "demand", Enabled: true, Mode: ModeOnDemand},
+		{ID: "always", Enabled: true},
+	}}}
+	streams := make(map[string]*StreamInfo)
+	for _, id := range []string{"demand", "always"} {
+		camera, _ := sm.GetCamera(id)
+		streams[id] = &StreamInfo{camera: camera}
+		sm.streams.Store(id, streams[id])
+	}
+
+	for id, want := range map[string]bool{"demand": true, "always": false} {
+		if _, err := sm.ExecuteCommand(id, CameraCommand{Action: CommandStart}); err != nil {
+			t.Fatal(err)
+		}
+		info := streams[id]
+		info.mu.Lock()
+		scheduled := info.StopTimer != nil
+		if scheduled {
+			info.StopTimer.Stop()
+		}
+		info.mu.Unlock()
+		if scheduled != want {
+			t.Errorf("camera %s: idle stop scheduled %v, want %v", id, scheduled, want)
+		}
+	}
+}
+
+func TestConcurrentCommandsKeepEachChange(t *testing.T) {
+	sm := &StreamManager{
+		config:     &Config{},
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+		uptime:     newMemoryUptimeLog(),
+		events:     newEventBus(),
+	}
+
+	for round := 0; round < 20; round++ {
+		sm.config.Cameras = []Camera{{ID: "cam", RtspUrl: "rtsp://cam", Enabled: true, Mode: ModeOnDemand, Motion: &MotionConfig{Enabled: true}}}
+
+		// Both commands read the camera, neither may write back the other's old value
+		var wg sync.WaitGroup
+		for _, action := range []string{CommandDisable, CommandDisarm} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := sm.ExecuteCommand("cam", CameraCommand{Action: action}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		camera, _ := sm.GetCamera("cam")
+		if camera.Enabled || camera.Motion.Enabled {
+			t.Fatalf("round %d: enabled %v, armed %v, want both changes applied", round, camera.Enabled, camera.Motion.Enabled)
+		}
+	}
+}
+
+func TestDeliverSnapshot(t *testing.T) {
+	info := &StreamInfo{}
+	first, second := info.requestSnapshot(), info.requestSnapshot()
+	frame := []byte{0xff, 0xd8, 1, 2}
+	info.deliverSnapshot(frame)
+	frame[2] = 9 // The encoder reuses its buffer
+
+	for _, ch := range []chan []byte{first, second} {
+		if got := <-ch; len(got) != 4 || got[2] != 1 {
+			t.Errorf("got %v, want a copy of the frame", got)
+		}
+	}
+	if len(info.snapshots) != 0 {
+		t.Error("snapshot requests kept after delivery")
+	}
+}
@@ -0,0 +1,51 @@
+package streamManager
+
+import "context"
+
+// Decode modes for a camera
+const (
+	DecodeFull      = "full"      // Decode every frame (default)
+	DecodeKeyframes = "keyframes" // Decode only IDR frames until a viewer attaches or motion is detected
+)
+
+// decodeMode returns the camera's configured decode mode, defaulting to full
+func (c *Camera) decodeMode() string {
+	if c.DecodeMode == "" {
+		return DecodeFull
+	}
+	return c.DecodeMode
+}
+
+// requestDecodeCheck asks the feed loop to re-evaluate keyframe-only decoding
+func (si *StreamInfo) requestDecodeCheck() {
+	select {
+	case si.decodeCheck <- struct{}{}:
+	default:
+	}
+}
+
+// keyframesOnly reports whether the stream can currently run in low-power keyframe mode:
+// configured for it, nobody watching, no virtual cameras attached and no motion
+func (si *StreamInfo) keyframesOnly() bool {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if si.camera.decodeMode() != DecodeKeyframes {
+		return false
+	}
+	return si.ViewerCount == 0 && len(si.subscribers) == 0 && !si.motion.active
+}
+
+// watchDecodeMode calls restart once the stream should leave or enter keyframe-only decoding
+func watchDecodeMode(ctx context.Context, info *StreamInfo, keyframesOnly bool, restart func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-info.decodeCheck:
+			if info.keyframesOnly() != keyframesOnly {
+				restart()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package streamManager
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestKeyframesOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		viewers    int
+		subscriber bool
+		motion     bool
+		want       bool
+	}{
+		{name: "full decode", mode: DecodeFull},
+		{name: "default mode", mode: ""},
+		{name: "keyframes while idle", mode: DecodeKeyframes, want: true},
+		{name: "keyframes with a viewer", mode: DecodeKeyframes, viewers: 1},
+		{name: "keyframes with a virtual camera", mode: DecodeKeyframes, subscriber: true},
+		{name: "keyframes with motion", mode: DecodeKeyframes, motion: true},
+	}
+
+	for _, test := range tests {
+		info := &StreamInfo{
+			camera:      &Camera{DecodeMode: test.mode},
+			ViewerCount: test.viewers,
+			subscribers: make(map[chan *image.RGBA]struct{}),
+		}
+		if test.subscriber {
+			info.subscribe()
+		}
+		info.motion.active = test.motion
+		if got := info.keyframesOnly(); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWatchDecodeModeOnMotion(t *testing.T) {
+	info := &StreamInfo{
+		camera:      &Camera{DecodeMode: DecodeKeyframes, Motion: &MotionConfig{Enabled: true}},
+		subscribers: make(map[chan *image.RGBA]struct{}),
+		decodeCheck: make(chan struct{}, 1),
+	}
+	restarted := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchDecodeMode(ctx, info, info.keyframesOnly(), func() { close(restarted) })
+
+	// A check without a change keeps the current mode
+	info.requestDecodeCheck()
+	select {
+	case <-restarted:
+		t.Fatal("restarted without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Motion on a keyframe switches the stream to full decode
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	info.mu.Lock()
+	info.motion.update(grayFrame(100, image.Rectangle{}, 0), *info.camera.Motion, now)
+	info.motion.update(grayFrame(100, image.Rect(0, 0, 40, 40), 250), *info.camera.Motion, now.Add(time.Second))
+	info.mu.Unlock()
+	info.requestDecodeCheck()
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("motion did not switch the stream to full decode")
+	}
+}
@@ -0,0 +1,279 @@
+package streamManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventHistorySize is the number of events kept for Last-Event-ID resume
+const eventHistorySize = 1000
+
+// eventBuffer is the number of events queued per subscriber before it is dropped
+const eventBuffer = 64
+
+// Event types
+const (
+	EventCameraAdded   = "camera_added"
+	EventCameraUpdated = "camera_updated"
+	EventCameraDeleted = "camera_deleted"
+	EventStreamStarted = "stream_started"
+	EventStreamStopped = "stream_stopped"
+	EventStateChanged  = "state_changed" // Data: state, reason
+	EventViewerJoined  = "viewer_joined" // Data: viewer
+	EventViewerLeft    = "viewer_left"   // Data: viewer
+	EventMotion        = "motion"        // Data: active
+
+	// Events sent to the sinks configured in Config.Events
+	EventCameraOnline  = "camera_online"  // Frames arrive again after an outage or stall
+	EventCameraOffline = "camera_offline" // The source failed. Data: state, reason
+	EventStreamStalled = "stream_stalled" // Streaming but no frames for the stall timeout. Data: seconds
+	EventMotionStart   = "motion_start"
+	EventMotionEnd     = "motion_end"
+	EventConfigChanged = "config_changed" // Data: action (added, updated, deleted)
+
+	// eventResync tells an SSE client that events were missed and it should reload the full state
+	eventResync = "resync"
+)
+
+// Event is a change to a camera or its stream
+type Event struct {
+	ID       uint64         `json:"id"`
+	Type     string         `json:"type"`
+	Time     time.Time      `json:"time"`
+	CameraID string         `json:"cameraId,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+// eventBus fans events out to subscribers and keeps a bounded history
+type eventBus struct {
+	mu          sync.Mutex
+	epoch       string // Differs on every start so event IDs from an earlier run are recognized
+	nextID      uint64
+	history     []Event // Oldest first, at most eventHistorySize
+	subscribers map[chan Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextID:      1,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// publish assigns the event an ID and delivers it. Subscribers that fall behind are
+// dropped and resume from the history when they reconnect.
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID
+	b.nextID++
+	e.Time = time.Now().UTC()
+
+	if len(b.history) == eventHistorySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:eventHistorySize-1]
+	}
+	b.history = append(b.history, e)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns a channel of new events and the events after lastID of run epoch still in
+// the history. complete is false if events after lastID were already dropped from the history.
+func (b *eventBus) subscribe(epoch string, lastID uint64) (ch chan Event, backlog []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch = make(chan Event, eventBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	complete = true
+	if lastID > 0 {
+		// IDs from before a server restart say nothing about what was missed, send everything kept
+		if epoch != b.epoch || lastID >= b.nextID {
+			return ch, append([]Event(nil), b.history...), false
+		}
+		if len(b.history) > 0 && b.history[0].ID > lastID+1 {
+			complete = false
+		}
+		for _, e := range b.history {
+			if e.ID > lastID {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	return ch, backlog, complete
+}
+
+// unsubscribe stops delivering events to ch
+func (b *eventBus) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// emit publishes an event about a camera
+func (sm *StreamManager) emit(eventType, cameraID string, data map[string]any) {
+	sm.events.publish(Event{Type: eventType, CameraID: cameraID, Data: data})
+}
+
+// setState records a camera state transition and publishes it if the state changed.
+// Entering an outage notifies camera_offline and recovering from one camera_online.
+func (sm *StreamManager) setState(cameraID, state, reason string) {
+	previous, changed := sm.uptime.record(cameraID, state, reason)
+	if !changed {
+		return
+	}
+	data := map[string]any{"state": state}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	sm.emit(EventStateChanged, cameraID, data)
+
+	switch {
+	case stateDown(state) && !stateDown(previous):
+		sm.notify(EventCameraOffline, cameraID, data)
+	case state == StateStreaming && stateDown(previous):
+		sm.notify(EventCameraOnline, cameraID, nil)
+	}
+}
+
+// eventFilter selects the events sent to an SSE client
+type eventFilter struct {
+	types   map[string]bool // Empty allows every type
+	cameras map[string]bool // Empty allows every camera
+}
+
+// parseEventFilter reads the comma-separated types and camera query parameters
+func parseEventFilter(r *http.Request) eventFilter {
+	split := func(v string) map[string]bool {
+		set := make(map[string]bool)
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				set[s] = true
+			}
+		}
+		return set
+	}
+	return eventFilter{types: split(r.URL.Query().Get("types")), cameras: split(r.URL.Query().Get("camera"))}
+}
+
+func (f eventFilter) match(e Event) bool {
+	if len(f.types) > 0 && !f.types[e.Type] {
+		return false
+	}
+	if len(f.cameras) > 0 && e.CameraID != "" && !f.cameras[e.CameraID] {
+		return false
+	}
+	return true
+}
+
+// writeEvent writes one event in the SSE format. The SSE ID is prefixed with the run epoch.
+func writeEvent(w http.ResponseWriter, epoch string, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n", epoch, e.ID, e.Type, data)
+	return err
+}
+
+// parseEventID splits a Last-Event-ID into its run epoch and event ID.
+// A bare number, as sent by clients of older versions, has no epoch.
+func parseEventID(v string) (string, uint64, error) {
+	epoch, id, ok := strings.Cut(v, "-")
+	if !ok {
+		epoch, id = "", v
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	return epoch, n, err
+}
+
+// handleEventStream streams camera events as Server-Sent Events.
+// Clients resume with the Last-Event-ID header; if events were missed a resync event is sent first.
+func (sm *StreamManager) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var lastEpoch string
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		epoch, id, err := parseEventID(v)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastEpoch, lastID = epoch, id
+	}
+	filter := parseEventFilter(r)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// The stream outlives the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	events, backlog, complete := sm.events.subscribe(lastEpoch, lastID)
+	defer sm.events.unsubscribe(events)
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventResync)
+	}
+	for _, e := range backlog {
+		if filter.match(e) {
+			if err := writeEvent(w, sm.events.epoch, e); err != nil {
+				return
+			}
+		}
+	}
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				// Fell behind, the client reconnects and resumes from the history
+				return
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if err := writeEvent(w, sm.events.epoch, e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
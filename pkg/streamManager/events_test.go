@@ -0,0 +1,205 @@
+package streamManager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+	"github.com/8ff/firescrew/pkg/notifier"
+)
+
+func TestEventBusResume(t *testing.T) {
+	b := newEventBus()
+	for i := 0; i < eventHistorySize+10; i++ {
+		b.publish(Event{Type: EventMotion, CameraID: "cam"})
+	}
+	last := uint64(eventHistorySize + 10)
+
+	tests := []struct {
+		name     string
+		epoch    string
+		lastID   uint64
+		backlog  int
+		complete bool
+	}{
+		{name: "new client", lastID: 0, backlog: 0, complete: true},
+		{name: "up to date", epoch: b.epoch, lastID: last, backlog: 0, complete: true},
+		{name: "in history", epoch: b.epoch, lastID: last - 5, backlog: 5, complete: true},
+		{name: "oldest kept", epoch: b.epoch, lastID: 10, backlog: eventHistorySize, complete: true},
+		{name: "dropped from history", epoch: b.epoch, lastID: 5, backlog: eventHistorySize, complete: false},
+		{name: "ahead of this run", epoch: b.epoch, lastID: last + 100, backlog: eventHistorySize, complete: false},
+		{name: "lower ID before a restart", epoch: "earlier", lastID: last - 5, backlog: eventHistorySize, complete: false},
+		{name: "higher ID before a restart", epoch: "earlier", lastID: last + 100, backlog: eventHistorySize, complete: false},
+		{name: "ID without an epoch", lastID: last - 5, backlog: eventHistorySize, complete: false},
+	}
+
+	for _, test := range tests {
+		ch, backlog, complete := b.subscribe(test.epoch, test.lastID)
+		b.unsubscribe(ch)
+		if len(backlog) != test.backlog || complete != test.complete {
+			t.Errorf("%s: got %d events, complete %v, want %d, %v", test.name, len(backlog), complete, test.backlog, test.complete)
+		}
+		if len(backlog) > 0 && backlog[0].ID != test.lastID+1 && test.complete {
+			t.Errorf("%s: backlog starts at %d, want %d", test.name, backlog[0].ID, test.lastID+1)
+		}
+	}
+}
+
+func TestEventStreamAfterRestart(t *testing.T) {
+	sm := &StreamManager{events: newEventBus()}
+	for _, camera := range []string{"a", "b", "c"} {
+		sm.emit(EventCameraAdded, camera, nil)
+	}
+	server := httptest.NewServer(http.HandlerFunc(sm.handleEventStream))
+	defer server.Close()
+
+	// readUntilRetry returns the id and event lines sent before the stream goes live
+	readUntilRetry := func(lastEventID string) []string {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Last-Event-ID %q: status %d", lastEventID, resp.StatusCode)
+		}
+
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "retry:") {
+				break
+			}
+			if strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "event:") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	epoch := sm.events.epoch
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{name: "resume in this run", lastEventID: epoch + "-2", want: []string{
+			"id: " + epoch + "-3", "event: " + EventCameraAdded,
+		}},
+		{name: "resume from an earlier run", lastEventID: "earlier-2", want: []string{
+			"event: " + eventResync,
+			"id: " + epoch + "-1", "event: " + EventCameraAdded,
+			"id: " + epoch + "-2", "event: " + EventCameraAdded,
+			"id: " + epoch + "-3", "event: " + EventCameraAdded,
+		}},
+		{name: "resume from an older version", lastEventID: "7", want: []string{
+			"event: " + eventResync,
+			"id: " + epoch + "-1", "event: " + EventCameraAdded,
+			"id: " + epoch + "-2", "event: " + EventCameraAdded,
+			"id: " + epoch + "-3", "event: " + EventCameraAdded,
+		}},
+	}
+
+	for _, test := range tests {
+		if got := readUntilRetry(test.lastEventID); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "earlier-x")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestEventBusSlowSubscriber(t *testing.T) {
+	b := newEventBus()
+	ch, _, _ := b.subscribe("", 0)
+	for i := 0; i < eventBuffer+1; i++ {
+		b.publish(Event{Type: EventMotion})
+	}
+
+	// The subscriber is dropped once its buffer is full instead of blocking publishers
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != eventBuffer {
+		t.Errorf("received %d events before being dropped, want %d", n, eventBuffer)
+	}
+	b.unsubscribe(ch)
+}
+
+func TestSetStateNotifies(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e eventSinks.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		received <- e.Type
+	}))
+	defer server.Close()
+
+	sinks, err := eventSinks.New(eventSinks.Config{Webhooks: []eventSinks.WebhookConfig{{URL: server.URL}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := &StreamManager{uptime: newMemoryUptimeLog(), events: newEventBus(), sinks: sinks}
+
+	for _, state := range []string{StateStarting, StateStreaming, StateBackoff, StateOffline, StateStreaming, StateStopped} {
+		sm.setState("cam", state, "")
+	}
+	defer sinks.Close()
+
+	for _, want := range []string{EventCameraOffline, EventCameraOnline} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("got event %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not delivered", want)
+		}
+	}
+}
+
+func TestNotificationText(t *testing.T) {
+	tests := []struct {
+		eventType string
+		data      map[string]any
+		title     string
+		text      string
+		priority  notifier.Priority
+	}{
+		{EventCameraOffline, map[string]any{"reason": "connection refused"}, "Camera offline", "Garage is offline: connection refused", notifier.PriorityHigh},
+		{EventStreamStalled, map[string]any{"seconds": 45}, "Stream stalled", "Garage sent no frames for 45 seconds", notifier.PriorityHigh},
+		{EventCameraOnline, nil, "Camera online", "Garage is streaming again", notifier.PriorityLow},
+		{EventMotionStart, nil, "Motion detected", "Motion on Garage", notifier.PriorityNormal},
+		{EventConfigChanged, map[string]any{"action": "deleted"}, "Camera config changed", "Garage was deleted", notifier.PriorityLow},
+	}
+	for _, test := range tests {
+		title, text, priority := notificationText(test.eventType, "Garage", test.data)
+		if title != test.title || text != test.text || priority != test.priority {
+			t.Errorf("%s: got %q, %q, %d", test.eventType, title, text, priority)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package streamManager
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGPUSessions = 8 // RTX 4090 supports 8-10 concurrent NVDEC sessions
+	gpuErrorWindow     = time.Minute
+	gpuErrorCameras    = 2               // Distinct failing cameras within the window that mark a device unhealthy
+	gpuCooldown        = 2 * time.Minute // How long an unhealthy device receives no new sessions
+)
+
+// GPUDevice configures the decode session pool of one GPU
+type GPUDevice struct {
+	Device   string `json:"device"`             // Passed to ffmpeg as -hwaccel_device, e.g. "0" for CUDA or "/dev/dri/renderD128" for VA-API
+	Backend  string `json:"backend,omitempty"`  // Restricts the device to one backend, empty allows any hardware backend
+	Sessions int    `json:"sessions,omitempty"` // Concurrent decode sessions, 0 uses gpuSlots or the default of 8
+}
+
+// GPUDeviceStatus reports the sessions and health of a GPU device
+type GPUDeviceStatus struct {
+	Device         string     `json:"device"`
+	Backend        string     `json:"backend,omitempty"`
+	Sessions       int        `json:"sessions"`
+	MaxSessions    int        `json:"maxSessions"`
+	Cameras        []string   `json:"cameras"`
+	RecentErrors   int        `json:"recentErrors"`
+	Healthy        bool       `json:"healthy"`
+	UnhealthyUntil *time.Time `json:"unhealthyUntil,omitempty"`
+}
+
+// gpuError is a decoder failure reported by a camera on a device
+type gpuError struct {
+	cameraID string
+	at       time.Time
+}
+
+// gpuDevice is the runtime state of one configured device
+type gpuDevice struct {
+	GPUDevice
+	cameras        map[string]int // Sessions per camera
+	used           int
+	errors         []gpuError
+	unhealthyUntil time.Time
+}
+
+// name returns the device name used in logs and the API
+func (d *gpuDevice) name() string {
+	if d.Device == "" {
+		return "default"
+	}
+	return d.Device
+}
+
+// gpuPool hands out hardware decode sessions across GPU devices
+type gpuPool struct {
+	mu      sync.Mutex
+	devices []*gpuDevice
+}
+
+// newGPUPool builds the session pool from the decoder budget.
+// Without configured devices a single default device is used, leaving the choice to ffmpeg.
+func newGPUPool(budget *DecoderBudget) *gpuPool {
+	sessions := defaultGPUSessions
+	var configured []GPUDevice
+	if budget != nil {
+		if budget.GPUSlots > 0 {
+			sessions = budget.GPUSlots
+		}
+		configured = budget.GPUDevices
+	}
+	if len(configured) == 0 {
+		configured = []GPUDevice{{}}
+	}
+
+	p := &gpuPool{}
+	for _, c := range configured {
+		if c.Sessions <= 0 {
+			c.Sessions = sessions
+		}
+		p.devices = append(p.devices, &gpuDevice{GPUDevice: c, cameras: make(map[string]int)})
+	}
+	return p
+}
+
+// healthy reports whether a device may receive new sessions
+func (d *gpuDevice) healthy(now time.Time) bool {
+	return !now.Before(d.unhealthyUntil)
+}
+
+// supports reports whether a device can run the backend
+func (d *gpuDevice) supports(backend string) bool {
+	return d.Backend == "" || d.Backend == backend
+}
+
+// acquire reserves a session on the least loaded healthy device for the backend,
+// skipping devices in avoid. Returns nil when every device is full.
+func (p *gpuPool) acquire(cameraID, backend string, avoid map[string]bool) *gpuDevice {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best *gpuDevice
+	for _, d := range p.devices {
+		if !d.supports(backend) || avoid[d.Device] || !d.healthy(now) || d.used >= d.Sessions {
+			continue
+		}
+		// Compare load as a fraction so devices with different pool sizes fill evenly
+		if best == nil || d.used*best.Sessions < best.used*d.Sessions {
+			best = d
+		}
+	}
+
+	if best == nil {
+		log.Printf("⚠ GPU sessions full for camera %s (%s), falling back to CPU", cameraID, backend)
+		return nil
+	}
+
+	best.used++
+	best.cameras[cameraID]++
+	log.Printf("✓ GPU session acquired on device %s for camera %s (%d/%d)", best.name(), cameraID, best.used, best.Sessions)
+	return best
+}
+
+// release returns a session to its device
+func (p *gpuPool) release(d *gpuDevice, cameraID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if d.used > 0 {
+		d.used--
+	}
+	if d.cameras[cameraID] > 1 {
+		d.cameras[cameraID]--
+	} else {
+		delete(d.cameras, cameraID)
+	}
+	log.Printf("GPU session released on device %s (%d/%d)", d.name(), d.used, d.Sessions)
+}
+
+// devicesFor lists the devices that can run the backend
+func (p *gpuPool) devicesFor(backend string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var devices []string
+	for _, d := range p.devices {
+		if d.supports(backend) {
+			devices = append(devices, d.Device)
+		}
+	}
+	return devices
+}
+
+// recordError counts a decoder failure on a device. Errors from several cameras
+// within the window point at the device rather than a stream, so the device is
+// taken out of rotation for a cooldown. Returns true when that happened.
+func (p *gpuPool) recordError(d *gpuDevice, cameraID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	recent := d.errors[:0]
+	for _, e := range d.errors {
+		if now.Sub(e.at) < gpuErrorWindow {
+			recent = append(recent, e)
+		}
+	}
+	d.errors = append(recent, gpuError{cameraID: cameraID, at: now})
+
+	if !d.healthy(now) {
+		return false
+	}
+	cameras := make(map[string]bool)
+	for _, e := range d.errors {
+		cameras[e.cameraID] = true
+	}
+	if len(cameras) < gpuErrorCameras {
+		return false
+	}
+
+	d.unhealthyUntil = now.Add(gpuCooldown)
+	d.errors = nil
+	log.Printf("⚠ GPU device %s failing for %d cameras, moving its sessions to other devices for %s", d.name(), len(cameras), gpuCooldown)
+	return true
+}
+
+// status reports the state of every device
+func (p *gpuPool) status() []GPUDeviceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]GPUDeviceStatus, 0, len(p.devices))
+	for _, d := range p.devices {
+		status := GPUDeviceStatus{
+			Device:      d.name(),
+			Backend:     d.Backend,
+			Sessions:    d.used,
+			MaxSessions: d.Sessions,
+			Cameras:     make([]string, 0, len(d.cameras)),
+			Healthy:     d.healthy(now),
+		}
+		for id := range d.cameras {
+			status.Cameras = append(status.Cameras, id)
+		}
+		sort.Strings(status.Cameras)
+		for _, e := range d.errors {
+			if now.Sub(e.at) < gpuErrorWindow {
+				status.RecentErrors++
+			}
+		}
+		if !status.Healthy {
+			until := d.unhealthyUntil
+			status.UnhealthyUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// GetGPUDevices returns the session counts and health of each GPU device
+func (sm *StreamManager) GetGPUDevices() []GPUDeviceStatus {
+	return sm.gpus.status()
+}
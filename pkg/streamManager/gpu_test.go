@@ -0,0 +1,62 @@
+package streamManager
+
+import "testing"
+
+func TestGPUPoolAcquire(t *testing.T) {
+	pool := newGPUPool(&DecoderBudget{GPUDevices: []GPUDevice{
+		{Device: "0", Sessions: 2},
+		{Device: "1", Sessions: 4},
+		{Device: "/dev/dri/renderD128", Backend: BackendVAAPI, Sessions: 1},
+	}})
+
+	// CUDA sessions fill both NVIDIA devices in proportion to their size
+	var got []string
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		d := pool.acquire(id, BackendCUDA, nil)
+		if d == nil {
+			t.Fatalf("camera %s got no session", id)
+		}
+		got = append(got, d.Device)
+	}
+	want := []string{"0", "1", "1", "0", "1", "1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got devices %v, want %v", got, want)
+		}
+	}
+	if d := pool.acquire("g", BackendCUDA, nil); d != nil {
+		t.Errorf("got device %s with every CUDA session in use", d.Device)
+	}
+
+	// Restricted devices only serve their backend, avoided devices are skipped
+	if d := pool.acquire("h", BackendVAAPI, map[string]bool{"/dev/dri/renderD128": true}); d != nil {
+		t.Errorf("got avoided device %s", d.Device)
+	}
+	if d := pool.acquire("h", BackendVAAPI, nil); d == nil || d.Device != "/dev/dri/renderD128" {
+		t.Errorf("VA-API camera did not get the render node")
+	}
+}
+
+func TestGPUPoolUnhealthy(t *testing.T) {
+	pool := newGPUPool(&DecoderBudget{GPUDevices: []GPUDevice{{Device: "0"}, {Device: "1"}}})
+	d := pool.acquire("a", BackendCUDA, nil)
+
+	// Errors from one camera may be the stream, errors from two are the device
+	if pool.recordError(d, "a") || pool.recordError(d, "a") {
+		t.Fatalf("device marked unhealthy by a single camera")
+	}
+	if !pool.recordError(d, "b") {
+		t.Fatalf("device not marked unhealthy after errors from two cameras")
+	}
+
+	for i := 0; i < 3; i++ {
+		if other := pool.acquire("c", BackendCUDA, nil); other == nil || other == d {
+			t.Fatalf("new session placed on the unhealthy device")
+		}
+	}
+	for _, s := range pool.status() {
+		if s.Device == d.Device && (s.Healthy || s.UnhealthyUntil == nil) {
+			t.Errorf("status reports unhealthy device as %+v", s)
+		}
+	}
+}
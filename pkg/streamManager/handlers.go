@@ -3,9 +3,12 @@ package streamManager
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,20 +19,28 @@ var staticFiles embed.FS
 // SetupRoutes sets up HTTP routes for the stream manager
 func (sm *StreamManager) SetupRoutes(mux *http.ServeMux) {
 	// Serve static files
-	mux.HandleFunc("/", sm.handleIndex)
-	mux.HandleFunc("/config", sm.handleConfig)
-	mux.HandleFunc("/camera-config", sm.handleCameraConfig)
-	mux.HandleFunc("/monitor", sm.handleMonitor)
-	mux.Handle("/static/", http.FileServer(http.FS(staticFiles)))
+	sm.handle(mux, "/", http.HandlerFunc(sm.handleIndex))
+	sm.handle(mux, "/config", http.HandlerFunc(sm.handleConfig))
+	sm.handle(mux, "/camera-config", http.HandlerFunc(sm.handleCameraConfig))
+	sm.handle(mux, "/monitor", http.HandlerFunc(sm.handleMonitor))
+	sm.handle(mux, "/static/", http.FileServer(http.FS(staticFiles)))
 
 	// API routes
-	mux.HandleFunc("/api/cameras", sm.handleGetCameras)
-	mux.HandleFunc("/api/cameras/", sm.handleCameraAPI)
-	mux.HandleFunc("/api/camera/", sm.handleGetCameraByID)
-	mux.HandleFunc("/api/status", sm.handleGetStatus)
+	sm.handle(mux, "/api/cameras", http.HandlerFunc(sm.handleGetCameras))
+	sm.handle(mux, "/api/cameras/", http.HandlerFunc(sm.handleCameraAPI))
+	sm.handle(mux, "/api/camera/", http.HandlerFunc(sm.handleGetCameraByID))
+	sm.handle(mux, "/api/status", http.HandlerFunc(sm.handleGetStatus))
+	sm.handle(mux, "/api/gpus", http.HandlerFunc(sm.handleGetGPUs))
+	sm.handle(mux, "/api/uptime", http.HandlerFunc(sm.handleGetFleetUptime))
+	sm.handle(mux, "/api/events/stream", http.HandlerFunc(sm.handleEventStream))
+	sm.handle(mux, "/api/webhooks/deliveries", http.HandlerFunc(sm.handleGetDeliveries))
+	sm.handle(mux, "/api/scripts/runs", http.HandlerFunc(sm.handleGetScriptRuns))
 
 	// Stream routes
-	mux.HandleFunc("/stream/", sm.handleStream)
+	sm.handle(mux, "/stream/", http.HandlerFunc(sm.handleStream))
+
+	// Prometheus metrics
+	mux.Handle("/metrics", sm.metrics)
 }
 
 // handleIndex serves the main page
@@ -147,6 +158,16 @@ func (sm *StreamManager) handleCameraAPI(w http.ResponseWriter, r *http.Request)
 	switch action {
 	case "roi":
 		sm.handleUpdateROI(w, r, cameraID)
+	case "viewers":
+		if len(parts) > 2 && parts[2] != "" {
+			sm.handleKickViewer(w, r, cameraID, parts[2])
+		} else {
+			sm.handleGetViewers(w, r, cameraID)
+		}
+	case "logs":
+		sm.handleGetLogs(w, r, cameraID)
+	case "uptime":
+		sm.handleGetUptime(w, r, cameraID)
 	default:
 		http.Error(w, "Unknown action", http.StatusBadRequest)
 	}
@@ -268,6 +289,10 @@ func (sm *StreamManager) handleStream(w http.ResponseWriter, r *http.Request) {
 
 	// Add viewer
 	if err := sm.AddViewer(cameraID); err != nil {
+		if errors.Is(err, ErrViewerLimitReached) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
 		log.Printf("Failed to add viewer: %v", err)
 	}
 
@@ -278,16 +303,177 @@ func (sm *StreamManager) handleStream(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// Track the viewer session while it is connected
+	session := newViewerSession(r)
+	writer := &viewerWriter{ResponseWriter: w, session: session}
+	if streamInfo, err := sm.GetStreamInfo(cameraID); err == nil {
+		streamInfo.registerViewer(session)
+		defer streamInfo.unregisterViewer(session)
+		writer.metrics = &streamInfo.metrics
+	}
+	sm.emit(EventViewerJoined, cameraID, map[string]any{"viewer": session.ViewerInfo})
+	defer func() {
+		sm.emit(EventViewerLeft, cameraID, map[string]any{"viewer": session.snapshot()})
+	}()
+
 	// Serve MJPEG stream
-	stream.ServeHTTP(w, r)
+	serveViewer(stream, writer, r)
+}
+
+// handleGetViewers lists the viewer sessions of a camera
+func (sm *StreamManager) handleGetViewers(w http.ResponseWriter, r *http.Request, cameraID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := sm.GetCamera(cameraID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	viewers, err := sm.GetViewers(cameraID)
+	if err != nil {
+		// Camera exists but is not streaming
+		viewers = []ViewerInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(viewers)
+}
+
+// handleGetLogs returns the recent ffmpeg output of a camera.
+// Optional query parameters: class filters by log class, limit keeps the newest lines.
+func (sm *StreamManager) handleGetLogs(w http.ResponseWriter, r *http.Request, cameraID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	logs, err := sm.GetCameraLogs(cameraID, r.URL.Query().Get("class"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logs)
+}
+
+// uptimeRange parses the from and to query parameters as RFC 3339 times.
+// to defaults to now and from to 30 days before to.
+func uptimeRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+// handleGetUptime returns the availability and outages of a camera
+func (sm *StreamManager) handleGetUptime(w http.ResponseWriter, r *http.Request, cameraID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := uptimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := sm.GetCamera(cameraID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	report, err := sm.GetCameraUptime(cameraID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleGetFleetUptime returns the availability of every camera
+func (sm *StreamManager) handleGetFleetUptime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := uptimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fleet, err := sm.GetFleetUptime(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fleet)
+}
+
+// handleKickViewer disconnects a single viewer session
+func (sm *StreamManager) handleKickViewer(w http.ResponseWriter, r *http.Request, cameraID, viewerID string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := sm.KickViewer(cameraID, viewerID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
 // CameraStatus represents the status of a camera
 type CameraStatus struct {
 	Camera
-	IsStreaming bool      `json:"isStreaming"`
-	ViewerCount int       `json:"viewerCount"`
-	LastViewed  time.Time `json:"lastViewed"`
+	IsStreaming   bool           `json:"isStreaming"`
+	ViewerCount   int            `json:"viewerCount"`
+	LastViewed    time.Time      `json:"lastViewed"`
+	EffectiveFPS  float64        `json:"effectiveFps"`            // Frame rate after load adaptation
+	Decoder       string         `json:"decoder,omitempty"`       // queued or the decoder backend name
+	QueuePosition int            `json:"queuePosition,omitempty"` // Position in the decoder queue when queued
+	GPUDevice     string         `json:"gpuDevice,omitempty"`     // GPU device of a hardware decoder
+	Pipeline      *PipelineStats `json:"pipeline,omitempty"`      // Per-stage frame timing while streaming
+	Metrics       *CameraMetrics `json:"metrics,omitempty"`       // Live stream counters while streaming
+	State         string         `json:"state,omitempty"`         // Latest state in the uptime log
 }
 
 // handleGetStatus returns status of all cameras
@@ -305,6 +491,7 @@ func (sm *StreamManager) handleGetStatus(w http.ResponseWriter, r *http.Request)
 			Camera:      camera,
 			IsStreaming: false,
 			ViewerCount: 0,
+			State:       sm.uptime.current(camera.ID),
 		}
 
 		// Check if stream exists
@@ -313,7 +500,20 @@ func (sm *StreamManager) handleGetStatus(w http.ResponseWriter, r *http.Request)
 			status.IsStreaming = true
 			status.ViewerCount = streamInfo.ViewerCount
 			status.LastViewed = streamInfo.LastViewed
+			status.EffectiveFPS = streamInfo.rate.effective()
+			status.Decoder = streamInfo.decoder
+			status.GPUDevice = streamInfo.gpuDevice
+			stats := streamInfo.pipelineStats()
+			status.Pipeline = &stats
+			inputFPS := streamInfo.rate.inputFPS
 			streamInfo.mu.Unlock()
+
+			metrics := streamInfo.metrics.snapshot(inputFPS)
+			status.Metrics = &metrics
+
+			if status.Decoder == DecoderQueued {
+				status.QueuePosition = sm.decoders.queuePosition(camera.ID)
+			}
 		}
 
 		statuses = append(statuses, status)
@@ -323,6 +523,17 @@ func (sm *StreamManager) handleGetStatus(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(statuses)
 }
 
+// handleGetGPUs returns the session counts and health of each GPU device
+func (sm *StreamManager) handleGetGPUs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sm.GetGPUDevices())
+}
+
 // handleGetCameraByID returns true or false indicating if a camera exists
 func (sm *StreamManager) handleGetCameraByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
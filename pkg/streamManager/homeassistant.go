@@ -0,0 +1,191 @@
+package streamManager
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+)
+
+// invalidObjectID matches characters Home Assistant does not allow in discovery object IDs
+var invalidObjectID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// discoveryMessage is one retained Home Assistant discovery config
+type discoveryMessage struct {
+	topic   string
+	payload map[string]any
+}
+
+// discoveryConfigs returns the Home Assistant entities of a camera: the camera image,
+// a motion sensor and a connectivity sensor, all bound to the availability topic
+func discoveryConfigs(config eventSinks.MQTTConfig, camera Camera) []discoveryMessage {
+	objectID := "firescrew_" + invalidObjectID.ReplaceAllString(camera.ID, "_")
+	name := camera.Name
+	if name == "" {
+		name = camera.ID
+	}
+	device := map[string]any{
+		"identifiers":  []string{objectID},
+		"name":         name,
+		"manufacturer": "firescrew",
+		"model":        "Camera",
+	}
+	entity := func(component, suffix string, fields map[string]any) discoveryMessage {
+		fields["unique_id"] = objectID + "_" + suffix
+		fields["availability_topic"] = config.AvailabilityTopic()
+		fields["payload_available"] = eventSinks.AvailabilityOnline
+		fields["payload_not_available"] = eventSinks.AvailabilityOffline
+		fields["device"] = device
+		return discoveryMessage{
+			topic:   config.DiscoveryPrefix + "/" + component + "/" + objectID + "_" + suffix + "/config",
+			payload: fields,
+		}
+	}
+
+	return []discoveryMessage{
+		entity("camera", "camera", map[string]any{
+			"name":  "Camera",
+			"topic": cameraTopic(config.Prefix, camera.ID, "snapshot"),
+		}),
+		entity("binary_sensor", "motion", map[string]any{
+			"name":         "Motion",
+			"device_class": "motion",
+			"state_topic":  cameraTopic(config.Prefix, camera.ID, "motion"),
+			"payload_on":   "ON",
+			"payload_off":  "OFF",
+		}),
+		entity("binary_sensor", "connectivity", map[string]any{
+			"name":            "Connectivity",
+			"device_class":    "connectivity",
+			"entity_category": "diagnostic",
+			"state_topic":     cameraTopic(config.Prefix, camera.ID, "connectivity"),
+			"payload_on":      eventSinks.AvailabilityOnline,
+			"payload_off":     eventSinks.AvailabilityOffline,
+		}),
+	}
+}
+
+// connectivityState maps a stream state to the connectivity sensor payload
+func connectivityState(state string) string {
+	if state == StateStreaming {
+		return eventSinks.AvailabilityOnline
+	}
+	return eventSinks.AvailabilityOffline
+}
+
+// homeAssistant publishes discovery configs and entity states to one broker
+type homeAssistant struct {
+	sm     *StreamManager
+	client *eventSinks.MQTTClient
+	config eventSinks.MQTTConfig
+}
+
+// startHomeAssistant publishes discovery to the brokers that enable it
+func (sm *StreamManager) startHomeAssistant() {
+	for _, client := range sm.sinks.MQTTClients() {
+		config := client.Config()
+		if !config.HomeAssistant {
+			continue
+		}
+		ha := &homeAssistant{sm: sm, client: client, config: config}
+
+		// Retained configs survive broker restarts, republished anyway in case the broker lost them
+		client.OnConnect(ha.publishAll)
+		// Home Assistant announces itself after a restart
+		client.Subscribe(config.DiscoveryPrefix+"/status", func(_ string, payload []byte) {
+			if string(payload) == eventSinks.AvailabilityOnline {
+				go ha.publishAll()
+			}
+		})
+		go ha.run()
+		log.Printf("Publishing Home Assistant discovery to %s", config.DiscoveryPrefix)
+	}
+}
+
+// run keeps the entities in sync with camera and stream events
+func (ha *homeAssistant) run() {
+	for {
+		events, _, _ := ha.sm.events.subscribe("", 0)
+		for e := range events {
+			ha.handle(e)
+		}
+		// Fell behind and was dropped, events may be missing
+		ha.publishAll()
+	}
+}
+
+// handle updates the entities affected by an event
+func (ha *homeAssistant) handle(e Event) {
+	switch e.Type {
+	case EventCameraAdded, EventCameraUpdated:
+		if camera, err := ha.sm.GetCamera(e.CameraID); err == nil {
+			ha.publishCamera(*camera)
+		}
+	case EventCameraDeleted:
+		ha.removeCamera(e.CameraID)
+	case EventMotion:
+		active, _ := e.Data["active"].(bool)
+		ha.publishMotion(e.CameraID, active)
+		if active {
+			go ha.publishSnapshot(e.CameraID)
+		}
+	case EventStateChanged:
+		state, _ := e.Data["state"].(string)
+		ha.publish(cameraTopic(ha.config.Prefix, e.CameraID, "connectivity"), []byte(connectivityState(state)))
+	}
+}
+
+// publishAll publishes the configs and states of every camera
+func (ha *homeAssistant) publishAll() {
+	for _, camera := range ha.sm.GetAllCameras() {
+		ha.publishCamera(camera)
+	}
+}
+
+// publishCamera publishes a camera's discovery configs and current states
+func (ha *homeAssistant) publishCamera(camera Camera) {
+	for _, msg := range discoveryConfigs(ha.config, camera) {
+		data, err := json.Marshal(msg.payload)
+		if err != nil {
+			continue
+		}
+		ha.publish(msg.topic, data)
+	}
+	ha.publishMotion(camera.ID, ha.sm.MotionActive(camera.ID))
+	ha.publish(cameraTopic(ha.config.Prefix, camera.ID, "connectivity"), []byte(connectivityState(ha.sm.uptime.current(camera.ID))))
+}
+
+// removeCamera deletes a camera's entities by clearing the retained configs
+func (ha *homeAssistant) removeCamera(cameraID string) {
+	for _, msg := range discoveryConfigs(ha.config, Camera{ID: cameraID}) {
+		ha.publish(msg.topic, nil)
+	}
+}
+
+func (ha *homeAssistant) publishMotion(cameraID string, active bool) {
+	state := "OFF"
+	if active {
+		state = "ON"
+	}
+	ha.publish(cameraTopic(ha.config.Prefix, cameraID, "motion"), []byte(state))
+}
+
+// publishSnapshot updates the camera entity's image
+func (ha *homeAssistant) publishSnapshot(cameraID string) {
+	snapshot, err := ha.sm.Snapshot(cameraID)
+	if err != nil {
+		log.Printf("Failed to take Home Assistant snapshot for camera %s: %v", cameraID, err)
+		return
+	}
+	if err := ha.client.Publish(cameraTopic(ha.config.Prefix, cameraID, "snapshot"), snapshot, true); err != nil {
+		log.Printf("Failed to publish Home Assistant snapshot for camera %s: %v", cameraID, err)
+	}
+}
+
+// publish sends a retained message, states must be known to Home Assistant after it restarts
+func (ha *homeAssistant) publish(topic string, payload []byte) {
+	if err := ha.client.Publish(topic, payload, true); err != nil {
+		log.Printf("Failed to publish %s: %v", topic, err)
+	}
+}
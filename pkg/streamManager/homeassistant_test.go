@@ -0,0 +1,56 @@
+package streamManager
+
+import (
+	"testing"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+)
+
+func TestDiscoveryConfigs(t *testing.T) {
+	config := eventSinks.MQTTConfig{Prefix: "firescrew", DiscoveryPrefix: "homeassistant"}
+	messages := discoveryConfigs(config, Camera{ID: "front.door", Name: "Front Door"})
+
+	tests := []struct {
+		topic      string
+		stateKey   string
+		stateTopic string
+	}{
+		{topic: "homeassistant/camera/firescrew_front_door_camera/config", stateKey: "topic", stateTopic: "firescrew/cameras/front.door/snapshot"},
+		{topic: "homeassistant/binary_sensor/firescrew_front_door_motion/config", stateKey: "state_topic", stateTopic: "firescrew/cameras/front.door/motion"},
+		{topic: "homeassistant/binary_sensor/firescrew_front_door_connectivity/config", stateKey: "state_topic", stateTopic: "firescrew/cameras/front.door/connectivity"},
+	}
+	if len(messages) != len(tests) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(tests))
+	}
+
+	for i, test := range tests {
+		msg := messages[i]
+		if msg.topic != test.topic {
+			t.Errorf("message %d: topic %q, want %q", i, msg.topic, test.topic)
+		}
+		if msg.payload[test.stateKey] != test.stateTopic {
+			t.Errorf("%s: %s is %v, want %q", test.topic, test.stateKey, msg.payload[test.stateKey], test.stateTopic)
+		}
+		if msg.payload["availability_topic"] != "firescrew/status" {
+			t.Errorf("%s: not bound to the availability topic", test.topic)
+		}
+		device, _ := msg.payload["device"].(map[string]any)
+		if device["name"] != "Front Door" {
+			t.Errorf("%s: device %v", test.topic, device)
+		}
+	}
+}
+
+func TestConnectivityState(t *testing.T) {
+	for state, want := range map[string]string{
+		StateStreaming: "online",
+		StateStarting:  "offline",
+		StateBackoff:   "offline",
+		StateStopped:   "offline",
+		"":             "offline",
+	} {
+		if got := connectivityState(state); got != want {
+			t.Errorf("%q: got %s, want %s", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package streamManager
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logRingSize is the number of ffmpeg stderr lines kept per camera
+const logRingSize = 200
+
+// Classes of ffmpeg stderr lines
+const (
+	LogInfo       = "info"       // Anything not recognised
+	LogProgress   = "progress"   // Periodic frame=... fps=... status
+	LogDropped    = "dropped"    // Lost packets or dropped frames
+	LogConnection = "connection" // Refused, timed out or reset connections
+	LogAuth       = "auth"       // 401/403, rejected credentials
+	LogNotFound   = "not-found"  // 404, unknown stream path
+	LogCodec      = "codec"      // Undecodable or corrupt input
+	LogHardware   = "hardware"   // Failures of the hardware decoder backend
+	LogError      = "error"      // Other errors
+	LogExit       = "exit"       // ffmpeg exited with an error
+)
+
+var (
+	connectionPatterns = []string{
+		"Connection refused",
+		"Connection timed out",
+		"Connection reset",
+		"No route to host",
+		"Network is unreachable",
+		"Name or service not known",
+		"Temporary failure in name resolution",
+		"Server returned 5",
+	}
+	authPatterns     = []string{"401 Unauthorized", "403 Forbidden", "Invalid credentials"}
+	notFoundPatterns = []string{"404 Not Found", "Stream Not Found"}
+	droppedPatterns  = []string{
+		"RTP: missed",
+		"max delay reached",
+		"Past duration",
+		"corrupt decoded frame",
+		"packets lost",
+	}
+	codecPatterns = []string{
+		"Invalid data found when processing input",
+		"error while decoding",
+		"decode_slice_header error",
+		"non-existing PPS",
+		"no frame!",
+		"Could not find codec parameters",
+		"concealing",
+		"Decoder (codec",
+	}
+)
+
+// classifyFFmpegLine sorts an ffmpeg stderr line into one of the log classes
+func classifyFFmpegLine(line string, backend DecoderBackend) string {
+	switch {
+	case strings.HasPrefix(line, "frame=") || (strings.Contains(line, "fps=") && strings.Contains(line, "speed=")):
+		return LogProgress
+	case containsAny(line, authPatterns):
+		return LogAuth
+	case containsAny(line, notFoundPatterns):
+		return LogNotFound
+	case containsAny(line, connectionPatterns):
+		return LogConnection
+	case backend != nil && backend.Hardware() && backend.IsError(line):
+		return LogHardware
+	case containsAny(line, droppedPatterns):
+		return LogDropped
+	case containsAny(line, codecPatterns):
+		return LogCodec
+	case strings.Contains(line, "rror") || strings.Contains(line, "failed") || strings.Contains(line, "Failed"):
+		return LogError
+	}
+	return LogInfo
+}
+
+// isFatalLogClass reports whether retrying cannot fix the error
+func isFatalLogClass(class string) bool {
+	return class == LogAuth || class == LogNotFound
+}
+
+// LogLine is one classified ffmpeg stderr line
+type LogLine struct {
+	Time  time.Time `json:"time"`
+	Class string    `json:"class"`
+	Text  string    `json:"text"`
+}
+
+// CameraLogs is the recent ffmpeg output of a camera
+type CameraLogs struct {
+	Lines    []LogLine      `json:"lines"`              // Oldest first
+	Progress string         `json:"progress,omitempty"` // Latest progress line
+	Counts   map[string]int `json:"counts"`             // Lines per class since the camera started
+}
+
+// logRing keeps the most recent stderr lines of a camera across ffmpeg restarts
+type logRing struct {
+	mu       sync.Mutex
+	lines    [logRingSize]LogLine
+	next     int
+	count    int
+	progress string
+	counts   map[string]int
+}
+
+// add records a line. Progress lines only replace the latest progress so they never
+// push errors out of the ring.
+func (r *logRing) add(class, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counts == nil {
+		r.counts = make(map[string]int)
+	}
+	r.counts[class]++
+	if class == LogProgress {
+		r.progress = text
+		return
+	}
+
+	r.lines[r.next] = LogLine{Time: time.Now(), Class: class, Text: text}
+	r.next = (r.next + 1) % logRingSize
+	if r.count < logRingSize {
+		r.count++
+	}
+}
+
+// snapshot returns the stored lines, optionally filtered by class and limited to the newest limit
+func (r *logRing) snapshot(class string, limit int) CameraLogs {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logs := CameraLogs{
+		Lines:    []LogLine{},
+		Progress: r.progress,
+		Counts:   make(map[string]int, len(r.counts)),
+	}
+	for c, n := range r.counts {
+		logs.Counts[c] = n
+	}
+
+	start := (r.next - r.count + logRingSize) % logRingSize
+	for i := 0; i < r.count; i++ {
+		line := r.lines[(start+i)%logRingSize]
+		if class == "" || line.Class == class {
+			logs.Lines = append(logs.Lines, line)
+		}
+	}
+	if limit > 0 && len(logs.Lines) > limit {
+		logs.Lines = logs.Lines[len(logs.Lines)-limit:]
+	}
+	return logs
+}
+
+// classCounts returns the number of lines per class
+func (r *logRing) classCounts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.counts))
+	for c, n := range r.counts {
+		counts[c] = n
+	}
+	return counts
+}
+
+// cameraLogs returns the log ring of a camera, creating it on first use
+func (sm *StreamManager) cameraLogs(cameraID string) *logRing {
+	ring, _ := sm.logs.LoadOrStore(cameraID, &logRing{})
+	return ring.(*logRing)
+}
+
+// GetCameraLogs returns the recent ffmpeg output of a camera.
+// class filters the lines by log class and limit keeps only the newest lines, 0 keeps all.
+func (sm *StreamManager) GetCameraLogs(cameraID, class string, limit int) (CameraLogs, error) {
+	if _, err := sm.GetCamera(cameraID); err != nil {
+		return CameraLogs{}, err
+	}
+	return sm.cameraLogs(cameraID).snapshot(class, limit), nil
+}
+
+// scanLines splits ffmpeg output on \n and on the \r used by progress updates
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readFFmpegLog reads ffmpeg stderr until it closes, recording every line and passing
+// classified errors to onError as they happen. Codec errors are frequent on lossy links and
+// only kept in the log. The source codec is recorded in metrics.
+func readFFmpegLog(stderr io.Reader, backend DecoderBackend, logs *logRing, metrics *streamMetrics, onError func(class, line string)) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 4096), 64*1024)
+	scanner.Split(scanLines)
+	input := false // Inside the "Input #0" section, before the output streams
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Input #"):
+			input = true
+		case strings.HasPrefix(line, "Output #"), strings.HasPrefix(line, "Stream mapping:"):
+			input = false
+		case input:
+			if codec, ok := parseInputCodec(line); ok {
+				metrics.setCodec(codec)
+			}
+		}
+
+		class := classifyFFmpegLine(line, backend)
+		logs.add(class, line)
+		switch class {
+		case LogInfo, LogProgress, LogDropped, LogCodec:
+		default:
+			onError(class, line)
+		}
+	}
+	// Keep draining so ffmpeg never blocks on a full pipe after an overlong line
+	io.Copy(io.Discard, stderr)
+}
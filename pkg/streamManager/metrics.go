@@ -0,0 +1,132 @@
+package streamManager
+
+import (
+	"image"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CameraMetrics reports the live counters of a running stream
+type CameraMetrics struct {
+	InputFPS        float64    `json:"inputFps"`            // Frames per second arriving from the decoder
+	OutputFPS       float64    `json:"outputFps"`           // Frames per second encoded for viewers
+	OutputKbps      float64    `json:"outputKbps"`          // Bitrate of the encoded MJPEG stream
+	FramesOut       uint64     `json:"framesOut"`           // Frames encoded since the stream started
+	FramesThrottled uint64     `json:"framesThrottled"`     // Frames skipped by the frame rate cap
+	CorruptedFrames uint64     `json:"corruptedFrames"`     // JPEG frames from ffmpeg that failed to decode
+	Restarts        uint64     `json:"restarts"`            // Decoder restarts after the first start
+	UptimeSeconds   float64    `json:"uptimeSeconds"`       // Time since the stream started
+	Codec           string     `json:"codec,omitempty"`     // Source video codec reported by ffmpeg
+	Width           int        `json:"width,omitempty"`     // Source frame width
+	Height          int        `json:"height,omitempty"`    // Source frame height
+	BytesSent       uint64     `json:"bytesSent"`           // Bytes written to all viewers
+	LastFrame       *time.Time `json:"lastFrame,omitempty"` // When the last frame was encoded
+}
+
+// streamMetrics holds counters updated on the frame path without taking StreamInfo.mu
+type streamMetrics struct {
+	startedAt time.Time
+	framesOut atomic.Uint64
+	throttled atomic.Uint64
+	corrupted atomic.Uint64
+	restarts  atomic.Uint64
+	bytesSent atomic.Uint64
+
+	mu         sync.Mutex // Guards the fields below
+	lastOutput time.Time
+	outputFPS  float64
+	frameBytes float64 // Smoothed size of an encoded frame
+	codec      string
+	size       image.Point
+}
+
+// recordOutput counts an encoded frame of size bytes and updates the output rate
+func (m *streamMetrics) recordOutput(size int) {
+	m.recordOutputAt(time.Now(), size)
+}
+
+// recordOutputAt is recordOutput for a frame encoded at now
+func (m *streamMetrics) recordOutputAt(now time.Time, size int) {
+	m.framesOut.Add(1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastOutput.IsZero() {
+		if dt := now.Sub(m.lastOutput).Seconds(); dt > 0 {
+			m.outputFPS = smooth(m.outputFPS, 1/dt)
+		}
+	}
+	m.frameBytes = smooth(m.frameBytes, float64(size))
+	m.lastOutput = now
+}
+
+// recordSource records the size of a source frame
+func (m *streamMetrics) recordSource(size image.Point) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.size = size
+}
+
+// setCodec records the source codec
+func (m *streamMetrics) setCodec(codec string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codec = codec
+}
+
+// snapshot returns the current metrics. inputFPS comes from the stream's frame rate tracking.
+func (m *streamMetrics) snapshot(inputFPS float64) CameraMetrics {
+	return m.snapshotAt(inputFPS, time.Now())
+}
+
+// snapshotAt is snapshot taken at now
+func (m *streamMetrics) snapshotAt(inputFPS float64, now time.Time) CameraMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	outputFPS := m.outputFPS
+	// A stalled stream reports 0 instead of its last rate
+	if !m.lastOutput.IsZero() && now.Sub(m.lastOutput) > 5*time.Second {
+		outputFPS = 0
+	}
+
+	metrics := CameraMetrics{
+		InputFPS:        inputFPS,
+		OutputFPS:       outputFPS,
+		OutputKbps:      m.frameBytes * 8 * outputFPS / 1000,
+		FramesOut:       m.framesOut.Load(),
+		FramesThrottled: m.throttled.Load(),
+		CorruptedFrames: m.corrupted.Load(),
+		Restarts:        m.restarts.Load(),
+		UptimeSeconds:   now.Sub(m.startedAt).Seconds(),
+		Codec:           m.codec,
+		Width:           m.size.X,
+		Height:          m.size.Y,
+		BytesSent:       m.bytesSent.Load(),
+	}
+	if !m.lastOutput.IsZero() {
+		last := m.lastOutput
+		metrics.LastFrame = &last
+	}
+	return metrics
+}
+
+// parseInputCodec extracts the codec from an ffmpeg input stream line such as
+// "Stream #0:0: Video: h264 (Main), yuv420p(progressive), 1920x1080, 25 fps"
+func parseInputCodec(line string) (string, bool) {
+	if !strings.Contains(line, "Stream #") {
+		return "", false
+	}
+	_, rest, ok := strings.Cut(line, "Video: ")
+	if !ok {
+		return "", false
+	}
+	codec := strings.FieldsFunc(rest, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(codec) == 0 {
+		return "", false
+	}
+	return codec[0], true
+}
@@ -0,0 +1,150 @@
+package streamManager
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInputCodec(t *testing.T) {
+	tests := []struct {
+		line  string
+		codec string
+		ok    bool
+	}{
+		{line: "Stream #0:0: Video: h264 (Main), yuv420p(progressive), 1920x1080, 25 fps", codec: "h264", ok: true},
+		{line: "Stream #0:0: Video: hevc, yuvj420p(pc), 2560x1440, 20 tbr", codec: "hevc", ok: true},
+		{line: "Stream #0:1: Audio: aac (LC), 16000 Hz, mono, fltp"},
+		{line: "Duration: N/A, start: 0.000000, bitrate: N/A"},
+	}
+
+	for _, test := range tests {
+		codec, ok := parseInputCodec(test.line)
+		if codec != test.codec || ok != test.ok {
+			t.Errorf("parseInputCodec(%q) = %q, %v, want %q, %v", test.line, codec, ok, test.codec, test.ok)
+		}
+	}
+}
+
+func TestReadFFmpegLogCodec(t *testing.T) {
+	stderr := `Input #0, rtsp, from 'rtsp://camera/stream':
+  Stream #0:0: Video: h264 (High), yuv420p(progressive), 1280x720, 15 fps
+Stream mapping:
+  Stream #0:0 -> #0:0 (h264 (native) -> mjpeg (native))
+Output #0, image2pipe, to 'pipe:':
+  Stream #0:0: Video: mjpeg, yuvj420p(pc), 1280x720, q=2-31
+`
+	var metrics streamMetrics
+	readFFmpegLog(strings.NewReader(stderr), cpuBackend{}, &logRing{}, &metrics, func(class, line string) {})
+	if got := metrics.snapshot(0).Codec; got != "h264" {
+		t.Errorf("codec = %q, want h264", got)
+	}
+}
+
+func TestStreamMetricsSnapshot(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	m := &streamMetrics{startedAt: start}
+
+	// Ten 5 kB frames at 10 fps, one corrupted frame and one decoder restart
+	for i := 0; i < 10; i++ {
+		m.recordOutputAt(start.Add(time.Duration(i)*100*time.Millisecond), 5000)
+	}
+	m.corrupted.Add(1)
+	m.restarts.Add(1)
+	m.bytesSent.Add(12345)
+	m.recordSource(image.Pt(1920, 1080))
+
+	got := m.snapshotAt(25, start.Add(time.Second))
+	if got.FramesOut != 10 || got.CorruptedFrames != 1 || got.Restarts != 1 || got.BytesSent != 12345 {
+		t.Errorf("counters %+v, want 10 frames, 1 corrupted, 1 restart and 12345 bytes", got)
+	}
+	if got.InputFPS != 25 || math.Abs(got.OutputFPS-10) > 0.01 {
+		t.Errorf("input %.2f fps, output %.2f fps, want 25 and 10", got.InputFPS, got.OutputFPS)
+	}
+	if math.Abs(got.OutputKbps-400) > 0.5 {
+		t.Errorf("bitrate %.1f kbps, want 400", got.OutputKbps)
+	}
+	if got.UptimeSeconds != 1 || got.Width != 1920 || got.Height != 1080 {
+		t.Errorf("uptime %.1fs at %dx%d, want 1s at 1920x1080", got.UptimeSeconds, got.Width, got.Height)
+	}
+	if got.LastFrame == nil || !got.LastFrame.Equal(start.Add(900*time.Millisecond)) {
+		t.Errorf("last frame %v, want %v", got.LastFrame, start.Add(900*time.Millisecond))
+	}
+
+	// A stalled stream reports no output rate but keeps its counters
+	stalled := m.snapshotAt(25, start.Add(time.Minute))
+	if stalled.OutputFPS != 0 || stalled.OutputKbps != 0 || stalled.FramesOut != 10 {
+		t.Errorf("stalled stream reports %.1f fps, %.1f kbps and %d frames, want 0, 0 and 10", stalled.OutputFPS, stalled.OutputKbps, stalled.FramesOut)
+	}
+}
+
+func TestCameraMetricsEndpoints(t *testing.T) {
+	sm := &StreamManager{
+		config: &Config{Cameras: []Camera{{ID: "cam", Enabled: true}, {ID: "off"}}},
+		uptime: newMemoryUptimeLog(),
+		gpus:   newGPUPool(nil),
+	}
+	sm.metrics = sm.newMetricsRegistry()
+	info := &StreamInfo{camera: &Camera{ID: "cam"}, ViewerCount: 2}
+	info.metrics.startedAt = time.Now()
+	sm.streams.Store("cam", info)
+
+	// Drive the counters the way the frame path does
+	start := time.Now()
+	info.rate.targetFPS = 5
+	for i := 0; i < 10; i++ {
+		if info.allowFrameAt(start.Add(time.Duration(i) * 100 * time.Millisecond)) {
+			info.metrics.recordOutput(1000)
+		}
+	}
+	queue := make(frameQueue, 1)
+	for i := 0; i < 4; i++ {
+		info.recordDrops(queue.push(&pipelineFrame{}))
+	}
+	info.metrics.restarts.Add(2)
+
+	recorder := httptest.NewRecorder()
+	sm.handleGetStatus(recorder, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	var statuses []CameraStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Metrics == nil || statuses[0].Pipeline == nil {
+		t.Fatalf("status %+v, want metrics for the streaming camera", statuses)
+	}
+	if statuses[1].Metrics != nil {
+		t.Error("stopped camera reports stream metrics")
+	}
+	metrics, pipeline := statuses[0].Metrics, statuses[0].Pipeline
+	if metrics.FramesOut != 5 || metrics.FramesThrottled != 5 || metrics.Restarts != 2 || pipeline.Dropped != 3 {
+		t.Errorf("status reports %d frames, %d throttled, %d restarts and %d dropped, want 5, 5, 2 and 3",
+			metrics.FramesOut, metrics.FramesThrottled, metrics.Restarts, pipeline.Dropped)
+	}
+
+	var out bytes.Buffer
+	if _, err := sm.metrics.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`firescrew_camera_streaming{camera="cam"} 1`,
+		`firescrew_camera_streaming{camera="off"} 0`,
+		`firescrew_camera_viewers{camera="cam"} 2`,
+		`firescrew_camera_frames_total{camera="cam"} 5`,
+		`firescrew_camera_frames_throttled_total{camera="cam"} 5`,
+		`firescrew_camera_frames_dropped_total{camera="cam"} 3`,
+		`firescrew_camera_restarts_total{camera="cam"} 2`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("metrics missing %s", line)
+		}
+	}
+	if strings.Contains(out.String(), `firescrew_camera_frames_total{camera="off"}`) {
+		t.Error("stopped camera has a frame counter")
+	}
+}
@@ -0,0 +1,229 @@
+package streamManager
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Streaming modes for a camera
+const (
+	ModeAlwaysOn  = "always-on" // Decode continuously while enabled (default)
+	ModeOnDemand  = "on-demand" // Start on first viewer, stop after the idle timeout
+	ModeScheduled = "scheduled" // Decode during schedule windows, on-demand outside them
+)
+
+// scheduleInterval is how often scheduled cameras are started or stopped
+const scheduleInterval = 30 * time.Second
+
+// weekdays are the accepted schedule day names
+var weekdays = map[string]bool{"mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true, "sun": true}
+
+// ScheduleWindow is a daily time range during which a scheduled camera runs
+type ScheduleWindow struct {
+	Days  []string `json:"days,omitempty"` // "mon" ... "sun", empty means every day
+	Start string   `json:"start"`          // "HH:MM" local time
+	End   string   `json:"end"`            // "HH:MM" local time, earlier than start to span midnight
+}
+
+// streamMode returns the camera's streaming mode, defaulting to always-on
+func (c *Camera) streamMode() string {
+	if c.Mode == "" {
+		return ModeAlwaysOn
+	}
+	return c.Mode
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether the window covers the given time
+func (w ScheduleWindow) contains(now time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	day := now
+	if start > end && minute < end {
+		// Early morning part of a window that started the previous day
+		day = now.AddDate(0, 0, -1)
+	}
+
+	if len(w.Days) > 0 {
+		weekday := strings.ToLower(day.Weekday().String()[:3])
+		found := false
+		for _, d := range w.Days {
+			if strings.ToLower(d) == weekday {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// validateMode checks the camera's streaming mode and schedule
+func validateMode(camera Camera) error {
+	switch camera.streamMode() {
+	case ModeAlwaysOn, ModeOnDemand:
+	case ModeScheduled:
+		if len(camera.Schedule) == 0 {
+			return fmt.Errorf("scheduled mode requires at least one schedule window")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", camera.Mode)
+	}
+
+	for i, w := range camera.Schedule {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return fmt.Errorf("schedule %d: %w", i, err)
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return fmt.Errorf("schedule %d: %w", i, err)
+		}
+		if start == end {
+			// The window would never match
+			return fmt.Errorf("schedule %d: start and end must differ", i)
+		}
+		for _, d := range w.Days {
+			if !weekdays[strings.ToLower(d)] {
+				return fmt.Errorf("schedule %d: invalid day %q", i, d)
+			}
+		}
+	}
+	return nil
+}
+
+// shouldRun reports whether an enabled camera should be decoding without viewers
+func (c *Camera) shouldRun(now time.Time) bool {
+	switch c.streamMode() {
+	case ModeAlwaysOn:
+		return true
+	case ModeScheduled:
+		for _, w := range c.Schedule {
+			if w.contains(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cameraIdleTimeout returns how long a stream may run without viewers
+func (sm *StreamManager) cameraIdleTimeout(camera *Camera) time.Duration {
+	if camera.IdleTimeout > 0 {
+		return time.Duration(camera.IdleTimeout) * time.Second
+	}
+	return sm.idleTimeout
+}
+
+// Start starts every camera that should be running, the schedule loop, MQTT commands, Home Assistant discovery and frame rate adaptation
+func (sm *StreamManager) Start() {
+	now := time.Now()
+	for _, camera := range sm.GetAllCameras() {
+		if camera.Enabled && camera.shouldRun(now) {
+			if err := sm.StartStream(camera.ID); err != nil {
+				log.Printf("Failed to start stream for camera %s: %v", camera.ID, err)
+			}
+		}
+	}
+
+	go sm.runScheduler()
+	sm.subscribeCommands()
+	sm.startHomeAssistant()
+
+	if adaptive := sm.GetConfig().Adaptive; adaptive != nil && adaptive.Enabled {
+		go sm.runAdaptiveFPS(*adaptive)
+	}
+}
+
+// runScheduler starts scheduled cameras when their window opens and
+// lets them stop once it closes and nobody is watching
+func (sm *StreamManager) runScheduler() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, camera := range sm.GetAllCameras() {
+			if !camera.Enabled || camera.streamMode() != ModeScheduled {
+				continue
+			}
+
+			_, err := sm.GetStreamInfo(camera.ID)
+			running := err == nil
+			if camera.shouldRun(now) && !running {
+				log.Printf("Schedule window opened for camera %s, starting stream", camera.ID)
+				if err := sm.StartStream(camera.ID); err != nil {
+					log.Printf("Failed to start scheduled stream for camera %s: %v", camera.ID, err)
+				}
+			} else if !camera.shouldRun(now) && running {
+				sm.checkIdle(camera.ID)
+			}
+		}
+	}
+}
+
+// checkIdle schedules an idle stop for a stream if nothing needs it
+func (sm *StreamManager) checkIdle(cameraID string) {
+	streamInfo, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return
+	}
+
+	streamInfo.mu.Lock()
+	defer streamInfo.mu.Unlock()
+	sm.scheduleIdleStop(streamInfo)
+}
+
+// scheduleIdleStop stops a stream after its idle timeout if it has no viewers,
+// no virtual cameras attached and is not required to run.
+// The caller must hold streamInfo.mu, but not sm.mu.
+func (sm *StreamManager) scheduleIdleStop(streamInfo *StreamInfo) {
+	camera := streamInfo.camera
+	cameraID := camera.ID
+	if streamInfo.ViewerCount > 0 || len(streamInfo.subscribers) > 0 || camera.shouldRun(time.Now()) {
+		return
+	}
+
+	// Cancel any existing timer
+	if streamInfo.StopTimer != nil {
+		streamInfo.StopTimer.Stop()
+	}
+
+	// Schedule stream stop after idle timeout
+	timeout := sm.cameraIdleTimeout(camera)
+	streamInfo.StopTimer = time.AfterFunc(timeout, func() {
+		streamInfo.mu.Lock()
+		idle := streamInfo.ViewerCount == 0 && len(streamInfo.subscribers) == 0
+		// The mode or schedule may have changed since the timer started
+		required := streamInfo.camera.shouldRun(time.Now())
+		streamInfo.mu.Unlock()
+
+		if idle && !required {
+			log.Printf("No viewers for %v, stopping stream for camera: %s", timeout, cameraID)
+			sm.stopStreamInfo(cameraID, streamInfo)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package streamManager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day int, clock string) time.Time {
+		minutes, err := parseClock(clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, 10, day, minutes/60, minutes%60, 30, 0, time.Local)
+	}
+	friNight := ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+	weekdays := ScheduleWindow{Days: []string{"Mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"}
+	nightly := ScheduleWindow{Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name   string
+		window ScheduleWindow
+		now    time.Time
+		want   bool
+	}{
+		{name: "same day inside", window: weekdays, now: at(16, "12:00"), want: true},
+		{name: "same day at start", window: weekdays, now: at(16, "08:00"), want: true},
+		{name: "same day at end", window: weekdays, now: at(16, "18:00"), want: false},
+		{name: "same day before start", window: weekdays, now: at(16, "07:59"), want: false},
+		{name: "same day on an excluded day", window: weekdays, now: at(17, "12:00"), want: false},
+		{name: "day names ignore case", window: weekdays, now: at(12, "09:00"), want: true},
+
+		{name: "overnight evening part", window: friNight, now: at(16, "23:00"), want: true},
+		{name: "overnight at start", window: friNight, now: at(16, "22:00"), want: true},
+		{name: "overnight morning part belongs to the previous day", window: friNight, now: at(17, "03:00"), want: true},
+		{name: "overnight morning before the window started", window: friNight, now: at(16, "03:00"), want: false},
+		{name: "overnight at end", window: friNight, now: at(17, "06:00"), want: false},
+		{name: "overnight evening on the next day", window: friNight, now: at(17, "23:00"), want: false},
+		{name: "overnight between the parts", window: friNight, now: at(16, "12:00"), want: false},
+
+		{name: "overnight every day morning", window: nightly, now: at(14, "05:59"), want: true},
+		{name: "overnight every day evening", window: nightly, now: at(14, "22:30"), want: true},
+		{name: "overnight every day midday", window: nightly, now: at(14, "14:00"), want: false},
+
+		{name: "invalid start", window: ScheduleWindow{Start: "25:00", End: "06:00"}, now: at(16, "03:00"), want: false},
+	}
+
+	for _, test := range tests {
+		if got := test.window.contains(test.now); got != test.want {
+			t.Errorf("%s: contains %s = %v, want %v", test.name, test.now.Format("Mon 15:04"), got, test.want)
+		}
+	}
+}
+
+func TestShouldRun(t *testing.T) {
+	night := time.Date(2026, 10, 17, 3, 0, 0, 0, time.Local) // Saturday
+	schedule := []ScheduleWindow{
+		{Days: []string{"sat", "sun"}, Start: "10:00", End: "16:00"},
+		{Days: []string{"fri"}, Start: "22:00", End: "06:00"},
+	}
+
+	tests := []struct {
+		name   string
+		camera Camera
+		want   bool
+	}{
+		{name: "always-on by default", camera: Camera{}, want: true},
+		{name: "on-demand", camera: Camera{Mode: ModeOnDemand}, want: false},
+		{name: "scheduled inside a window", camera: Camera{Mode: ModeScheduled, Schedule: schedule}, want: true},
+		{name: "scheduled outside every window", camera: Camera{Mode: ModeScheduled, Schedule: schedule[:1]}, want: false},
+	}
+
+	for _, test := range tests {
+		if got := test.camera.shouldRun(night); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		camera Camera
+		valid  bool
+	}{
+		{name: "default", camera: Camera{}, valid: true},
+		{name: "unknown mode", camera: Camera{Mode: "sometimes"}},
+		{name: "scheduled without windows", camera: Camera{Mode: ModeScheduled}},
+		{name: "overnight window", camera: Camera{Mode: ModeScheduled, Schedule: []ScheduleWindow{{Start: "22:00", End: "06:00"}}}, valid: true},
+		{name: "invalid time", camera: Camera{Mode: ModeScheduled, Schedule: []ScheduleWindow{{Start: "7am", End: "06:00"}}}},
+		{name: "invalid day", camera: Camera{Mode: ModeScheduled, Schedule: []ScheduleWindow{{Days: []string{"friday"}, Start: "08:00", End: "09:00"}}}},
+		{name: "empty window", camera: Camera{Mode: ModeScheduled, Schedule: []ScheduleWindow{{Start: "08:00", End: "08:00"}}}},
+	}
+
+	for _, test := range tests {
+		err := validateMode(test.camera)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
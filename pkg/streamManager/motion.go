@@ -0,0 +1,197 @@
+package streamManager
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"time"
+)
+
+// Motion detector defaults
+const (
+	defaultMotionThreshold = 25   // Luma difference for a pixel to count as changed
+	defaultMotionMinArea   = 0.01 // Fraction of changed pixels that counts as motion
+	defaultMotionHold      = 10   // Seconds motion stays active after the last change
+
+	motionThumbWidth  = 80 // Width of the thumbnail frames are compared at
+	motionThumbHeight = 45 // Height of the thumbnail frames are compared at
+)
+
+// MotionConfig configures frame-difference motion detection for a camera
+type MotionConfig struct {
+	Enabled   bool    `json:"enabled"`
+	Threshold int     `json:"threshold,omitempty"` // Luma difference per pixel, default 25
+	MinArea   float64 `json:"minArea,omitempty"`   // Fraction of changed pixels, default 0.01
+	Hold      int     `json:"hold,omitempty"`      // Seconds motion stays active after the last change, default 10
+	Zones     []Rect  `json:"zones,omitempty"`     // Only changes inside these frame regions count, default the whole frame
+}
+
+// validateMotion checks a camera's motion zones
+func validateMotion(camera Camera) error {
+	if camera.Motion == nil {
+		return nil
+	}
+	for i, zone := range camera.Motion.Zones {
+		if zone.Width <= 0 || zone.Height <= 0 || zone.X < 0 || zone.Y < 0 {
+			return fmt.Errorf("motion zone %d: invalid rectangle %+v", i, zone)
+		}
+	}
+	return nil
+}
+
+// motionDetector compares consecutive frames at thumbnail resolution
+type motionDetector struct {
+	prev       []uint8
+	active     bool
+	lastMotion time.Time
+}
+
+// thumbnail samples an image into a small grayscale buffer
+func thumbnail(img *image.RGBA) []uint8 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	thumb := make([]uint8, motionThumbWidth*motionThumbHeight)
+	if w == 0 || h == 0 {
+		return thumb
+	}
+
+	for ty := 0; ty < motionThumbHeight; ty++ {
+		y := b.Min.Y + ty*h/motionThumbHeight
+		for tx := 0; tx < motionThumbWidth; tx++ {
+			x := b.Min.X + tx*w/motionThumbWidth
+			o := img.PixOffset(x, y)
+			r, g, bl := int(img.Pix[o]), int(img.Pix[o+1]), int(img.Pix[o+2])
+			thumb[ty*motionThumbWidth+tx] = uint8((299*r + 587*g + 114*bl) / 1000)
+		}
+	}
+	return thumb
+}
+
+// zoneMask marks the thumbnail pixels sampled from inside any zone, nil means the whole frame
+func zoneMask(b image.Rectangle, zones []Rect) []bool {
+	if len(zones) == 0 {
+		return nil
+	}
+	w, h := b.Dx(), b.Dy()
+	mask := make([]bool, motionThumbWidth*motionThumbHeight)
+	for ty := 0; ty < motionThumbHeight; ty++ {
+		y := ty * h / motionThumbHeight
+		for tx := 0; tx < motionThumbWidth; tx++ {
+			x := tx * w / motionThumbWidth
+			for _, zone := range zones {
+				if x >= zone.X && x < zone.X+zone.Width && y >= zone.Y && y < zone.Y+zone.Height {
+					mask[ty*motionThumbWidth+tx] = true
+					break
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// update feeds a frame to the detector and reports whether the motion state changed
+func (d *motionDetector) update(img *image.RGBA, cfg MotionConfig, now time.Time) bool {
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = defaultMotionThreshold
+	}
+	minArea := cfg.MinArea
+	if minArea <= 0 {
+		minArea = defaultMotionMinArea
+	}
+	hold := time.Duration(cfg.Hold) * time.Second
+	if hold <= 0 {
+		hold = defaultMotionHold * time.Second
+	}
+
+	thumb := thumbnail(img)
+	prev := d.prev
+	d.prev = thumb
+
+	moving := false
+	if prev != nil {
+		mask := zoneMask(img.Bounds(), cfg.Zones)
+		changed, area := 0, 0
+		for i := range thumb {
+			if mask != nil && !mask[i] {
+				continue
+			}
+			area++
+			diff := int(thumb[i]) - int(prev[i])
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > threshold {
+				changed++
+			}
+		}
+		moving = area > 0 && float64(changed)/float64(area) >= minArea
+	}
+
+	if moving {
+		d.lastMotion = now
+		if !d.active {
+			d.active = true
+			return true
+		}
+		return false
+	}
+
+	if d.active && now.Sub(d.lastMotion) > hold {
+		d.active = false
+		return true
+	}
+	return false
+}
+
+// detectMotion runs motion detection on a transformed frame
+func (sm *StreamManager) detectMotion(camera *Camera, info *StreamInfo, img *image.RGBA) {
+	if camera.Motion == nil || !camera.Motion.Enabled {
+		// Disarmed during motion: end it, nothing else will
+		info.mu.Lock()
+		wasActive := info.motion.active
+		info.motion = motionDetector{}
+		info.mu.Unlock()
+		if wasActive {
+			sm.motionChanged(camera.ID, info, false)
+		}
+		return
+	}
+
+	info.mu.Lock()
+	changed := info.motion.update(img, *camera.Motion, time.Now())
+	active := info.motion.active
+	info.mu.Unlock()
+
+	if changed {
+		sm.motionChanged(camera.ID, info, active)
+	}
+}
+
+// motionChanged publishes the start or end of motion on a camera
+func (sm *StreamManager) motionChanged(cameraID string, info *StreamInfo, active bool) {
+	if active {
+		log.Printf("Motion started on camera %s", cameraID)
+	} else {
+		log.Printf("Motion ended on camera %s", cameraID)
+	}
+	sm.emit(EventMotion, cameraID, map[string]any{"active": active})
+	if active {
+		sm.notify(EventMotionStart, cameraID, nil)
+	} else {
+		sm.notify(EventMotionEnd, cameraID, nil)
+	}
+	info.requestDecodeCheck()
+}
+
+// MotionActive reports whether motion is currently detected on a camera
+func (sm *StreamManager) MotionActive(cameraID string) bool {
+	streamInfo, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return false
+	}
+
+	streamInfo.mu.Lock()
+	defer streamInfo.mu.Unlock()
+	return streamInfo.motion.active
+}
@@ -0,0 +1,177 @@
+package streamManager
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+)
+
+// grayFrame returns a 160x90 frame, twice the thumbnail size, filled with one gray level
+// and an optional block of another level
+func grayFrame(background uint8, block image.Rectangle, level uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2*motionThumbWidth, 2*motionThumbHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: background}), image.Point{}, draw.Src)
+	draw.Draw(img, block, image.NewUniform(color.Gray{Y: level}), image.Point{}, draw.Src)
+	return img
+}
+
+func TestMotionDetectorThresholds(t *testing.T) {
+	still := grayFrame(100, image.Rectangle{}, 0)
+	small := image.Rect(10, 10, 20, 20) // 0.7% of the frame
+	large := image.Rect(10, 10, 30, 30) // 2.8% of the frame
+
+	tests := []struct {
+		name string
+		cfg  MotionConfig
+		next *image.RGBA
+		want bool
+	}{
+		{name: "no change", next: still},
+		{name: "change below the threshold", next: grayFrame(120, image.Rectangle{}, 0)},
+		{name: "change above a lower threshold", cfg: MotionConfig{Threshold: 10}, next: grayFrame(120, image.Rectangle{}, 0), want: true},
+		{name: "change at the threshold", cfg: MotionConfig{Threshold: 20}, next: grayFrame(120, image.Rectangle{}, 0)},
+		{name: "large block", next: grayFrame(100, large, 250), want: true},
+		{name: "small block below the minimum area", next: grayFrame(100, small, 250)},
+		{name: "small block above a lower minimum area", cfg: MotionConfig{MinArea: 0.005}, next: grayFrame(100, small, 250), want: true},
+
+		// The left half of the frame is x 0-79
+		{name: "change outside the zone", cfg: MotionConfig{Zones: []Rect{{X: 80, Width: 80, Height: 90}}}, next: grayFrame(100, large, 250)},
+		{name: "change inside the zone", cfg: MotionConfig{Zones: []Rect{{Width: 80, Height: 90}}}, next: grayFrame(100, large, 250), want: true},
+		{name: "change inside the second zone", cfg: MotionConfig{Zones: []Rect{{X: 120, Width: 40, Height: 40}, {Width: 40, Height: 40}}}, next: grayFrame(100, large, 250), want: true},
+		{name: "minimum area relative to the zone", cfg: MotionConfig{Zones: []Rect{{Width: 40, Height: 40}}}, next: grayFrame(100, small, 250), want: true},
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		var d motionDetector
+		if d.update(still, test.cfg, now) || d.active {
+			t.Errorf("%s: motion on the first frame", test.name)
+		}
+		changed := d.update(test.next, test.cfg, now.Add(time.Second))
+		if d.active != test.want || changed != test.want {
+			t.Errorf("%s: active %v, changed %v, want %v", test.name, d.active, changed, test.want)
+		}
+	}
+}
+
+func TestMotionDetectorHold(t *testing.T) {
+	cfg := MotionConfig{Hold: 10}
+	still := grayFrame(100, image.Rectangle{}, 0)
+	moved := grayFrame(100, image.Rect(0, 0, 40, 40), 250)
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	var d motionDetector
+	d.update(still, cfg, start)
+	if !d.update(moved, cfg, start.Add(time.Second)) {
+		t.Fatal("motion did not start")
+	}
+
+	// Motion stays active for hold seconds after the last change
+	steps := []struct {
+		after   time.Duration
+		frame   *image.RGBA
+		changed bool
+		active  bool
+	}{
+		{after: 2 * time.Second, frame: moved, active: true},
+		{after: 11 * time.Second, frame: moved, active: true},
+		{after: 12 * time.Second, frame: moved, changed: true},
+		{after: 13 * time.Second, frame: still, changed: true, active: true}, // Moving back is a change too
+		{after: 23 * time.Second, frame: still, active: true},
+		{after: 24 * time.Second, frame: still, changed: true},
+		{after: 30 * time.Second, frame: still},
+	}
+	for _, step := range steps {
+		changed := d.update(step.frame, cfg, start.Add(step.after))
+		if changed != step.changed || d.active != step.active {
+			t.Errorf("after %v: changed %v, active %v, want %v, %v", step.after, changed, d.active, step.changed, step.active)
+		}
+	}
+}
+
+func TestValidateMotion(t *testing.T) {
+	tests := []struct {
+		name   string
+		motion *MotionConfig
+		valid  bool
+	}{
+		{name: "none", valid: true},
+		{name: "whole frame", motion: &MotionConfig{Enabled: true}, valid: true},
+		{name: "zone", motion: &MotionConfig{Zones: []Rect{{X: 10, Y: 10, Width: 100, Height: 50}}}, valid: true},
+		{name: "empty zone", motion: &MotionConfig{Zones: []Rect{{Width: 100}}}},
+		{name: "zone outside the frame", motion: &MotionConfig{Zones: []Rect{{X: -1, Width: 100, Height: 50}}}},
+	}
+
+	for _, test := range tests {
+		err := validateMotion(Camera{Motion: test.motion})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestDisarmEndsMotion(t *testing.T) {
+	sinks, err := eventSinks.New(eventSinks.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sinks.Close()
+	sm := &StreamManager{
+		config:     &Config{Cameras: []Camera{{ID: "cam", Motion: &MotionConfig{Enabled: true}}}},
+		events:     newEventBus(),
+		sinks:      sinks,
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+	}
+	camera, _ := sm.GetCamera("cam")
+	info := &StreamInfo{camera: camera, subscribers: make(map[chan *image.RGBA]struct{}), decodeCheck: make(chan struct{}, 1)}
+	sm.streams.Store("cam", info)
+
+	sm.detectMotion(camera, info, grayFrame(100, image.Rectangle{}, 0))
+	sm.detectMotion(camera, info, grayFrame(100, image.Rect(0, 0, 40, 40), 250))
+	if !sm.MotionActive("cam") {
+		t.Fatal("motion did not start")
+	}
+	<-info.decodeCheck
+
+	// Disarm while motion is active, as the disarm command does
+	events, _, _ := sm.events.subscribe("", 0)
+	defer sm.events.unsubscribe(events)
+	if _, err := sm.ExecuteCommand("cam", CameraCommand{Action: CommandDisarm}); err != nil {
+		t.Fatal(err)
+	}
+	camera = info.cameraConfig()
+	if camera.Motion.Enabled {
+		t.Fatal("camera still armed")
+	}
+	sm.detectMotion(camera, info, grayFrame(100, image.Rectangle{}, 0))
+
+	if sm.MotionActive("cam") {
+		t.Error("motion still active after disarming")
+	}
+	select {
+	case <-info.decodeCheck:
+	default:
+		t.Error("decode mode not re-checked when motion ended")
+	}
+	ended := false
+	for len(events) > 0 {
+		e := <-events
+		if e.Type == EventMotion && e.Data["active"] == false {
+			ended = true
+		}
+	}
+	if !ended {
+		t.Error("no motion event with active false after disarming")
+	}
+
+	// Later frames of a disarmed camera send nothing
+	sm.detectMotion(camera, info, grayFrame(100, image.Rect(0, 0, 40, 40), 250))
+	if len(events) != 0 || sm.MotionActive("cam") {
+		t.Error("disarmed camera reported motion")
+	}
+}
@@ -0,0 +1,88 @@
+package streamManager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/notifier"
+)
+
+// notificationTimeout bounds sending one event to all notifiers, including waiting for the snapshot
+const notificationTimeout = time.Minute
+
+// notificationSnapshotWait is how long a motion notification waits for a frame to attach
+const notificationSnapshotWait = 5 * time.Second
+
+// notificationText returns the title, text and priority of an event's notification
+func notificationText(eventType, camera string, data map[string]any) (string, string, notifier.Priority) {
+	switch eventType {
+	case EventCameraOffline:
+		text := camera + " is offline"
+		if reason, ok := data["reason"].(string); ok && reason != "" {
+			text += ": " + reason
+		}
+		return "Camera offline", text, notifier.PriorityHigh
+	case EventStreamStalled:
+		return "Stream stalled", fmt.Sprintf("%s sent no frames for %v seconds", camera, data["seconds"]), notifier.PriorityHigh
+	case EventCameraOnline:
+		return "Camera online", camera + " is streaming again", notifier.PriorityLow
+	case EventMotionStart:
+		return "Motion detected", "Motion on " + camera, notifier.PriorityNormal
+	case EventMotionEnd:
+		return "Motion ended", "Motion on " + camera + " ended", notifier.PriorityLow
+	case EventConfigChanged:
+		return "Camera config changed", fmt.Sprintf("%s was %v", camera, data["action"]), notifier.PriorityLow
+	}
+	return eventType, camera, notifier.PriorityNormal
+}
+
+// sendNotification sends an event to the notifiers routed to it in the background.
+// cameraName may be empty, it is then looked up. Without an attachment motion_start
+// notifications attach the current frame.
+func (sm *StreamManager) sendNotification(eventType, cameraID, cameraName string, data map[string]any, attachment *notifier.Attachment) {
+	if !sm.notifiers.Wants(eventType, cameraID) {
+		return
+	}
+	// The caller may hold sm.mu, the camera is looked up on another goroutine
+	go func() {
+		if cameraName == "" {
+			cameraName = cameraID
+			if camera, err := sm.GetCamera(cameraID); err == nil && camera.Name != "" {
+				cameraName = camera.Name
+			}
+		}
+		title, text, priority := notificationText(eventType, cameraName, data)
+		m := notifier.Message{Title: title, Text: text, Priority: priority,
+			EventType: eventType, CameraID: cameraID, CameraName: cameraName, Time: time.Now()}
+		if zone, ok := data["zone"].(string); ok {
+			m.Zone = zone
+		}
+		m.Attachment = attachment
+		if eventType == EventMotionStart && attachment == nil {
+			if jpeg := sm.currentFrame(cameraID, notificationSnapshotWait); jpeg != nil {
+				m.Attachment = &notifier.Attachment{Name: "snapshot.jpg", ContentType: "image/jpeg", Data: jpeg}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+		sm.notifiers.Notify(ctx, m)
+	}()
+}
+
+// currentFrame returns the next encoded frame of a running stream, or nil if the camera is not
+// streaming or no frame arrives in time. Unlike Snapshot it never starts a stream.
+func (sm *StreamManager) currentFrame(cameraID string, wait time.Duration) []byte {
+	info, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return nil
+	}
+	select {
+	case data := <-info.requestSnapshot():
+		return data
+	case <-info.stop:
+	case <-time.After(wait):
+	}
+	return nil
+}
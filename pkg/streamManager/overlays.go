@@ -0,0 +1,141 @@
+package streamManager
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifetime of overlays added at runtime
+const (
+	defaultOverlayTTL = 10 * time.Second
+	maxOverlayTTL     = time.Hour
+)
+
+// Limits on runtime overlays per camera, so a chatty publisher cannot slow down rendering
+const (
+	maxOverlays        = 32  // Active overlays
+	maxOverlayElements = 256 // Elements across all active overlays
+
+	// Drawing cost grows with these, thick lines and large text are redrawn on every frame
+	maxOverlayFontSize  = 200  // Text is drawn (fontSize/13)² times
+	maxOverlayThickness = 50   // Each line point is drawn thickness² times
+	maxOverlayPoints    = 1000 // Points of a polyline
+	maxOverlayText      = 256  // Characters of a text element
+	maxOverlayCoord     = maxDewarpSide
+)
+
+// validateOverlayElement rejects element types that cannot be drawn and sizes that would
+// stall the render stage
+func validateOverlayElement(elem DrawElement) error {
+	switch elem.Type {
+	case "rectangle", "polyline", "text":
+	default:
+		return fmt.Errorf("invalid overlay element type: %q", elem.Type)
+	}
+	if elem.FontSize < 0 || elem.FontSize > maxOverlayFontSize {
+		return fmt.Errorf("overlay font size %d out of range 0-%d", elem.FontSize, maxOverlayFontSize)
+	}
+	if elem.Thickness < 0 || elem.Thickness > maxOverlayThickness {
+		return fmt.Errorf("overlay thickness %d out of range 0-%d", elem.Thickness, maxOverlayThickness)
+	}
+	if len(elem.Points) > maxOverlayPoints {
+		return fmt.Errorf("overlay element has %d points, at most %d allowed", len(elem.Points), maxOverlayPoints)
+	}
+	if len(elem.Text) > maxOverlayText {
+		return fmt.Errorf("overlay text is %d bytes, at most %d allowed", len(elem.Text), maxOverlayText)
+	}
+	for _, p := range elem.Points {
+		if p.X < 0 || p.Y < 0 || p.X > maxOverlayCoord || p.Y > maxOverlayCoord {
+			return fmt.Errorf("overlay point (%d, %d) out of range 0-%d", p.X, p.Y, maxOverlayCoord)
+		}
+	}
+	return nil
+}
+
+// timedOverlay is a set of drawing elements shown until it expires
+type timedOverlay struct {
+	elements []DrawElement
+	expires  time.Time
+}
+
+// AddOverlay draws elements on a running stream for ttl, default 10 seconds.
+// Overlays are not saved to the config and end with the stream.
+func (sm *StreamManager) AddOverlay(cameraID string, elements []DrawElement, ttl time.Duration) error {
+	if len(elements) == 0 {
+		return fmt.Errorf("no overlay elements")
+	}
+	if len(elements) > maxOverlayElements {
+		return fmt.Errorf("overlay has %d elements, at most %d allowed", len(elements), maxOverlayElements)
+	}
+	for _, elem := range elements {
+		if err := validateOverlayElement(elem); err != nil {
+			return err
+		}
+	}
+	info, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		ttl = defaultOverlayTTL
+	}
+	if ttl > maxOverlayTTL {
+		ttl = maxOverlayTTL
+	}
+	now := time.Now()
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	// Expired overlays do not count against the limits
+	info.dropExpiredOverlays(now)
+	active := 0
+	for _, o := range info.overlays {
+		active += len(o.elements)
+	}
+	if len(info.overlays) >= maxOverlays {
+		return fmt.Errorf("camera %s already has %d active overlays", cameraID, len(info.overlays))
+	}
+	if active+len(elements) > maxOverlayElements {
+		return fmt.Errorf("camera %s has %d active overlay elements, adding %d exceeds the limit of %d",
+			cameraID, active, len(elements), maxOverlayElements)
+	}
+	info.overlays = append(info.overlays, timedOverlay{elements: elements, expires: now.Add(ttl)})
+	return nil
+}
+
+// ClearOverlays removes the overlays added at runtime
+func (sm *StreamManager) ClearOverlays(cameraID string) error {
+	info, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return err
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.overlays = nil
+	return nil
+}
+
+// activeOverlays drops expired overlays and returns the elements of the others
+func (si *StreamInfo) activeOverlays(now time.Time) []DrawElement {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.dropExpiredOverlays(now)
+
+	var elements []DrawElement
+	for _, o := range si.overlays {
+		elements = append(elements, o.elements...)
+	}
+	return elements
+}
+
+// dropExpiredOverlays removes overlays that expired by now. The caller must hold si.mu.
+func (si *StreamInfo) dropExpiredOverlays(now time.Time) {
+	kept := si.overlays[:0]
+	for _, o := range si.overlays {
+		if now.Before(o.expires) {
+			kept = append(kept, o)
+		}
+	}
+	si.overlays = kept
+}
@@ -0,0 +1,227 @@
+package streamManager
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"sync"
+	"time"
+)
+
+// pipelineQueueSize bounds each stage queue; a full queue drops its oldest frame so latency stays flat
+const pipelineQueueSize = 2
+
+// Pipeline stages, used as indexes into stageTimes
+const (
+	stageDecode = iota // JPEG decode and RGBA conversion
+	stageRender        // Transforms, motion detection and overlays
+	stageEncode        // JPEG encode and hand-off to viewers
+	stageCount
+)
+
+// PipelineStats reports the per-stage timing of a camera's frame pipeline
+type PipelineStats struct {
+	DecodeMs float64 `json:"decodeMs"` // JPEG decode and RGBA conversion
+	RenderMs float64 `json:"renderMs"` // Transforms, motion detection and overlays
+	EncodeMs float64 `json:"encodeMs"` // JPEG encode and hand-off to viewers
+	Dropped  uint64  `json:"dropped"`  // Frames dropped because a later stage fell behind
+}
+
+// stageTimes holds smoothed stage durations in seconds and the drop count.
+// Fields are protected by the owning StreamInfo's mu.
+type stageTimes struct {
+	durations [stageCount]float64
+	dropped   uint64
+}
+
+// recordStage records how long a frame spent in a stage
+func (si *StreamInfo) recordStage(stage int, d time.Duration) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.stages.durations[stage] = smooth(si.stages.durations[stage], d.Seconds())
+}
+
+// recordDrops counts frames dropped between stages
+func (si *StreamInfo) recordDrops(n int) {
+	if n == 0 {
+		return
+	}
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.stages.dropped += uint64(n)
+}
+
+// pipelineStats returns the stage timing of a stream. The caller must hold si.mu.
+func (si *StreamInfo) pipelineStats() PipelineStats {
+	return PipelineStats{
+		DecodeMs: si.stages.durations[stageDecode] * 1000,
+		RenderMs: si.stages.durations[stageRender] * 1000,
+		EncodeMs: si.stages.durations[stageEncode] * 1000,
+		Dropped:  si.stages.dropped,
+	}
+}
+
+// imagePool reuses RGBA frames of the same bounds
+type imagePool struct {
+	mu    sync.Mutex
+	pools map[image.Rectangle]*sync.Pool
+}
+
+// frameImages holds the decoded frames of every camera
+var frameImages = &imagePool{pools: make(map[image.Rectangle]*sync.Pool)}
+
+// get returns an RGBA image with the given bounds. Its pixels are not cleared.
+func (p *imagePool) get(r image.Rectangle) *image.RGBA {
+	p.mu.Lock()
+	pool, ok := p.pools[r]
+	if !ok {
+		pool = &sync.Pool{New: func() any { return image.NewRGBA(r) }}
+		p.pools[r] = pool
+	}
+	p.mu.Unlock()
+	return pool.Get().(*image.RGBA)
+}
+
+// put returns an image for reuse. It must no longer be referenced.
+func (p *imagePool) put(img *image.RGBA) {
+	p.mu.Lock()
+	pool, ok := p.pools[img.Rect]
+	p.mu.Unlock()
+	if ok {
+		pool.Put(img)
+	}
+}
+
+// encodeBuffers reuses JPEG encode buffers
+var encodeBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// pipelineFrame is a frame moving between stages
+type pipelineFrame struct {
+	img    *image.RGBA
+	pooled bool      // img came from frameImages and goes back once encoded
+	shared bool      // img is shared with other cameras and must not be drawn on
+	start  time.Time // When the frame entered the pipeline
+}
+
+// release returns a dropped or finished frame's image to the pool
+func (f *pipelineFrame) release() {
+	if f.pooled {
+		frameImages.put(f.img)
+	}
+}
+
+// frameQueue is a bounded queue between two stages that drops its oldest frame when full
+type frameQueue chan *pipelineFrame
+
+// push adds a frame without blocking, dropping older frames to make room.
+// Returns the number of frames dropped.
+func (q frameQueue) push(f *pipelineFrame) int {
+	dropped := 0
+	for {
+		select {
+		case q <- f:
+			return dropped
+		default:
+		}
+		select {
+		case old := <-q:
+			old.release()
+			dropped++
+		default:
+		}
+	}
+}
+
+// framePipeline runs the render and encode stages of a camera in their own goroutines.
+// Decoding happens in the feed loop, which submits frames to the render stage.
+type framePipeline struct {
+	sm          *StreamManager
+	info        *StreamInfo
+	render      frameQueue
+	encode      frameQueue
+	shareOutput bool // Virtual cameras pass their transformed frames on to derived cameras
+	done        chan struct{}
+}
+
+// startPipeline starts the render and encode stages of a camera
+func (sm *StreamManager) startPipeline(info *StreamInfo, shareOutput bool) *framePipeline {
+	p := &framePipeline{
+		sm:          sm,
+		info:        info,
+		render:      make(frameQueue, pipelineQueueSize),
+		encode:      make(frameQueue, pipelineQueueSize),
+		shareOutput: shareOutput,
+		done:        make(chan struct{}),
+	}
+	go p.renderStage()
+	go p.encodeStage()
+	return p
+}
+
+// submit hands a decoded frame to the render stage
+func (p *framePipeline) submit(f *pipelineFrame) {
+	p.info.metrics.recordSource(f.img.Rect.Size())
+	p.info.recordDrops(p.render.push(f))
+}
+
+// close stops accepting frames and waits for queued frames to be encoded
+func (p *framePipeline) close() {
+	close(p.render)
+	<-p.done
+}
+
+// renderStage applies transforms, detects motion and draws overlays
+func (p *framePipeline) renderStage() {
+	defer close(p.encode)
+	for f := range p.render {
+		start := time.Now()
+		// Updates to the camera apply from the next frame
+		camera := p.info.cameraConfig()
+
+		// Transforms run before overlays so drawn coordinates match the displayed frame
+		img := applyTransforms(camera, f.img)
+		out := &pipelineFrame{img: img, start: f.start}
+		switch {
+		case img != f.img:
+			f.release()
+		case f.shared:
+			// Frames shared between cameras are never drawn on directly
+			out.img = cloneRGBA(img)
+		default:
+			out.pooled = f.pooled
+		}
+
+		// Feed virtual cameras derived from this one
+		if p.shareOutput {
+			p.info.publish(out.img)
+		}
+
+		p.sm.detectMotion(camera, p.info, out.img)
+		p.sm.recordPreview(p.info, out.img)
+		p.sm.drawOverlays(camera, p.info, out.img)
+		p.info.recordStage(stageRender, time.Since(start))
+
+		p.info.recordDrops(p.encode.push(out))
+	}
+}
+
+// encodeStage encodes frames to JPEG and pushes them to the MJPEG stream
+func (p *framePipeline) encodeStage() {
+	defer close(p.done)
+	for f := range p.encode {
+		start := time.Now()
+		buf := encodeBuffers.Get().(*bytes.Buffer)
+		buf.Reset()
+		if err := jpeg.Encode(buf, f.img, &jpeg.Options{Quality: 80}); err == nil {
+			// UpdateJPEG copies the data, so the buffer can be reused right away
+			p.info.Stream.UpdateJPEG(buf.Bytes())
+			p.info.metrics.recordOutput(buf.Len())
+			p.info.deliverSnapshot(buf.Bytes())
+		}
+		encodeBuffers.Put(buf)
+		f.release()
+
+		p.info.recordStage(stageEncode, time.Since(start))
+		p.info.recordLatency(time.Since(f.start))
+	}
+}
@@ -0,0 +1,223 @@
+package streamManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/notifier"
+	"github.com/8ff/firescrew/pkg/preview"
+)
+
+// Preview defaults
+const (
+	defaultPreviewWidth  = 320
+	defaultPreviewFPS    = 5
+	defaultPreviewBefore = 3
+	defaultPreviewAfter  = 5
+	defaultPreviewKeep   = 200
+	defaultPreviewDir    = "previews"
+
+	previewRenderTimeout = time.Minute
+)
+
+// PreviewConfig renders the frames around each motion event as a GIF or MP4 clip,
+// stored with a JSON metadata file and attached to the motion_start notification
+type PreviewConfig struct {
+	Enabled bool    `json:"enabled"`
+	Format  string  `json:"format,omitempty"` // "gif" (default) or "mp4", which needs ffmpeg with libx264
+	Width   int     `json:"width,omitempty"`  // Frame width, default 320
+	FPS     float64 `json:"fps,omitempty"`    // Frames per second, default 5
+	Before  int     `json:"before,omitempty"` // Seconds before the event, default 3
+	After   int     `json:"after,omitempty"`  // Seconds after the event, default 5. The notification waits for them
+	Dir     string  `json:"dir,omitempty"`    // Directory of the previews, default previews next to the config file
+	Keep    int     `json:"keep,omitempty"`   // Previews kept per camera, default 200
+}
+
+// PreviewMetadata describes a stored preview. It is written next to the preview with the same name.
+type PreviewMetadata struct {
+	CameraID        string    `json:"cameraId"`
+	CameraName      string    `json:"cameraName,omitempty"`
+	Event           string    `json:"event"`
+	Time            time.Time `json:"time"`
+	File            string    `json:"file"` // Name of the preview file in the same directory
+	Format          string    `json:"format"`
+	Frames          int       `json:"frames"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// validate checks the format
+func (c *PreviewConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.Format {
+	case "", preview.FormatGIF, preview.FormatMP4:
+		return nil
+	}
+	return fmt.Errorf("unknown preview format %q", c.Format)
+}
+
+func (c *PreviewConfig) enabled() bool {
+	return c != nil && c.Enabled
+}
+
+func (c *PreviewConfig) format() string {
+	if c.Format == "" {
+		return preview.FormatGIF
+	}
+	return c.Format
+}
+
+// window returns the time kept before and after an event
+func (c *PreviewConfig) window() (before, after time.Duration) {
+	b, a := c.Before, c.After
+	if b <= 0 {
+		b = defaultPreviewBefore
+	}
+	if a <= 0 {
+		a = defaultPreviewAfter
+	}
+	return time.Duration(b) * time.Second, time.Duration(a) * time.Second
+}
+
+// newBuffer creates the rolling frame buffer of a stream
+func (c *PreviewConfig) newBuffer() *preview.Buffer {
+	width, fps := c.Width, c.FPS
+	if width <= 0 {
+		width = defaultPreviewWidth
+	}
+	if fps <= 0 {
+		fps = defaultPreviewFPS
+	}
+	before, after := c.window()
+	return preview.NewBuffer(width, fps, before+after)
+}
+
+// previewDir returns the configured directory, relative paths resolve next to the config file
+func previewDir(configPath string, c *PreviewConfig) string {
+	dir := c.Dir
+	if dir == "" {
+		dir = defaultPreviewDir
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(configPath), dir)
+}
+
+// recordPreview offers a rendered frame to the stream's preview buffer
+func (sm *StreamManager) recordPreview(info *StreamInfo, img *image.RGBA) {
+	if !sm.previews.enabled() {
+		return
+	}
+	info.mu.Lock()
+	if info.preview == nil {
+		info.preview = sm.previews.newBuffer()
+	}
+	buffer := info.preview
+	info.mu.Unlock()
+	buffer.Add(img, time.Now())
+}
+
+// capturePreview waits for the frames after a motion event, stores the preview and sends
+// the motion_start notification with it attached
+func (sm *StreamManager) capturePreview(cameraID string, at time.Time) {
+	before, after := sm.previews.window()
+	time.Sleep(after)
+
+	var attachment *notifier.Attachment
+	if data, meta, err := sm.savePreview(cameraID, at.Add(-before), at.Add(after), at); err != nil {
+		log.Printf("Failed to save preview for camera %s: %v", cameraID, err)
+	} else {
+		attachment = &notifier.Attachment{Name: meta.File, ContentType: preview.ContentType(meta.Format), Data: data}
+	}
+	sm.sendNotification(EventMotionStart, cameraID, "", nil, attachment)
+}
+
+// savePreview renders the buffered frames between from and to and writes the preview and its metadata
+func (sm *StreamManager) savePreview(cameraID string, from, to, at time.Time) ([]byte, PreviewMetadata, error) {
+	meta := PreviewMetadata{CameraID: cameraID, Event: EventMotionStart, Time: at.UTC(), Format: sm.previews.format()}
+	info, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return nil, meta, err
+	}
+	info.mu.Lock()
+	buffer := info.preview
+	info.mu.Unlock()
+	if buffer == nil {
+		return nil, meta, fmt.Errorf("no frames buffered")
+	}
+	frames := buffer.Frames(from, to)
+	if len(frames) == 0 {
+		return nil, meta, fmt.Errorf("no frames buffered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewRenderTimeout)
+	defer cancel()
+	data, err := preview.Render(ctx, meta.Format, frames)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	if camera, err := sm.GetCamera(cameraID); err == nil {
+		meta.CameraName = camera.Name
+	}
+	meta.Frames = len(frames)
+	meta.DurationSeconds = frames[len(frames)-1].Time.Sub(frames[0].Time).Seconds()
+
+	dir := filepath.Join(previewDir(sm.configPath, sm.previews), invalidObjectID.ReplaceAllString(cameraID, "_"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, meta, err
+	}
+	name := at.UTC().Format("20060102-150405.000")
+	meta.File = name + "." + meta.Format
+	if err := os.WriteFile(filepath.Join(dir, meta.File), data, 0644); err != nil {
+		return nil, meta, err
+	}
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), metaData, 0644); err != nil {
+		return nil, meta, err
+	}
+
+	keep := sm.previews.Keep
+	if keep <= 0 {
+		keep = defaultPreviewKeep
+	}
+	prunePreviews(dir, keep)
+	return data, meta, nil
+}
+
+// prunePreviews removes the oldest previews of a camera beyond keep. Names sort by time.
+func prunePreviews(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= keep {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		for _, format := range []string{preview.FormatGIF, preview.FormatMP4} {
+			os.Remove(filepath.Join(dir, name+"."+format))
+		}
+		os.Remove(filepath.Join(dir, name+".json"))
+	}
+}
@@ -0,0 +1,133 @@
+package streamManager
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+	"github.com/8ff/firescrew/pkg/notifier"
+)
+
+// recordingNotifier passes the messages it is sent to a channel
+type recordingNotifier chan notifier.Message
+
+func (n recordingNotifier) Name() string { return "recording" }
+
+func (n recordingNotifier) Notify(ctx context.Context, m notifier.Message) error {
+	n <- m
+	return nil
+}
+
+func TestSavePreview(t *testing.T) {
+	dir := t.TempDir()
+	sm := &StreamManager{
+		config:     &Config{Cameras: []Camera{{ID: "cam/1", Name: "Garage"}}},
+		configPath: filepath.Join(dir, "config.json"),
+		previews:   &PreviewConfig{Enabled: true, Width: 32, FPS: 10, Keep: 2},
+	}
+	info := &StreamInfo{}
+	sm.streams.Store("cam/1", info)
+
+	sm.recordPreview(info, image.NewRGBA(image.Rect(0, 0, 64, 48)))
+	if info.preview == nil {
+		t.Fatal("no preview buffer created")
+	}
+
+	// recordPreview uses the wall clock, fill a buffer with known times instead
+	start := time.Now()
+	info.preview = sm.previews.newBuffer()
+	for i := 0; i < 10; i++ {
+		info.preview.Add(image.NewRGBA(image.Rect(0, 0, 64, 48)), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+
+	var saved []string
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		data, meta, err := sm.savePreview("cam/1", start, start.Add(time.Second), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 || meta.Frames != 10 || meta.CameraName != "Garage" || meta.Format != "gif" {
+			t.Fatalf("got %+v", meta)
+		}
+		saved = append(saved, meta.File)
+	}
+
+	cameraDir := filepath.Join(dir, "previews", "cam_1")
+	entries, err := os.ReadDir(cameraDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep is 2, the oldest preview and its metadata are removed
+	if len(entries) != 4 {
+		t.Errorf("got %d files, want 4", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(cameraDir, saved[0])); !os.IsNotExist(err) {
+		t.Errorf("oldest preview kept: %v", err)
+	}
+
+	var meta PreviewMetadata
+	data, err := os.ReadFile(filepath.Join(cameraDir, saved[2][:len(saved[2])-len(".gif")]+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil || meta.File != saved[2] || meta.Event != EventMotionStart {
+		t.Errorf("metadata %s: %v", data, err)
+	}
+
+	if _, _, err := sm.savePreview("other", start, start.Add(time.Second), start); err == nil {
+		t.Error("saved a preview of a camera without a stream")
+	}
+}
+
+func TestMotionStartAttachesPreview(t *testing.T) {
+	sinks, err := eventSinks.New(eventSinks.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sinks.Close()
+	sent := make(recordingNotifier, 1)
+	router, err := notifier.NewRouter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Add(sent, nil, []string{EventMotionStart}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := &StreamManager{
+		config:     &Config{Cameras: []Camera{{ID: "cam", Name: "Garage"}}},
+		configPath: filepath.Join(t.TempDir(), "config.json"),
+		previews:   &PreviewConfig{Enabled: true, Width: 32, FPS: 10, Before: 1, After: 1},
+		sinks:      sinks,
+		notifiers:  router,
+	}
+	info := &StreamInfo{}
+	sm.streams.Store("cam", info)
+	for i := 0; i < 5; i++ {
+		sm.recordPreview(info, image.NewRGBA(image.Rect(0, 0, 64, 48)))
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The notification waits for the frames after the event, then carries the preview
+	sm.notify(EventMotionStart, "cam", nil)
+	select {
+	case m := <-sent:
+		if m.EventType != EventMotionStart || m.CameraName != "Garage" {
+			t.Errorf("got a %s notification for %q", m.EventType, m.CameraName)
+		}
+		if m.Attachment == nil || m.Attachment.ContentType != "image/gif" || len(m.Attachment.Data) == 0 {
+			t.Fatalf("attachment %+v, want the GIF preview", m.Attachment)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(sm.configPath), "previews", "cam", m.Attachment.Name)); err != nil {
+			t.Errorf("attached preview not stored: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("motion_start notification not sent")
+	}
+}
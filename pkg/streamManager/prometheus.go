@@ -0,0 +1,149 @@
+package streamManager
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/8ff/firescrew/pkg/promMetrics"
+)
+
+// errorReasons are the log classes exported as stream error reasons
+var errorReasons = []string{LogConnection, LogAuth, LogNotFound, LogCodec, LogHardware, LogDropped, LogError, LogExit}
+
+// newMetricsRegistry creates the registry served on /metrics
+func (sm *StreamManager) newMetricsRegistry() *promMetrics.Registry {
+	sm.httpDuration = promMetrics.NewHistogramVec(
+		"firescrew_http_request_duration_seconds",
+		"Time spent serving HTTP requests. Stream requests last as long as the viewer stays connected.",
+		nil, "handler", "method", "code")
+
+	registry := promMetrics.NewRegistry()
+	registry.Register(
+		promMetrics.CollectorFunc(sm.collectCameraMetrics),
+		promMetrics.CollectorFunc(sm.collectGPUMetrics),
+		sm.httpDuration,
+	)
+	return registry
+}
+
+// handle registers a handler and records its request latencies under the route pattern
+func (sm *StreamManager) handle(mux *http.ServeMux, pattern string, handler http.Handler) {
+	mux.Handle(pattern, promMetrics.InstrumentHandler(handler, sm.httpDuration, pattern))
+}
+
+// cameraSample is one camera's values at scrape time
+type cameraSample struct {
+	camera    Camera
+	streaming bool
+	viewers   int
+	metrics   CameraMetrics
+	pipeline  PipelineStats
+	errors    map[string]int
+}
+
+// cameraSamples reads the current values of every camera
+func (sm *StreamManager) cameraSamples() []cameraSample {
+	cameras := sm.GetAllCameras()
+	samples := make([]cameraSample, 0, len(cameras))
+	for _, camera := range cameras {
+		s := cameraSample{camera: camera}
+		if info, err := sm.GetStreamInfo(camera.ID); err == nil {
+			info.mu.Lock()
+			s.streaming = true
+			s.viewers = info.ViewerCount
+			s.pipeline = info.pipelineStats()
+			inputFPS := info.rate.inputFPS
+			info.mu.Unlock()
+			s.metrics = info.metrics.snapshot(inputFPS)
+		}
+		// Error counts outlive stream restarts, they are kept until the camera is deleted
+		if ring, ok := sm.logs.Load(camera.ID); ok {
+			s.errors = ring.(*logRing).classCounts()
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// collectCameraMetrics writes the per-camera metrics
+func (sm *StreamManager) collectCameraMetrics(w *promMetrics.Writer) {
+	samples := sm.cameraSamples()
+
+	type family struct {
+		name, typ, help string
+		value           func(s cameraSample) float64
+		streamingOnly   bool // Only written for cameras that are streaming
+	}
+	families := []family{
+		{"firescrew_camera_enabled", promMetrics.Gauge, "Whether the camera is enabled in the config.", func(s cameraSample) float64 { return boolValue(s.camera.Enabled) }, false},
+		{"firescrew_camera_streaming", promMetrics.Gauge, "Whether the camera stream is running.", func(s cameraSample) float64 { return boolValue(s.streaming) }, false},
+		{"firescrew_camera_viewers", promMetrics.Gauge, "Connected viewers.", func(s cameraSample) float64 { return float64(s.viewers) }, false},
+		{"firescrew_camera_input_fps", promMetrics.Gauge, "Frames per second arriving from the decoder.", func(s cameraSample) float64 { return s.metrics.InputFPS }, true},
+		{"firescrew_camera_output_fps", promMetrics.Gauge, "Frames per second encoded for viewers.", func(s cameraSample) float64 { return s.metrics.OutputFPS }, true},
+		{"firescrew_camera_output_bitrate_kbps", promMetrics.Gauge, "Bitrate of the encoded MJPEG stream.", func(s cameraSample) float64 { return s.metrics.OutputKbps }, true},
+		{"firescrew_camera_last_frame_timestamp_seconds", promMetrics.Gauge, "Unix time of the last encoded frame.", func(s cameraSample) float64 {
+			if s.metrics.LastFrame == nil {
+				return 0
+			}
+			return float64(s.metrics.LastFrame.UnixMilli()) / 1000
+		}, true},
+		{"firescrew_camera_uptime_seconds", promMetrics.Gauge, "Time since the stream started.", func(s cameraSample) float64 { return s.metrics.UptimeSeconds }, true},
+		{"firescrew_camera_decode_seconds", promMetrics.Gauge, "Smoothed time to decode a frame.", func(s cameraSample) float64 { return s.pipeline.DecodeMs / 1000 }, true},
+		{"firescrew_camera_encode_seconds", promMetrics.Gauge, "Smoothed time to encode a frame.", func(s cameraSample) float64 { return s.pipeline.EncodeMs / 1000 }, true},
+		{"firescrew_camera_restarts_total", promMetrics.Counter, "Decoder restarts after failures since the stream started.", func(s cameraSample) float64 { return float64(s.metrics.Restarts) }, true},
+		{"firescrew_camera_frames_total", promMetrics.Counter, "Frames encoded since the stream started.", func(s cameraSample) float64 { return float64(s.metrics.FramesOut) }, true},
+		{"firescrew_camera_frames_dropped_total", promMetrics.Counter, "Frames dropped because a pipeline stage fell behind.", func(s cameraSample) float64 { return float64(s.pipeline.Dropped) }, true},
+		{"firescrew_camera_frames_throttled_total", promMetrics.Counter, "Frames skipped by the frame rate cap.", func(s cameraSample) float64 { return float64(s.metrics.FramesThrottled) }, true},
+		{"firescrew_camera_corrupted_frames_total", promMetrics.Counter, "Corrupted JPEG frames skipped.", func(s cameraSample) float64 { return float64(s.metrics.CorruptedFrames) }, true},
+		{"firescrew_camera_sent_bytes_total", promMetrics.Counter, "Bytes written to viewers.", func(s cameraSample) float64 { return float64(s.metrics.BytesSent) }, true},
+	}
+
+	for _, f := range families {
+		w.Family(f.name, f.typ, f.help)
+		for _, s := range samples {
+			if f.streamingOnly && !s.streaming {
+				continue
+			}
+			w.Sample(f.name, f.value(s), "camera", s.camera.ID)
+		}
+	}
+
+	w.Family("firescrew_camera_errors_total", promMetrics.Counter, "ffmpeg errors by reason.")
+	for _, s := range samples {
+		for _, reason := range errorReasons {
+			if n, ok := s.errors[reason]; ok {
+				w.Sample("firescrew_camera_errors_total", float64(n), "camera", s.camera.ID, "reason", reason)
+			}
+		}
+	}
+}
+
+// collectGPUMetrics writes the session usage and health of each GPU device
+func (sm *StreamManager) collectGPUMetrics(w *promMetrics.Writer) {
+	devices := sm.GetGPUDevices()
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Device < devices[j].Device })
+
+	families := []struct {
+		name, help string
+		value      func(d GPUDeviceStatus) float64
+	}{
+		{"firescrew_gpu_sessions", "Hardware decode sessions in use.", func(d GPUDeviceStatus) float64 { return float64(d.Sessions) }},
+		{"firescrew_gpu_sessions_max", "Hardware decode session limit.", func(d GPUDeviceStatus) float64 { return float64(d.MaxSessions) }},
+		{"firescrew_gpu_recent_errors", "Decoder failures in the last minute.", func(d GPUDeviceStatus) float64 { return float64(d.RecentErrors) }},
+		{"firescrew_gpu_healthy", "Whether the device takes new sessions.", func(d GPUDeviceStatus) float64 { return boolValue(d.Healthy) }},
+	}
+	for _, f := range families {
+		w.Family(f.name, promMetrics.Gauge, f.help)
+		for _, d := range devices {
+			w.Sample(f.name, f.value(d), "device", d.Device, "backend", d.Backend)
+		}
+	}
+}
+
+// boolValue converts a bool to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
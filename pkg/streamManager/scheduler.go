@@ -0,0 +1,251 @@
+package streamManager
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Decoder states reported in the camera status
+const (
+	DecoderQueued = "queued" // Waiting for a free decoder slot, otherwise the backend name is reported
+)
+
+// DecoderBudget limits how many ffmpeg decoders may run at once
+type DecoderBudget struct {
+	CPUSlots   int         `json:"cpuSlots,omitempty"`   // Concurrent CPU decoders, 0 means unlimited
+	GPUSlots   int         `json:"gpuSlots,omitempty"`   // Concurrent hardware decoders per device, 0 keeps the default
+	GPUDevices []GPUDevice `json:"gpuDevices,omitempty"` // GPU devices and their session pools, empty uses one default device
+}
+
+// decoderSlot is a granted decoder, held for the lifetime of one ffmpeg process
+type decoderSlot struct {
+	cameraID  string
+	priority  int
+	device    *gpuDevice // GPU device holding a session for a hardware backend, nil on the CPU
+	info      *StreamInfo
+	preempted chan struct{} // Closed when a higher priority camera needs the slot
+	once      sync.Once
+}
+
+// decoderRequest is a camera waiting for a decoder slot
+type decoderRequest struct {
+	cameraID string
+	priority int
+	backend  string          // Hardware backend wanting a GPU session, empty for the CPU
+	avoid    map[string]bool // GPU devices that failed for this camera
+	info     *StreamInfo
+	queuedAt time.Time
+	ready    chan *decoderSlot
+}
+
+// decoderScheduler hands out CPU and hardware decoder slots by camera priority
+type decoderScheduler struct {
+	sm       *StreamManager
+	mu       sync.Mutex
+	cpuSlots int // 0 means unlimited
+	cpuUsed  int
+	active   map[*decoderSlot]struct{}
+	queue    []*decoderRequest
+}
+
+// newDecoderScheduler creates a scheduler with the given CPU budget
+func newDecoderScheduler(sm *StreamManager, cpuSlots int) *decoderScheduler {
+	return &decoderScheduler{
+		sm:       sm,
+		cpuSlots: cpuSlots,
+		active:   make(map[*decoderSlot]struct{}),
+	}
+}
+
+// acquire blocks until the camera may start a decoder or ctx is cancelled.
+// Hardware backends get a session on a GPU device outside avoid, or fall back to a CPU slot.
+// Idle cameras with a lower priority are preempted to make room.
+func (ds *decoderScheduler) acquire(ctx context.Context, camera *Camera, info *StreamInfo, backend DecoderBackend, avoid map[string]bool) (*decoderSlot, error) {
+	req := &decoderRequest{
+		cameraID: camera.ID,
+		priority: camera.Priority,
+		avoid:    avoid,
+		info:     info,
+		queuedAt: time.Now(),
+		ready:    make(chan *decoderSlot, 1),
+	}
+	if backend.Hardware() {
+		req.backend = backend.Name()
+	}
+
+	ds.mu.Lock()
+	ds.queue = append(ds.queue, req)
+	ds.dispatch()
+	select {
+	case slot := <-req.ready:
+		ds.mu.Unlock()
+		return slot, nil
+	default:
+	}
+
+	info.setDecoder(DecoderQueued, "")
+	log.Printf("Camera %s queued for a decoder (priority %d, %d waiting)", camera.ID, camera.Priority, len(ds.queue))
+	ds.mu.Unlock()
+
+	select {
+	case slot := <-req.ready:
+		return slot, nil
+	case <-ctx.Done():
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		ds.removeRequest(req)
+		// A slot may have been granted right before cancellation
+		select {
+		case slot := <-req.ready:
+			ds.releaseLocked(slot)
+		default:
+		}
+		info.setDecoder("", "")
+		return nil, ctx.Err()
+	}
+}
+
+// release returns a decoder slot and starts the next queued camera
+func (ds *decoderScheduler) release(slot *decoderSlot) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.releaseLocked(slot)
+}
+
+// releaseLocked returns a decoder slot. The caller must hold ds.mu.
+func (ds *decoderScheduler) releaseLocked(slot *decoderSlot) {
+	if _, ok := ds.active[slot]; !ok {
+		return
+	}
+	delete(ds.active, slot)
+	if slot.device != nil {
+		ds.sm.gpus.release(slot.device, slot.cameraID)
+	} else {
+		ds.cpuUsed--
+	}
+	slot.info.setDecoder("", "")
+	ds.dispatch()
+}
+
+// dispatch grants free slots to queued cameras, highest priority first.
+// If the first camera in the queue cannot start, an idle camera with a lower priority is preempted for it.
+// The caller must hold ds.mu.
+func (ds *decoderScheduler) dispatch() {
+	sort.SliceStable(ds.queue, func(i, j int) bool {
+		if ds.queue[i].priority != ds.queue[j].priority {
+			return ds.queue[i].priority > ds.queue[j].priority
+		}
+		return ds.queue[i].queuedAt.Before(ds.queue[j].queuedAt)
+	})
+
+	for len(ds.queue) > 0 {
+		req := ds.queue[0]
+		slot := &decoderSlot{
+			cameraID:  req.cameraID,
+			priority:  req.priority,
+			info:      req.info,
+			preempted: make(chan struct{}),
+		}
+
+		// Hardware falls back to CPU when all GPU sessions are in use
+		if req.backend != "" {
+			slot.device = ds.sm.gpus.acquire(req.cameraID, req.backend, req.avoid)
+		}
+		switch {
+		case slot.device != nil:
+		case ds.cpuSlots <= 0 || ds.cpuUsed < ds.cpuSlots:
+			ds.cpuUsed++
+		default:
+			// Highest priority request cannot start, keep everyone queued behind it
+			ds.preemptFor(req)
+			return
+		}
+
+		ds.queue = ds.queue[1:]
+		ds.active[slot] = struct{}{}
+		// The feed loop reports the backend once it knows which one the slot allows
+		req.info.setDecoder("", "")
+		req.ready <- slot
+	}
+}
+
+// preemptFor stops the lowest priority idle decoder below the request's priority, unless
+// one is already on its way out. The preempted camera goes back to the queue once its decoder exits,
+// and the next queued camera gets its chance when the freed slot is taken.
+// The caller must hold ds.mu.
+func (ds *decoderScheduler) preemptFor(req *decoderRequest) {
+	var victim *decoderSlot
+	for slot := range ds.active {
+		select {
+		case <-slot.preempted:
+			// Already on its way out, its slot goes to the head of the queue
+			return
+		default:
+		}
+		if slot.priority >= req.priority || !slot.info.idle() {
+			continue
+		}
+		if victim == nil || slot.priority < victim.priority {
+			victim = slot
+		}
+	}
+
+	if victim != nil {
+		log.Printf("Preempting idle camera %s (priority %d) for camera %s (priority %d)",
+			victim.cameraID, victim.priority, req.cameraID, req.priority)
+		victim.once.Do(func() { close(victim.preempted) })
+	}
+}
+
+// preemptDevice restarts every decoder running on a GPU device so the cameras
+// move to other devices
+func (ds *decoderScheduler) preemptDevice(device *gpuDevice) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for slot := range ds.active {
+		if slot.device == device {
+			log.Printf("Moving camera %s off GPU device %s", slot.cameraID, device.name())
+			slot.once.Do(func() { close(slot.preempted) })
+		}
+	}
+}
+
+// removeRequest drops a request from the queue. The caller must hold ds.mu.
+func (ds *decoderScheduler) removeRequest(req *decoderRequest) {
+	for i, r := range ds.queue {
+		if r == req {
+			ds.queue = append(ds.queue[:i], ds.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// queuePosition returns the 1-based queue position of a camera, 0 if not queued
+func (ds *decoderScheduler) queuePosition(cameraID string) int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for i, r := range ds.queue {
+		if r.cameraID == cameraID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// setDecoder records the decoder state of a stream and the GPU device it runs on
+func (si *StreamInfo) setDecoder(state, device string) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.decoder = state
+	si.gpuDevice = device
+}
+
+// idle reports whether nothing currently depends on the stream
+func (si *StreamInfo) idle() bool {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	return si.ViewerCount == 0 && len(si.subscribers) == 0 && !si.motion.active
+}
@@ -0,0 +1,287 @@
+package streamManager
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeStream is a camera asking the scheduler for a decoder
+type fakeStream struct {
+	camera *Camera
+	info   *StreamInfo
+	slot   chan *decoderSlot
+	err    chan error
+	cancel context.CancelFunc
+}
+
+// startFakeStream asks for a CPU decoder on a goroutine, like the feed loop does
+func startFakeStream(ds *decoderScheduler, id string, priority, viewers int) *fakeStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &fakeStream{
+		camera: &Camera{ID: id, Priority: priority},
+		info:   &StreamInfo{ViewerCount: viewers},
+		slot:   make(chan *decoderSlot, 1),
+		err:    make(chan error, 1),
+		cancel: cancel,
+	}
+	go func() {
+		slot, err := ds.acquire(ctx, s.camera, s.info, cpuBackend{}, nil)
+		if err != nil {
+			s.err <- err
+			return
+		}
+		s.slot <- slot
+	}()
+	return s
+}
+
+// granted waits for the stream's slot
+func (s *fakeStream) granted(t *testing.T) *decoderSlot {
+	t.Helper()
+	select {
+	case slot := <-s.slot:
+		return slot
+	case <-time.After(time.Second):
+		t.Fatalf("camera %s was not granted a decoder", s.camera.ID)
+		return nil
+	}
+}
+
+// decoder returns the decoder state reported for the camera
+func (s *fakeStream) decoder() string {
+	s.info.mu.Lock()
+	defer s.info.mu.Unlock()
+	return s.info.decoder
+}
+
+// waiting fails if the stream was granted a slot
+func (s *fakeStream) waiting(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.slot:
+		t.Fatalf("camera %s was granted a decoder, want it queued", s.camera.ID)
+	default:
+	}
+}
+
+// waitQueued waits until a camera is at a queue position
+func waitQueued(t *testing.T, ds *decoderScheduler, id string, position int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for ds.queuePosition(id) != position {
+		if time.Now().After(deadline) {
+			t.Fatalf("camera %s at queue position %d, want %d", id, ds.queuePosition(id), position)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitQueueLength waits until n cameras are queued
+func waitQueueLength(t *testing.T, ds *decoderScheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		ds.mu.Lock()
+		queued := len(ds.queue)
+		ds.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d cameras queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// isPreempted reports whether a slot was asked to give up its decoder
+func isPreempted(slot *decoderSlot) bool {
+	select {
+	case <-slot.preempted:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDecoderSchedulerOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []int    // Queued in this order behind a busy decoder
+		want       []string // Expected queue order, which is also the grant order
+	}{
+		{name: "first come first served", priorities: []int{0, 0, 0}, want: []string{"q0", "q1", "q2"}},
+		{name: "highest priority first", priorities: []int{1, 5, 3}, want: []string{"q1", "q2", "q0"}},
+		{name: "equal priority keeps arrival order", priorities: []int{2, 7, 2, 7}, want: []string{"q1", "q3", "q0", "q2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newDecoderScheduler(nil, 1)
+			busy := startFakeStream(ds, "busy", -1, 1)
+			slot := busy.granted(t)
+
+			streams := make(map[string]*fakeStream)
+			for i, priority := range test.priorities {
+				id := "q" + string(rune('0'+i))
+				streams[id] = startFakeStream(ds, id, priority, 1)
+				waitQueueLength(t, ds, len(streams))
+				// Later arrivals must not be reordered ahead of this one by their queue time
+				time.Sleep(time.Millisecond)
+			}
+			for i, id := range test.want {
+				if got := ds.queuePosition(id); got != i+1 {
+					t.Errorf("camera %s at queue position %d, want %d", id, got, i+1)
+				}
+				if got := streams[id].decoder(); got != DecoderQueued {
+					t.Errorf("camera %s reports decoder %q, want %q", id, got, DecoderQueued)
+				}
+			}
+
+			// Each release hands the slot to the next camera in the queue
+			for _, id := range test.want {
+				ds.release(slot)
+				slot = streams[id].granted(t)
+				for _, other := range streams {
+					if other != streams[id] {
+						other.waiting(t)
+					}
+				}
+			}
+			ds.release(slot)
+			if ds.cpuUsed != 0 || len(ds.active) != 0 {
+				t.Errorf("%d slots in use after releasing all, want 0", ds.cpuUsed)
+			}
+		})
+	}
+}
+
+func TestDecoderSchedulerPreemption(t *testing.T) {
+	tests := []struct {
+		name            string
+		runningPriority int
+		runningViewers  int
+		queuedPriority  int
+		preempted       bool
+	}{
+		{name: "idle lower priority", runningPriority: 0, queuedPriority: 5, preempted: true},
+		{name: "watched lower priority", runningPriority: 0, runningViewers: 1, queuedPriority: 5},
+		{name: "equal priority", runningPriority: 5, queuedPriority: 5},
+		{name: "higher priority", runningPriority: 9, queuedPriority: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newDecoderScheduler(nil, 1)
+			running := startFakeStream(ds, "running", test.runningPriority, test.runningViewers)
+			slot := running.granted(t)
+
+			queued := startFakeStream(ds, "queued", test.queuedPriority, 0)
+			waitQueued(t, ds, "queued", 1)
+			if got := isPreempted(slot); got != test.preempted {
+				t.Fatalf("running camera preempted = %v, want %v", got, test.preempted)
+			}
+
+			// The preempted camera exits and gives its slot to the waiting camera
+			if test.preempted {
+				ds.release(slot)
+				queued.granted(t)
+			}
+			queued.cancel()
+		})
+	}
+}
+
+func TestDecoderSchedulerPreemptsWhenSlotFrees(t *testing.T) {
+	ds := newDecoderScheduler(nil, 2)
+	low := startFakeStream(ds, "low", 0, 1)
+	lowSlot := low.granted(t)
+	mid := startFakeStream(ds, "mid", 1, 1)
+	midSlot := mid.granted(t)
+
+	// Nothing is idle when the high priority cameras are queued
+	high := startFakeStream(ds, "high", 9, 0)
+	waitQueued(t, ds, "high", 1)
+	next := startFakeStream(ds, "next", 5, 0)
+	waitQueued(t, ds, "next", 2)
+	if isPreempted(lowSlot) || isPreempted(midSlot) {
+		t.Fatal("a watched camera was preempted")
+	}
+
+	// The low priority camera loses its viewer, then the mid priority camera stops
+	low.info.mu.Lock()
+	low.info.ViewerCount = 0
+	low.info.mu.Unlock()
+	ds.release(midSlot)
+	high.granted(t)
+	next.waiting(t)
+	if !isPreempted(lowSlot) {
+		t.Fatal("idle camera was not preempted for the next camera in the queue once a slot was taken")
+	}
+
+	ds.release(lowSlot)
+	next.granted(t)
+}
+
+func TestDecoderSchedulerOnePreemptionAtATime(t *testing.T) {
+	ds := newDecoderScheduler(nil, 2)
+	a := startFakeStream(ds, "a", 0, 0)
+	aSlot := a.granted(t)
+	b := startFakeStream(ds, "b", 0, 0)
+	bSlot := b.granted(t)
+
+	startFakeStream(ds, "high1", 5, 0)
+	waitQueued(t, ds, "high1", 1)
+	startFakeStream(ds, "high2", 5, 0)
+	waitQueued(t, ds, "high2", 2)
+
+	// The second camera waits for the first to get its slot before another camera is preempted
+	if n := btoi(isPreempted(aSlot)) + btoi(isPreempted(bSlot)); n != 1 {
+		t.Errorf("%d cameras preempted, want 1", n)
+	}
+}
+
+func TestDecoderSchedulerCancel(t *testing.T) {
+	ds := newDecoderScheduler(nil, 1)
+	running := startFakeStream(ds, "running", 0, 1)
+	slot := running.granted(t)
+
+	first := startFakeStream(ds, "first", 1, 1)
+	waitQueued(t, ds, "first", 1)
+	second := startFakeStream(ds, "second", 1, 1)
+	waitQueued(t, ds, "second", 2)
+
+	// A stopped stream leaves the queue and the cameras behind it move up
+	first.cancel()
+	select {
+	case err := <-first.err:
+		if err != context.Canceled {
+			t.Errorf("acquire returned %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled acquire did not return")
+	}
+	if got := ds.queuePosition("first"); got != 0 {
+		t.Errorf("stopped camera at queue position %d, want 0", got)
+	}
+	if got := ds.queuePosition("second"); got != 1 {
+		t.Errorf("camera behind it at queue position %d, want 1", got)
+	}
+	if got := first.decoder(); got != "" {
+		t.Errorf("stopped camera reports decoder %q, want none", got)
+	}
+
+	ds.release(slot)
+	second.granted(t)
+	if ds.cpuUsed != 1 {
+		t.Errorf("%d slots in use, want 1", ds.cpuUsed)
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package streamManager
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/8ff/firescrew/pkg/eventSinks"
+	"github.com/8ff/firescrew/pkg/notifier"
+)
+
+// defaultStallTimeout is the time without frames before a streaming camera counts as stalled
+const defaultStallTimeout = 30 * time.Second
+
+// defaultOutboxDir is the directory of queued webhook deliveries, next to the config file
+const defaultOutboxDir = "webhook-outbox"
+
+// EventsConfig routes camera events to webhooks, MQTT brokers, scripts and notifiers.
+// Every sink and notifier takes optional types and cameras filters.
+type EventsConfig struct {
+	eventSinks.Config
+	Notifiers          []notifier.Config `json:"notifiers,omitempty"`          // Push, chat and email notifications
+	NotificationLimits *notifier.Limits  `json:"notificationLimits,omitempty"` // Limits across notifiers, per camera
+	Previews           *PreviewConfig    `json:"previews,omitempty"`           // GIF or MP4 clips of motion events
+	StallTimeout       int               `json:"stallTimeout,omitempty"`       // Seconds without frames before stream_stalled, default 30
+}
+
+// stallTimeout returns the configured stall timeout
+func (c *EventsConfig) stallTimeout() time.Duration {
+	if c == nil || c.StallTimeout <= 0 {
+		return defaultStallTimeout
+	}
+	return time.Duration(c.StallTimeout) * time.Second
+}
+
+// newSinks starts the dispatcher for the configured event sinks
+func (sm *StreamManager) newSinks(configPath string, config *EventsConfig) (*eventSinks.Dispatcher, error) {
+	var cfg eventSinks.Config
+	if config != nil {
+		cfg = config.Config
+	}
+	if cfg.OutboxDir == "" {
+		cfg.OutboxDir = defaultOutboxDir
+	}
+	if !filepath.IsAbs(cfg.OutboxDir) {
+		cfg.OutboxDir = filepath.Join(filepath.Dir(configPath), cfg.OutboxDir)
+	}
+	return eventSinks.New(cfg, func(e *eventSinks.Event) {
+		if e.CameraName != "" || e.CameraID == "" {
+			return
+		}
+		if camera, err := sm.GetCamera(e.CameraID); err == nil {
+			e.CameraName = camera.Name
+		}
+	})
+}
+
+// notify sends an event to the configured sinks and notifiers
+func (sm *StreamManager) notify(eventType, cameraID string, data map[string]any) {
+	sm.sinks.Dispatch(eventSinks.Event{Type: eventType, CameraID: cameraID, Data: data})
+	if eventType == EventMotionStart && sm.previews.enabled() {
+		// Notified with the preview once the frames after the event are in
+		go sm.capturePreview(cameraID, time.Now())
+		return
+	}
+	sm.sendNotification(eventType, cameraID, "", data, nil)
+}
+
+// handleGetDeliveries lists queued and failed webhook deliveries
+func (sm *StreamManager) handleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	sm.sinks.Outbox().ServeHTTP(w, r)
+}
+
+// handleGetScriptRuns lists recent event script runs with their exit codes and output
+func (sm *StreamManager) handleGetScriptRuns(w http.ResponseWriter, r *http.Request) {
+	sm.sinks.Scripts().ServeHTTP(w, r)
+}
+
+// handleScriptAction carries out an action returned by an event script. Actions take the
+// same fields as MQTT commands.
+func (sm *StreamManager) handleScriptAction(e eventSinks.Event, a eventSinks.ScriptAction) error {
+	var cmd CameraCommand
+	if err := json.Unmarshal(a.Raw, &cmd); err != nil {
+		return err
+	}
+	log.Printf("Script action %s on camera %s for %s event", cmd.Action, a.CameraID, e.Type)
+	_, err := sm.ExecuteCommand(a.CameraID, cmd)
+	return err
+}
+
+// watchStall notifies stream_stalled when a streaming camera stops delivering frames,
+// and camera_online once frames arrive again. Runs until done is closed.
+func (sm *StreamManager) watchStall(cameraID string, info *StreamInfo, done <-chan struct{}) {
+	timeout := sm.GetConfig().Events.stallTimeout()
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	stalled := false
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		info.mu.Lock()
+		lastFrame := info.rate.lastInput
+		info.mu.Unlock()
+
+		// Only streams that produced frames can stall, failures are reported as camera_offline
+		if sm.uptime.current(cameraID) != StateStreaming || lastFrame.IsZero() {
+			stalled = false
+			continue
+		}
+
+		idle := time.Since(lastFrame)
+		switch {
+		case !stalled && idle > timeout:
+			stalled = true
+			log.Printf("⚠ Stream stalled for camera %s, no frames for %s", cameraID, idle.Round(time.Second))
+			sm.notify(EventStreamStalled, cameraID, map[string]any{"seconds": int(idle.Seconds())})
+		case stalled && idle < timeout:
+			stalled = false
+			log.Printf("Stream resumed for camera %s", cameraID)
+			sm.notify(EventCameraOnline, cameraID, map[string]any{"reason": "stream resumed"})
+		}
+	}
+}
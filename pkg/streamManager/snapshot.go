@@ -0,0 +1,59 @@
+package streamManager
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// snapshotTimeout bounds the wait for the next encoded frame
+const snapshotTimeout = 15 * time.Second
+
+// requestSnapshot registers for a copy of the next encoded frame
+func (si *StreamInfo) requestSnapshot() chan []byte {
+	ch := make(chan []byte, 1)
+	si.mu.Lock()
+	si.snapshots = append(si.snapshots, ch)
+	si.mu.Unlock()
+	return ch
+}
+
+// deliverSnapshot hands an encoded frame to the pending snapshot requests
+func (si *StreamInfo) deliverSnapshot(jpeg []byte) {
+	si.mu.Lock()
+	waiters := si.snapshots
+	si.snapshots = nil
+	si.mu.Unlock()
+	if len(waiters) == 0 {
+		return
+	}
+
+	data := bytes.Clone(jpeg)
+	for _, ch := range waiters {
+		ch <- data
+	}
+}
+
+// Snapshot returns the next frame of a camera as JPEG, as viewers see it.
+// A camera that is not streaming is started and stops again once idle.
+func (sm *StreamManager) Snapshot(cameraID string) ([]byte, error) {
+	info, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		if err := sm.StartStream(cameraID); err != nil {
+			return nil, err
+		}
+		if info, err = sm.GetStreamInfo(cameraID); err != nil {
+			return nil, err
+		}
+		defer sm.checkIdle(cameraID)
+	}
+
+	select {
+	case data := <-info.requestSnapshot():
+		return data, nil
+	case <-info.stop:
+		return nil, fmt.Errorf("stream stopped for camera: %s", cameraID)
+	case <-time.After(snapshotTimeout):
+		return nil, fmt.Errorf("no frame from camera %s within %s", cameraID, snapshotTimeout)
+	}
+}
@@ -122,12 +122,15 @@ function closeCameraModal() {
 async function saveCameraForm(event) {
     event.preventDefault();
 
+    // Keep settings the form does not edit (drawElements, transforms, crop...)
+    const existing = editingCameraId ? cameras.find(c => c.id === editingCameraId) : null;
     const cameraData = {
+        ...(existing || {}),
         id: document.getElementById('cameraId').value,
         name: document.getElementById('cameraName').value,
         rtspUrl: document.getElementById('cameraRtspUrl').value,
         enabled: document.getElementById('cameraEnabled').value === 'true',
-        roi: []
+        roi: existing ? existing.roi : []
     };
 
     try {
@@ -1,11 +1,12 @@
 let cameras = [];
 let refreshInterval = null;
+let eventSource = null;
+let reloadTimer = null;
 
 // Load cameras on page load
 window.addEventListener('DOMContentLoaded', () => {
     loadCameras();
-    // Refresh every 2 seconds
-    refreshInterval = setInterval(loadCameras, 2000);
+    subscribeEvents();
 });
 
 // Clean up on page unload
@@ -13,8 +14,39 @@ window.addEventListener('beforeunload', () => {
     if (refreshInterval) {
         clearInterval(refreshInterval);
     }
+    if (eventSource) {
+        eventSource.close();
+    }
 });
 
+// Reload on camera events pushed by the server, polling only for the live counters
+function subscribeEvents() {
+    if (!window.EventSource) {
+        // Refresh every 2 seconds
+        refreshInterval = setInterval(loadCameras, 2000);
+        return;
+    }
+
+    refreshInterval = setInterval(loadCameras, 10000);
+    eventSource = new EventSource('/api/events/stream');
+    const types = ['camera_added', 'camera_updated', 'camera_deleted', 'stream_started', 'stream_stopped',
+        'state_changed', 'viewer_joined', 'viewer_left', 'motion', 'resync'];
+    types.forEach(type => eventSource.addEventListener(type, scheduleReload));
+    // EventSource reconnects by itself and resumes with Last-Event-ID
+    eventSource.onopen = scheduleReload;
+}
+
+// Coalesce bursts of events into one reload
+function scheduleReload() {
+    if (reloadTimer) {
+        return;
+    }
+    reloadTimer = setTimeout(() => {
+        reloadTimer = null;
+        loadCameras();
+    }, 200);
+}
+
 // Load all cameras and their status
 async function loadCameras() {
     try {
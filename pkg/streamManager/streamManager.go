@@ -2,6 +2,7 @@ package streamManager
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -18,6 +19,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/8ff/firescrew/pkg/eventSinks"
+	"github.com/8ff/firescrew/pkg/frameSplitter"
+	"github.com/8ff/firescrew/pkg/notifier"
+	"github.com/8ff/firescrew/pkg/preview"
+	"github.com/8ff/firescrew/pkg/promMetrics"
 	"github.com/hybridgroup/mjpeg"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
@@ -48,21 +54,50 @@ type ROI struct {
 	Height int `json:"height"`
 }
 
+// Rect represents a rectangular region in pixel coordinates
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
 // Camera represents a single camera configuration
 type Camera struct {
-	ID           string        `json:"id"`
-	Name         string        `json:"name"`
-	RtspUrl      string        `json:"rtspUrl"`
-	ROI          []ROI         `json:"roi"`          // Deprecated, kept for backward compatibility
-	DrawElements []DrawElement `json:"drawElements"` // New drawing system
-	Enabled      bool          `json:"enabled"`
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	RtspUrl      string           `json:"rtspUrl"`      // RTSP URL, or camera://{id} to derive from another camera
+	ROI          []ROI            `json:"roi"`          // Deprecated, kept for backward compatibility
+	DrawElements []DrawElement    `json:"drawElements"` // New drawing system
+	Enabled      bool             `json:"enabled"`
+	Crop         *Rect            `json:"crop,omitempty"`        // Region of the source frame to keep
+	Rotate       int              `json:"rotate,omitempty"`      // Clockwise rotation in degrees: 0, 90, 180 or 270
+	Scale        float64          `json:"scale,omitempty"`       // Output scale factor, 0 keeps the source size
+	Transforms   []Transform      `json:"transforms,omitempty"`  // Ordered image transforms applied before the view settings
+	MaxViewers   int              `json:"maxViewers,omitempty"`  // Maximum concurrent viewers, 0 means unlimited
+	Mode         string           `json:"mode,omitempty"`        // "always-on" (default), "on-demand" or "scheduled"
+	Schedule     []ScheduleWindow `json:"schedule,omitempty"`    // Windows during which a scheduled camera runs
+	IdleTimeout  int              `json:"idleTimeout,omitempty"` // Seconds without viewers before stopping, 0 uses the global value
+	DecodeMode   string           `json:"decodeMode,omitempty"`  // "full" (default) or "keyframes" for low-power decoding while unwatched
+	Motion       *MotionConfig    `json:"motion,omitempty"`      // Frame-difference motion detection
+	MinFPS       float64          `json:"minFps,omitempty"`      // Lowest frame rate under load, default 1
+	MaxFPS       float64          `json:"maxFps,omitempty"`      // Highest frame rate, 0 means the source rate
+	Priority     int              `json:"priority,omitempty"`    // Higher priority cameras get decoders first and may preempt idle ones
+	Backends     []string         `json:"backends,omitempty"`    // Preferred decoder backends in order, empty uses the global preference
 }
 
 // Config represents the application configuration
 type Config struct {
-	WebPort   string   `json:"webPort"`
-	Cameras   []Camera `json:"cameras"`
-	EnableGPU bool     `json:"enableGPU"` // Enable NVIDIA GPU hardware acceleration
+	WebPort     string          `json:"webPort"`
+	Cameras     []Camera        `json:"cameras"`
+	EnableGPU   bool            `json:"enableGPU"`             // Enable hardware decoding (CUDA, VA-API, QSV, V4L2-M2M)
+	Backends    []string        `json:"backends,omitempty"`    // Default decoder backend preference, empty tries every hardware backend then CPU
+	IdleTimeout int             `json:"idleTimeout,omitempty"` // Seconds without viewers before stopping an on-demand stream
+	Adaptive    *AdaptiveConfig `json:"adaptive,omitempty"`    // Adapt camera frame rates to host load
+	Decoders    *DecoderBudget  `json:"decoders,omitempty"`    // Limits on concurrent decoders
+	UptimeLog   string          `json:"uptimeLog,omitempty"`   // Append-only log of camera state transitions, default uptime.jsonl next to the config file
+	UptimeDays  int             `json:"uptimeDays,omitempty"`  // Days of uptime history kept in the log, default 90
+	Events      *EventsConfig   `json:"events,omitempty"`      // Sinks for camera lifecycle and motion events
 }
 
 // StreamInfo holds stream and viewer information
@@ -72,19 +107,43 @@ type StreamInfo struct {
 	LastViewed  time.Time
 	StopTimer   *time.Timer
 	mu          sync.Mutex
+
+	camera      *Camera                       // Copy of the camera config, replaced under mu when the camera is updated
+	stop        chan struct{}                 // Closed by StopStream
+	stopOnce    sync.Once                     // Guards closing stop
+	subscribers map[chan *image.RGBA]struct{} // Virtual cameras fed from this stream
+	viewers     map[string]*viewerSession     // Active viewer sessions by ID
+	motion      motionDetector                // Motion state of the transformed frames
+	decodeCheck chan struct{}                 // Signals the feed loop to re-evaluate the decode mode
+	rate        frameRate                     // Input rate, latency and frame rate cap
+	stages      stageTimes                    // Per-stage timing of the frame pipeline
+	decoder     string                        // Decoder state: queued, backend name or empty
+	gpuDevice   string                        // GPU device of a hardware decoder
+	metrics     streamMetrics                 // Live counters reported in the camera status
+	overlays    []timedOverlay                // Drawn until they expire, added over MQTT
+	snapshots   []chan []byte                 // Waiting for the next encoded frame
+	preview     *preview.Buffer               // Recent frames for event previews, created with the first frame
 }
 
 // StreamManager manages multiple camera streams
 type StreamManager struct {
-	config          *Config
-	configPath      string   // Path to the config file
-	streams         sync.Map // map[string]*StreamInfo
-	mu              sync.RWMutex
-	idleTimeout     time.Duration // Time to wait before stopping stream when no viewers
-	gpuAvailable    bool          // Whether GPU hardware acceleration is available
-	gpuSessionCount int           // Current number of active GPU decode sessions
-	maxGPUSessions  int           // Maximum concurrent GPU decode sessions
-	gpuMu           sync.Mutex    // Mutex to protect GPU session count
+	config      *Config
+	configPath  string   // Path to the config file
+	streams     sync.Map // map[string]*StreamInfo
+	logs        sync.Map // map[string]*logRing, recent ffmpeg output per camera
+	mu          sync.RWMutex
+	idleTimeout time.Duration          // Time to wait before stopping stream when no viewers
+	backends    *backendSelector       // Picks the decoder backend per camera
+	gpus        *gpuPool               // Hardware decode sessions per GPU device
+	decoders    *decoderScheduler      // Hands out decoder slots by camera priority
+	uptime      *uptimeLog             // Durable log of camera state transitions
+	events      *eventBus              // Camera and stream events for SSE clients
+	sinks       *eventSinks.Dispatcher // Sends events to webhooks, MQTT and scripts
+	notifiers   *notifier.Router       // Sends notifications about events
+	previews    *PreviewConfig         // Clips of motion events, nil if disabled. Not changed after start
+
+	metrics      *promMetrics.Registry     // Served on /metrics
+	httpDuration *promMetrics.HistogramVec // HTTP request latencies by route
 }
 
 // NewStreamManager creates a new stream manager
@@ -95,81 +154,66 @@ func NewStreamManager(configPath string) (*StreamManager, error) {
 	}
 
 	sm := &StreamManager{
-		config:          config,
-		configPath:      configPath,
-		idleTimeout:     30 * time.Second, // Stop stream after 30 seconds of no viewers
-		gpuAvailable:    false,
-		gpuSessionCount: 0,
-		maxGPUSessions:  8, // RTX 4090 supports 8-10 concurrent NVDEC sessions
+		config:      config,
+		configPath:  configPath,
+		idleTimeout: 30 * time.Second, // Stop stream after 30 seconds of no viewers
+	}
+	if config.IdleTimeout > 0 {
+		sm.idleTimeout = time.Duration(config.IdleTimeout) * time.Second
 	}
 
-	// Check GPU availability if enabled in config
-	if config.EnableGPU {
-		sm.gpuAvailable = sm.checkGPUAvailability()
-		if sm.gpuAvailable {
-			log.Printf("✓ NVIDIA GPU hardware acceleration enabled")
-		} else {
-			log.Printf("⚠ GPU acceleration requested but not available, falling back to CPU")
+	cpuSlots := 0
+	if config.Decoders != nil {
+		cpuSlots = config.Decoders.CPUSlots
+		for _, d := range config.Decoders.GPUDevices {
+			if d.Backend != "" {
+				if b, ok := backendByName(d.Backend); !ok || !b.Hardware() {
+					return nil, fmt.Errorf("GPU device %s: unknown hardware backend %q", d.Device, d.Backend)
+				}
+			}
 		}
-	} else {
-		log.Printf("GPU acceleration disabled in config")
 	}
-
-	return sm, nil
-}
-
-// acquireGPUSession attempts to acquire a GPU decode session
-// Returns true if session was acquired, false if max sessions reached
-func (sm *StreamManager) acquireGPUSession() bool {
-	sm.gpuMu.Lock()
-	defer sm.gpuMu.Unlock()
-
-	if sm.gpuSessionCount >= sm.maxGPUSessions {
-		log.Printf("⚠ GPU sessions full (%d/%d), falling back to CPU", sm.gpuSessionCount, sm.maxGPUSessions)
-		return false
+	sm.metrics = sm.newMetricsRegistry()
+	if sm.uptime, err = openUptimeLog(uptimeLogPath(configPath, config.UptimeLog), time.Duration(config.UptimeDays)*24*time.Hour); err != nil {
+		// Streaming works without it, only the uptime reports are unavailable
+		log.Printf("⚠ Uptime history disabled: %v", err)
+		sm.uptime = newMemoryUptimeLog()
 	}
-
-	sm.gpuSessionCount++
-	log.Printf("✓ GPU session acquired (%d/%d)", sm.gpuSessionCount, sm.maxGPUSessions)
-	return true
-}
-
-// releaseGPUSession releases a GPU decode session
-func (sm *StreamManager) releaseGPUSession() {
-	sm.gpuMu.Lock()
-	defer sm.gpuMu.Unlock()
-
-	if sm.gpuSessionCount > 0 {
-		sm.gpuSessionCount--
-		log.Printf("GPU session released (%d/%d)", sm.gpuSessionCount, sm.maxGPUSessions)
+	sm.events = newEventBus()
+	if sm.sinks, err = sm.newSinks(configPath, config.Events); err != nil {
+		return nil, fmt.Errorf("invalid events config: %w", err)
 	}
-}
-
-// checkGPUAvailability checks if NVIDIA GPU is available for hardware acceleration
-func (sm *StreamManager) checkGPUAvailability() bool {
-	// Check if nvidia-smi is available (optional check, not critical)
-	cmd := exec.Command("nvidia-smi", "-L")
-	if err := cmd.Run(); err != nil {
-		log.Printf("nvidia-smi not found or failed: %v (continuing to check FFmpeg CUDA support)", err)
-		// Don't return false here - nvidia-smi might not be available but CUDA runtime could still work
+	sm.sinks.Scripts().SetActionHandler(sm.handleScriptAction)
+	if config.Events != nil {
+		if sm.notifiers, err = notifier.NewRouter(config.Events.Notifiers, config.Events.NotificationLimits); err != nil {
+			return nil, fmt.Errorf("invalid events config: %w", err)
+		}
+		if err := config.Events.Previews.validate(); err != nil {
+			return nil, fmt.Errorf("invalid events config: %w", err)
+		}
+		sm.previews = config.Events.Previews
 	}
+	sm.gpus = newGPUPool(config.Decoders)
+	sm.decoders = newDecoderScheduler(sm, cpuSlots)
 
-	// Check if ffmpeg supports CUDA (this is the critical check)
-	cmd = exec.Command("ffmpeg", "-hwaccels")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Failed to check ffmpeg hardware acceleration support: %v", err)
-		return false
+	if err := validateBackends(config.Backends); err != nil {
+		return nil, err
 	}
 
-	// Check if "cuda" is in the list of hardware accelerators
-	if bytes.Contains(output, []byte("cuda")) {
-		log.Printf("✓ NVIDIA GPU hardware acceleration enabled (FFmpeg supports CUDA)")
-		return true
+	// Probe hardware decoders if enabled in config
+	sm.backends = newBackendSelector(ffmpegProber{}, config.EnableGPU, config.Backends)
+	if config.EnableGPU {
+		available := sm.backends.available()
+		if len(available) > 1 {
+			log.Printf("✓ Hardware decoding enabled, available backends: %s", strings.Join(available, ", "))
+		} else {
+			log.Printf("⚠ Hardware decoding requested but no backend is available, falling back to CPU")
+		}
+	} else {
+		log.Printf("Hardware decoding disabled in config")
 	}
 
-	log.Printf("FFmpeg does not support CUDA hardware acceleration")
-	return false
+	return sm, nil
 }
 
 // loadConfig loads configuration from file
@@ -215,24 +259,25 @@ func (sm *StreamManager) SaveConfig(path string) error {
 	return nil
 }
 
-// GetCamera returns a camera by ID
+// GetCamera returns a copy of a camera by ID
 func (sm *StreamManager) GetCamera(id string) (*Camera, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
 	for i := range sm.config.Cameras {
 		if sm.config.Cameras[i].ID == id {
-			return &sm.config.Cameras[i], nil
+			camera := sm.config.Cameras[i]
+			return &camera, nil
 		}
 	}
 	return nil, fmt.Errorf("camera not found: %s", id)
 }
 
-// GetAllCameras returns all cameras
+// GetAllCameras returns a copy of all cameras
 func (sm *StreamManager) GetAllCameras() []Camera {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	return sm.config.Cameras
+	return append([]Camera(nil), sm.config.Cameras...)
 }
 
 // GetConfig returns the configuration
@@ -250,6 +295,7 @@ func (sm *StreamManager) UpdateCameraROI(id string, roi []ROI) error {
 	for i := range sm.config.Cameras {
 		if sm.config.Cameras[i].ID == id {
 			sm.config.Cameras[i].ROI = roi
+			sm.updateStreamCamera(sm.config.Cameras[i])
 			return nil
 		}
 	}
@@ -264,12 +310,61 @@ func (sm *StreamManager) UpdateCameraDrawElements(id string, drawElements []Draw
 	for i := range sm.config.Cameras {
 		if sm.config.Cameras[i].ID == id {
 			sm.config.Cameras[i].DrawElements = drawElements
+			sm.updateStreamCamera(sm.config.Cameras[i])
 			return nil
 		}
 	}
 	return fmt.Errorf("camera not found: %s", id)
 }
 
+// updateStreamCamera gives a running stream a copy of its updated camera config.
+// Streams never read sm.config directly, so updates and deletes cannot race with the frame loop.
+func (sm *StreamManager) updateStreamCamera(camera Camera) {
+	if v, ok := sm.streams.Load(camera.ID); ok {
+		info := v.(*StreamInfo)
+		info.mu.Lock()
+		info.camera = &camera
+		info.mu.Unlock()
+		// The decode mode may have changed
+		info.requestDecodeCheck()
+	}
+}
+
+// cameraConfig returns the stream's copy of its camera config.
+// The copy is replaced, never modified, so it can be read without holding si.mu.
+func (si *StreamInfo) cameraConfig() *Camera {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	return si.camera
+}
+
+// validateCamera checks the camera's source and transform settings.
+// The caller must hold sm.mu.
+func (sm *StreamManager) validateCamera(camera Camera) error {
+	if err := sm.validateVirtualSource(camera); err != nil {
+		return err
+	}
+	if err := validateLayout(camera); err != nil {
+		return fmt.Errorf("camera %s: %w", camera.ID, err)
+	}
+	if err := validateTransforms(camera.Transforms); err != nil {
+		return fmt.Errorf("camera %s: %w", camera.ID, err)
+	}
+	if err := validateMode(camera); err != nil {
+		return fmt.Errorf("camera %s: %w", camera.ID, err)
+	}
+	if err := validateMotion(camera); err != nil {
+		return fmt.Errorf("camera %s: %w", camera.ID, err)
+	}
+	if mode := camera.decodeMode(); mode != DecodeFull && mode != DecodeKeyframes {
+		return fmt.Errorf("camera %s: unknown decode mode %q", camera.ID, camera.DecodeMode)
+	}
+	if err := validateBackends(camera.Backends); err != nil {
+		return fmt.Errorf("camera %s: %w", camera.ID, err)
+	}
+	return nil
+}
+
 // AddCamera adds a new camera to the configuration
 func (sm *StreamManager) AddCamera(camera Camera) error {
 	sm.mu.Lock()
@@ -282,10 +377,16 @@ func (sm *StreamManager) AddCamera(camera Camera) error {
 		}
 	}
 
+	if err := sm.validateCamera(camera); err != nil {
+		return err
+	}
+
 	sm.config.Cameras = append(sm.config.Cameras, camera)
+	sm.emit(EventCameraAdded, camera.ID, nil)
+	sm.notify(EventConfigChanged, camera.ID, map[string]any{"action": "added"})
 
-	// Auto-start stream if camera is enabled
-	if camera.Enabled {
+	// Auto-start stream if camera is enabled and should be running
+	if camera.Enabled && camera.shouldRun(time.Now()) {
 		go func() {
 			if err := sm.StartStream(camera.ID); err != nil {
 				log.Printf("Failed to auto-start stream for camera %s: %v", camera.ID, err)
@@ -298,38 +399,60 @@ func (sm *StreamManager) AddCamera(camera Camera) error {
 
 // UpdateCamera updates an existing camera
 func (sm *StreamManager) UpdateCamera(id string, camera Camera) error {
+	return sm.UpdateCameraFunc(id, func(c *Camera) { *c = camera })
+}
+
+// UpdateCameraFunc applies change to a copy of an existing camera and stores the result.
+// The camera is read and written under one lock, so concurrent changes are not lost.
+// change must not call back into the StreamManager.
+func (sm *StreamManager) UpdateCameraFunc(id string, change func(c *Camera)) error {
 	sm.mu.Lock()
-	oldCamera := Camera{}
-	found := false
+	index := -1
 	for i := range sm.config.Cameras {
 		if sm.config.Cameras[i].ID == id {
-			oldCamera = sm.config.Cameras[i]
-			found = true
-			// Keep the same ID
-			camera.ID = id
-			sm.config.Cameras[i] = camera
+			index = i
 			break
 		}
 	}
-	sm.mu.Unlock()
-
-	if !found {
+	if index < 0 {
+		sm.mu.Unlock()
 		return fmt.Errorf("camera not found: %s", id)
 	}
 
-	// Handle stream state changes based on enabled status
+	oldCamera := sm.config.Cameras[index]
+	camera := oldCamera
+	change(&camera)
+	// Keep the same ID
+	camera.ID = id
+	if err := sm.validateCamera(camera); err != nil {
+		sm.mu.Unlock()
+		return err
+	}
+	sm.config.Cameras[index] = camera
+	sm.updateStreamCamera(camera)
+	sm.mu.Unlock()
+
+	sm.emit(EventCameraUpdated, id, nil)
+	sm.notify(EventConfigChanged, id, map[string]any{"action": "updated"})
+
+	// Handle stream state changes based on enabled status and mode
+	_, streamErr := sm.GetStreamInfo(id)
+	running := streamErr == nil
 	if oldCamera.Enabled && !camera.Enabled {
 		// Camera was enabled, now disabled - stop stream
 		sm.StopStream(id)
 		log.Printf("Auto-stopped stream for disabled camera: %s", id)
-	} else if !oldCamera.Enabled && camera.Enabled {
-		// Camera was disabled, now enabled - start stream
+	} else if camera.Enabled && camera.shouldRun(time.Now()) && !running {
+		// Camera should be running but is not - start stream
 		go func() {
 			if err := sm.StartStream(id); err != nil {
 				log.Printf("Failed to auto-start stream for camera %s: %v", id, err)
 			}
 		}()
 		log.Printf("Auto-starting stream for enabled camera: %s", id)
+	} else if running {
+		// Mode may have changed to on-demand, stop once idle
+		sm.checkIdle(id)
 	}
 
 	return nil
@@ -345,8 +468,15 @@ func (sm *StreamManager) DeleteCamera(id string) error {
 			// Stop the stream if it's running
 			sm.StopStream(id)
 
+			sm.logs.Delete(id)
+			// The camera is gone by the time the event is enriched
+			deleted := map[string]any{"action": "deleted"}
+			sm.sinks.Dispatch(eventSinks.Event{Type: EventConfigChanged, CameraID: id, CameraName: sm.config.Cameras[i].Name, Data: deleted})
+			sm.sendNotification(EventConfigChanged, id, sm.config.Cameras[i].Name, deleted, nil)
+
 			// Remove from slice
 			sm.config.Cameras = append(sm.config.Cameras[:i], sm.config.Cameras[i+1:]...)
+			sm.emit(EventCameraDeleted, id, nil)
 			return nil
 		}
 	}
@@ -355,22 +485,34 @@ func (sm *StreamManager) DeleteCamera(id string) error {
 
 // StopStream stops streaming for a camera
 func (sm *StreamManager) StopStream(cameraID string) error {
-	if streamInfo, ok := sm.streams.LoadAndDelete(cameraID); ok {
-		// Cancel any pending stop timer
-		info := streamInfo.(*StreamInfo)
-		info.mu.Lock()
-		if info.StopTimer != nil {
-			info.StopTimer.Stop()
-		}
-		info.mu.Unlock()
-
-		log.Printf("Stopped stream for camera: %s", cameraID)
+	if streamInfo, ok := sm.streams.Load(cameraID); ok {
+		sm.stopStreamInfo(cameraID, streamInfo.(*StreamInfo))
 		return nil
 	}
 	return fmt.Errorf("stream not found for camera: %s", cameraID)
 }
 
-// AddViewer increments the viewer count for a stream
+// stopStreamInfo stops a specific stream instance, leaving any newer stream for the camera alone
+func (sm *StreamManager) stopStreamInfo(cameraID string, info *StreamInfo) {
+	if !sm.streams.CompareAndDelete(cameraID, info) {
+		return
+	}
+	sm.emit(EventStreamStopped, cameraID, nil)
+	sm.setState(cameraID, StateStopped, "")
+
+	// Cancel any pending stop timer
+	info.mu.Lock()
+	if info.StopTimer != nil {
+		info.StopTimer.Stop()
+	}
+	info.mu.Unlock()
+	info.stopOnce.Do(func() { close(info.stop) })
+
+	log.Printf("Stopped stream for camera: %s", cameraID)
+}
+
+// AddViewer increments the viewer count for a stream.
+// Returns ErrViewerLimitReached if the camera already has maxViewers viewers.
 func (sm *StreamManager) AddViewer(cameraID string) error {
 	streamInfo, err := sm.GetStreamInfo(cameraID)
 	if err != nil {
@@ -380,6 +522,12 @@ func (sm *StreamManager) AddViewer(cameraID string) error {
 	streamInfo.mu.Lock()
 	defer streamInfo.mu.Unlock()
 
+	camera := streamInfo.camera
+
+	if camera.MaxViewers > 0 && streamInfo.ViewerCount >= camera.MaxViewers {
+		return fmt.Errorf("camera %s: %w (%d)", cameraID, ErrViewerLimitReached, camera.MaxViewers)
+	}
+
 	streamInfo.ViewerCount++
 	streamInfo.LastViewed = time.Now()
 
@@ -389,6 +537,9 @@ func (sm *StreamManager) AddViewer(cameraID string) error {
 		streamInfo.StopTimer = nil
 	}
 
+	// A viewer needs every frame, leave keyframe-only decoding
+	streamInfo.requestDecodeCheck()
+
 	log.Printf("Viewer added to camera %s, total viewers: %d", cameraID, streamInfo.ViewerCount)
 	return nil
 }
@@ -409,20 +560,9 @@ func (sm *StreamManager) RemoveViewer(cameraID string) error {
 
 	log.Printf("Viewer removed from camera %s, remaining viewers: %d", cameraID, streamInfo.ViewerCount)
 
-	// 禁用自动停止功能 - 流将持续运行，避免内存泄漏
-	// If no viewers left, schedule stream stop
-	// if streamInfo.ViewerCount == 0 {
-	// 	// Cancel any existing timer
-	// 	if streamInfo.StopTimer != nil {
-	// 		streamInfo.StopTimer.Stop()
-	// 	}
-
-	// 	// Schedule stream stop after idle timeout
-	// 	streamInfo.StopTimer = time.AfterFunc(sm.idleTimeout, func() {
-	// 		log.Printf("No viewers for %v, stopping stream for camera: %s", sm.idleTimeout, cameraID)
-	// 		sm.StopStream(cameraID)
-	// 	})
-	// }
+	// If no viewers left, schedule stream stop (on-demand cameras only)
+	sm.scheduleIdleStop(streamInfo)
+	streamInfo.requestDecodeCheck()
 
 	return nil
 }
@@ -479,17 +619,42 @@ func (sm *StreamManager) StartStream(cameraID string) error {
 		Stream:      stream,
 		ViewerCount: 0,
 		LastViewed:  time.Now(),
+		camera:      camera,
+		stop:        make(chan struct{}),
+		subscribers: make(map[chan *image.RGBA]struct{}),
+		viewers:     make(map[string]*viewerSession),
+		decodeCheck: make(chan struct{}, 1),
+		rate:        frameRate{targetFPS: camera.MaxFPS},
+		metrics:     streamMetrics{startedAt: time.Now()},
+	}
+	if _, loaded := sm.streams.LoadOrStore(cameraID, streamInfo); loaded {
+		log.Printf("Stream already running for camera: %s", cameraID)
+		return nil
 	}
-	sm.streams.Store(cameraID, streamInfo)
+	sm.emit(EventStreamStarted, cameraID, nil)
+	sm.setState(cameraID, StateStarting, "")
 
 	// Start processing in goroutine
-	go sm.processCamera(camera, stream)
+	if parentID, ok := camera.ParentID(); ok {
+		go sm.processVirtualCamera(streamInfo, parentID)
+	} else {
+		go sm.processCamera(streamInfo)
+	}
 
 	log.Printf("Started stream for camera: %s (%s)", camera.ID, camera.Name)
 	return nil
 }
 
-// isGPUError checks if the error message indicates a GPU-related failure
+// recordState records a state transition of a running stream. Transitions reported by a
+// stream that was already stopped or replaced are ignored.
+func (sm *StreamManager) recordState(cameraID string, info *StreamInfo, state, reason string) {
+	if current, ok := sm.streams.Load(cameraID); !ok || current != info {
+		return
+	}
+	sm.setState(cameraID, state, reason)
+}
+
+// isGPUError checks if the error message indicates a CUDA-related failure
 func isGPUError(errorMsg string) bool {
 	gpuErrorPatterns := []string{
 		"Cannot load libnvcuvid",
@@ -509,213 +674,332 @@ func isGPUError(errorMsg string) bool {
 	return false
 }
 
-// isFatalConnectionError checks if the error is a fatal connection error that should not be retried
-func isFatalConnectionError(errorMsg string) bool {
-	fatalErrorPatterns := []string{
-		"404 Not Found",
-		"Stream Not Found",
-		"401 Unauthorized",
-		"403 Forbidden",
-		"Invalid credentials",
-	}
-
-	for _, pattern := range fatalErrorPatterns {
-		if strings.Contains(errorMsg, pattern) {
-			return true
-		}
-	}
-	return false
-}
-
-// processCamera processes video frames from a camera
-func (sm *StreamManager) processCamera(camera *Camera, stream *mjpeg.Stream) {
+// processCamera processes video frames from a camera.
+// Every decoder run reads the stream's current copy of the camera config.
+func (sm *StreamManager) processCamera(info *StreamInfo) {
+	cameraID := info.cameraConfig().ID
 	frameChannel := make(chan FrameMsg)
-	gpuErrorCount := 0
-	const maxGPUErrors = 3 // 连续3次GPU错误后回退
+	const maxBackendErrors = 3 // 连续3次硬件解码错误后回退
 	fatalErrorCount := 0
 	const maxFatalErrors = 3 // 连续3次致命错误后停止重试
 
-	// Try to acquire GPU session if GPU is available
-	useGPU := false
-	if sm.gpuAvailable {
-		useGPU = sm.acquireGPUSession()
-	}
+	// Backend of the running decoder and the backends that failed for this camera
+	var backend backendState
+	logs := sm.cameraLogs(cameraID)
 
-	// Ensure GPU session is released and stream is cleaned up when camera processing stops
+	// Ensure stream is cleaned up when camera processing stops
 	defer func() {
-		if useGPU {
-			sm.releaseGPUSession()
+		// Remove stream from manager when stopping and detach derived cameras
+		if sm.streams.CompareAndDelete(cameraID, info) {
+			sm.emit(EventStreamStopped, cameraID, nil)
 		}
-		// Remove stream from manager when stopping
-		sm.streams.Delete(camera.ID)
-		log.Printf("Stream processing stopped and cleaned up for camera: %s", camera.ID)
+		info.closeSubscribers()
+		log.Printf("Stream processing stopped and cleaned up for camera: %s", cameraID)
 	}()
 
-	// Channel to signal the feed goroutine to stop
-	stopFeed := make(chan bool)
-	feedStopped := make(chan bool)
+	done := make(chan struct{})
+	defer close(done)
+	go sm.watchStall(cameraID, info, done)
+
+	// Context to stop the feed goroutine and kill ffmpeg, cancelled by StopStream or fatal errors
+	ctx, stopFeed := context.WithCancel(context.Background())
+	defer stopFeed()
+	go func() {
+		select {
+		case <-info.stop:
+			stopFeed()
+		case <-ctx.Done():
+		}
+	}()
 
 	go func() {
-		defer close(feedStopped)
+		// Closing the channel ends the frame loop below
+		defer close(frameChannel)
 		for {
 			select {
-			case <-stopFeed:
-				log.Printf("Stopping RTSP feed goroutine for camera: %s", camera.ID)
+			case <-ctx.Done():
+				log.Printf("Stopping RTSP feed goroutine for camera: %s", cameraID)
 				return
 			default:
-				sm.processRTSPFeed(camera.RtspUrl, frameChannel, useGPU)
+				// Wait for a decoder slot, a GPU session if the preferred backend is hardware
+				camera := info.cameraConfig()
+				preferred := sm.backends.selectFor(camera.Backends, backend.failedSet())
+				slot, err := sm.decoders.acquire(ctx, camera, info, preferred, backend.avoidSet())
+				if err != nil {
+					return
+				}
+				selected, device := preferred, ""
+				if slot.device != nil {
+					device = slot.device.Device
+				} else if selected.Hardware() {
+					selected = cpuBackend{}
+				}
+				backend.set(selected, slot.device)
+				if slot.device != nil {
+					info.setDecoder(selected.Name(), slot.device.name())
+				} else {
+					info.setDecoder(selected.Name(), "")
+				}
+
+				keyframesOnly := info.keyframesOnly()
+				runCtx, stopRun := context.WithCancel(ctx)
+				switched := make(chan struct{})
+				go watchDecodeMode(runCtx, info, keyframesOnly, func() {
+					close(switched)
+					stopRun()
+				})
+				go func() {
+					select {
+					case <-slot.preempted:
+						stopRun()
+					case <-runCtx.Done():
+					}
+				}()
+
+				sm.processRTSPFeed(runCtx, camera.RtspUrl, frameChannel, feedOptions{
+					backend:       selected,
+					device:        device,
+					keyframesOnly: keyframesOnly,
+					allowFrame:    info.allowFrame,
+					logs:          logs,
+					metrics:       &info.metrics,
+				})
+				stopRun()
+				sm.decoders.release(slot)
+
+				// Restart right away when only the decode mode changed or the slot was taken
+				select {
+				case <-switched:
+					log.Printf("Switching decode mode for camera %s", cameraID)
+					continue
+				case <-slot.preempted:
+					log.Printf("Decoder for camera %s preempted, waiting for a free slot", cameraID)
+					continue
+				default:
+				}
 
 				// Check if we should stop before retrying
 				select {
-				case <-stopFeed:
+				case <-ctx.Done():
 					return
 				case <-time.After(5 * time.Second):
-					log.Printf("Restarting RTSP feed for camera: %s", camera.ID)
+					log.Printf("Restarting RTSP feed for camera: %s", cameraID)
+					info.metrics.restarts.Add(1)
 				}
 			}
 		}
 	}()
 
-	lastErrorWasExit := false // Track if the last error was an exit error
+	// Render and encode run in their own stages so a slow encode never stalls decoding
+	pipeline := sm.startPipeline(info, false)
+	defer pipeline.close()
+
+	// Errors printed during the current ffmpeg run. Fatal errors count as they arrive,
+	// the others are judged once the run exits.
+	runFatal := false     // 401/404 等重试无法解决的错误，已计入fatalErrorCount
+	runBackendError := "" // First hardware decoder error
+	runReason := ""       // First error of the run, recorded as the outage reason
+	streaming := false    // Frames arrived since the last failed run
 
 	for msg := range frameChannel {
 		if msg.Error != "" {
-			// Only log non-exit errors and summaries to reduce noise
-			if !strings.Contains(msg.Error, "FFmpeg exited with error") {
-				log.Printf("Error from camera %s: %s", camera.ID, msg.Error)
+			switch msg.Class {
+			case LogExit:
+				// Judge the run below by the errors it printed
+				if runReason == "" {
+					runReason = msg.Error
+				}
+				streaming = false
+				sm.recordState(cameraID, info, StateBackoff, runReason)
+				runReason = ""
+			case LogHardware:
+				if runBackendError == "" {
+					log.Printf("Hardware decoder error from camera %s: %s", cameraID, msg.Error)
+					runBackendError = msg.Error
+				}
+				if runReason == "" {
+					runReason = msg.Class + ": " + msg.Error
+				}
+				continue
+			default:
+				log.Printf("Error from camera %s: %s", cameraID, msg.Error)
+				if runReason == "" && msg.Class != "" {
+					runReason = msg.Class + ": " + msg.Error
+				}
+				// 检测致命连接错误（401/404等），ffmpeg已被终止，达到上限后停止重试
+				if isFatalLogClass(msg.Class) && !runFatal {
+					runFatal = true
+					fatalErrorCount++
+					log.Printf("Fatal connection error #%d detected for camera %s", fatalErrorCount, cameraID)
+
+					if fatalErrorCount >= maxFatalErrors {
+						log.Printf("⚠ Fatal connection error detected for camera %s after %d attempts", cameraID, fatalErrorCount)
+						log.Printf("⚠ Stopping stream retry. Will restart on next viewer request.")
+						sm.recordState(cameraID, info, StateOffline, runReason)
+						stopFeed()
+						for range frameChannel {
+							// Drain until the feed goroutine stops
+						}
+						return
+					}
+				}
+				continue
 			}
 
-			// Track FFmpeg exit errors
-			isExitError := strings.Contains(msg.Error, "FFmpeg exited with error")
-			if isExitError {
-				lastErrorWasExit = true
-				continue // Wait for STDERR message
+			// 检测硬件解码错误，先换GPU设备，再回退到下一个后端
+			device := backend.currentDevice()
+			failure, isBackendError := backend.recordError(runBackendError, maxBackendErrors, sm.gpus.devicesFor)
+			if failure.backend != "" {
+				log.Printf("⚠ %s decoding failed %d times for camera %s, falling back to the next backend", failure.backend, maxBackendErrors, cameraID)
+			} else if failure.device != "" {
+				log.Printf("⚠ Decoding failed %d times for camera %s on GPU device %s, trying another device", maxBackendErrors, cameraID, failure.device)
 			}
-
-			// 检测致命连接错误（404等），停止重试
-			isFatal := isFatalConnectionError(msg.Error)
-			if isFatal && lastErrorWasExit {
-				// This is a fatal error from STDERR following an exit error
-				fatalErrorCount++
-				lastErrorWasExit = false // Reset for next iteration
-				log.Printf("Fatal connection error #%d detected for camera %s", fatalErrorCount, camera.ID)
-
-				if fatalErrorCount >= maxFatalErrors {
-					log.Printf("⚠ Fatal connection error detected for camera %s after %d attempts", camera.ID, fatalErrorCount)
-					log.Printf("⚠ Stopping stream retry. Will restart on next viewer request.")
-					close(stopFeed)
-					<-feedStopped // Wait for feed goroutine to stop
-					return
-				}
-			} else {
-				// 只有在这不是GPU错误时才重置致命错误计数
-				if !isGPUError(msg.Error) && !isFatal {
-					fatalErrorCount = 0
-				}
-				lastErrorWasExit = false
+			// Failures from several cameras take the whole device out of rotation
+			if isBackendError && device != nil && sm.gpus.recordError(device, cameraID) {
+				sm.decoders.preemptDevice(device)
 			}
 
-			// 检测GPU错误并自动回退到CPU模式
-			if useGPU && isGPUError(msg.Error) {
-				gpuErrorCount++
-				if gpuErrorCount >= maxGPUErrors {
-					log.Printf("⚠ GPU acceleration failed %d times for camera %s, falling back to CPU mode", gpuErrorCount, camera.ID)
-					log.Printf("⚠ GPU Error detected. Releasing GPU session and switching to CPU mode for this stream")
-
-					// Release GPU session and switch to CPU mode
-					sm.releaseGPUSession()
-					useGPU = false
-					gpuErrorCount = 0 // 重置计数器
-				}
-			} else {
-				gpuErrorCount = 0 // 非GPU错误，重置计数器
+			// 致命错误在到达时已计数
+			isFatal := runFatal
+			runFatal, runBackendError = false, ""
+			if !isFatal && !isBackendError {
+				// 只有在这不是硬件解码错误时才重置致命错误计数
+				fatalErrorCount = 0
 			}
 			continue
 		}
 
 		// 成功处理帧，重置所有错误计数
-		gpuErrorCount = 0
+		backend.resetErrors()
 		fatalErrorCount = 0
-		lastErrorWasExit = false
+		runFatal, runBackendError, runReason = false, "", ""
+		if !streaming {
+			streaming = true
+			sm.recordState(cameraID, info, StateStreaming, "")
+		}
 
 		if msg.Frame != nil {
-			rgba, ok := msg.Frame.(*image.RGBA)
-			if !ok {
-				rgba = image.NewRGBA(msg.Frame.Bounds())
-				draw.Draw(rgba, rgba.Bounds(), msg.Frame, msg.Frame.Bounds().Min, draw.Src)
+			start := time.Now()
+			frame := &pipelineFrame{start: start.Add(-msg.DecodeTime)}
+			if rgba, ok := msg.Frame.(*image.RGBA); ok {
+				frame.img = rgba
+			} else {
+				frame.img = frameImages.get(msg.Frame.Bounds())
+				frame.pooled = true
+				draw.Draw(frame.img, frame.img.Bounds(), msg.Frame, msg.Frame.Bounds().Min, draw.Src)
 			}
+			info.recordStage(stageDecode, msg.DecodeTime+time.Since(start))
 
-			// Draw ROI rectangles if configured (backward compatibility)
-			if len(camera.ROI) > 0 {
-				sm.drawROI(rgba, camera.ROI)
-			}
+			// Hand the untouched frame to virtual cameras before drawing on it
+			info.publish(frame.img)
+			pipeline.submit(frame)
+		}
+	}
+}
 
-			// Draw new drawing elements
-			if len(camera.DrawElements) > 0 {
-				sm.drawElements(rgba, camera.DrawElements)
-			}
+// drawOverlays draws the camera's ROI rectangles, drawing elements and runtime overlays on a frame
+func (sm *StreamManager) drawOverlays(camera *Camera, info *StreamInfo, rgba *image.RGBA) {
+	// Draw ROI rectangles if configured (backward compatibility)
+	if len(camera.ROI) > 0 {
+		sm.drawROI(rgba, camera.ROI)
+	}
 
-			// Encode to JPEG and update stream
-			var buf bytes.Buffer
-			if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 80}); err == nil {
-				stream.UpdateJPEG(buf.Bytes())
-			}
-		}
+	// Draw new drawing elements
+	if len(camera.DrawElements) > 0 {
+		sm.drawElements(rgba, camera.DrawElements)
+	}
+
+	if elements := info.activeOverlays(time.Now()); len(elements) > 0 {
+		sm.drawElements(rgba, elements)
 	}
 }
 
 // FrameMsg represents a frame message
 type FrameMsg struct {
-	Frame    image.Image
-	Error    string
-	ExitCode int
+	Frame      image.Image
+	Error      string
+	ExitCode   int
+	DecodeTime time.Duration // Time spent decoding Frame
+	Class      string        // Log class of Error
 }
 
-// processRTSPFeed processes RTSP feed using ffmpeg
-func (sm *StreamManager) processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg, useGPU bool) {
-	var args []string
+// feedOptions configures one ffmpeg run
+type feedOptions struct {
+	backend       DecoderBackend
+	device        string         // GPU device passed to a hardware backend
+	keyframesOnly bool           // Decode only keyframes
+	allowFrame    func() bool    // Called for every complete frame; rejected frames are dropped before decoding
+	logs          *logRing       // Receives the classified stderr lines
+	metrics       *streamMetrics // Counts corrupted frames and records the source codec
+}
 
-	// Build FFmpeg command based on GPU availability
-	if useGPU {
-		// GPU-accelerated pipeline
-		log.Printf("Using GPU acceleration for stream: %s", rtspURL)
-		args = []string{
-			"-hwaccel", "cuda",
-			"-hwaccel_output_format", "cuda",
+// processRTSPFeed processes RTSP feed using ffmpeg with the given decoder backend.
+// Errors printed by ffmpeg are classified and sent to msgChannel as they happen.
+func (sm *StreamManager) processRTSPFeed(ctx context.Context, rtspURL string, msgChannel chan<- FrameMsg, opts feedOptions) {
+	var args []string
+	backend := opts.backend
+
+	// In keyframe-only mode the decoder skips non-IDR frames and every decoded frame is kept
+	inputArgs := backend.InputArgs(opts.device)
+	gpuDecimate := "select=not(mod(n\\,5))"
+	cpuDecimate := `select=not(mod(n\,10))`
+	if opts.keyframesOnly {
+		inputArgs = append(inputArgs, "-skip_frame", "nokey")
+		gpuDecimate = ""
+		cpuDecimate = ""
+	}
+
+	// Build FFmpeg command based on the decoder backend
+	if backend.Hardware() {
+		// Hardware-accelerated pipeline
+		log.Printf("Using %s hardware decoding for stream: %s", backend.Name(), rtspURL)
+		args = []string{"-hide_banner"}
+		args = append(args, inputArgs...)
+		args = append(args,
 			"-rtsp_transport", "tcp",
 			"-re",
 			"-i", rtspURL,
 			"-analyzeduration", "1000000",
 			"-probesize", "1000000",
-			"-vf", "scale_cuda=format=yuv420p,hwdownload,format=yuv420p,select=not(mod(n\\,5))",
+			"-vf", backend.Filter(gpuDecimate),
 			"-pix_fmt", "rgb24",
 			"-fps_mode", "vfr",
 			"-c:v", "mjpeg",
 			"-q:v", "3", // JPEG quality (2-31, lower is better)
 			"-f", "image2pipe",
 			"-",
-		}
+		)
 	} else {
 		// CPU pipeline (optimized for 15+ cameras)
 		args = []string{
+			"-hide_banner",
 			"-rtsp_transport", "tcp",
+		}
+		args = append(args, inputArgs...)
+		args = append(args,
 			"-i", rtspURL,
-			"-analyzeduration", "500000",     // 降低分析时间
-			"-probesize", "500000",           // 降低探测大小
-			"-threads", "2",                  // 限制每路解码线程数
-			"-vf", `select=not(mod(n\,10))`, // 每10帧取1帧（降低50%负载）
+			"-analyzeduration", "500000", // 降低分析时间
+			"-probesize", "500000", // 降低探测大小
+			"-threads", "2", // 限制每路解码线程数
+			"-vf", backend.Filter(cpuDecimate), // 每10帧取1帧（降低50%负载）
 			"-fps_mode", "vfr",
 			"-c:v", "mjpeg",
 			"-q:v", "5", // JPEG质量稍低但编码更快
 			"-f", "image2pipe",
 			"-",
-		}
+		)
 	}
 
-	cmd := exec.Command("ffmpeg", args...)
+	// Killed as soon as a fatal error is printed, ffmpeg may otherwise keep retrying on its own
+	runCtx, kill := context.WithCancel(ctx)
+	defer kill()
+	cmd := exec.CommandContext(runCtx, "ffmpeg", args...)
 
-	stderrBuffer := &bytes.Buffer{}
-	cmd.Stderr = stderrBuffer
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		msgChannel <- FrameMsg{Error: err.Error()}
+		return
+	}
 
 	pipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -730,64 +1014,51 @@ func (sm *StreamManager) processRTSPFeed(rtspURL string, msgChannel chan<- Frame
 		return
 	}
 
-	frameData := bytes.NewBuffer(nil)
-	isFrameStarted := false
-	jpegSOI := []byte{0xFF, 0xD8}       // JPEG Start of Image marker
-	jpegEOI := []byte{0xFF, 0xD9}       // JPEG End of Image marker
-	maxFrameSize := 10 * 1024 * 1024    // 10MB limit for a single frame
+	// Read stderr line by line while ffmpeg runs
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		readFFmpegLog(stderr, backend, opts.logs, opts.metrics, func(class, line string) {
+			if isFatalLogClass(class) {
+				kill()
+			}
+			msgChannel <- FrameMsg{Error: line, Class: class}
+		})
+	}()
 
-	buffer := make([]byte, 65536) // 64KB buffer
-	for {
-		n, err := pipe.Read(buffer)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			msgChannel <- FrameMsg{Error: err.Error()}
+	// Frame boundaries come from the JPEG markers, not from where a read ends
+	splitter := frameSplitter.New(frameSplitter.JPEG, frameSplitter.DefaultMaxFrameSize)
+	err = splitter.Split(pipe, func(frame []byte) {
+		// Drop frames above the frame rate cap without decoding them
+		if !opts.allowFrame() {
 			return
 		}
 
-		// Check if we have a JPEG header in the current read
-		data := buffer[:n]
-		headerIdx := bytes.Index(data, jpegSOI)
-
-		if headerIdx >= 0 && isFrameStarted {
-			// Found a new frame header while processing a frame
-			// This means the previous frame is incomplete, discard it
-			frameData.Reset()
-			isFrameStarted = false
-		}
-
-		frameData.Write(data)
-
-		// Check for frame size limit
-		if frameData.Len() > maxFrameSize {
-			// Frame too large, likely corrupted, reset
-			frameData.Reset()
-			isFrameStarted = false
-			continue
-		}
-
-		if bytes.HasPrefix(frameData.Bytes(), jpegSOI) {
-			isFrameStarted = true
-		}
-
-		if isFrameStarted && bytes.HasSuffix(frameData.Bytes(), jpegEOI) {
-			// Attempt to decode the frame
-			img, err := jpeg.Decode(bytes.NewReader(frameData.Bytes()))
-			if err != nil {
-				// Silently skip corrupted frames instead of sending error
-				// This prevents one bad frame from disrupting the stream
-				log.Printf("Warning: Skipped corrupted JPEG frame: %v", err)
-			} else {
-				msgChannel <- FrameMsg{Frame: img}
-			}
-
-			frameData.Reset()
-			isFrameStarted = false
+		// Attempt to decode the frame
+		decodeStart := time.Now()
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			// Silently skip corrupted frames instead of sending error
+			// This prevents one bad frame from disrupting the stream
+			log.Printf("Warning: Skipped corrupted JPEG frame: %v", err)
+			opts.metrics.corrupted.Add(1)
+			return
 		}
+		msgChannel <- FrameMsg{Frame: img, DecodeTime: time.Since(decodeStart)}
+	})
+	if err != nil {
+		msgChannel <- FrameMsg{Error: err.Error()}
+		cmd.Process.Kill()
 	}
 
+	// Wait must not run before stderr is fully read
+	<-stderrDone
 	err = cmd.Wait()
+	if ctx.Err() != nil {
+		// Stopped on purpose, not an ffmpeg failure
+		return
+	}
+
 	exitCode := 0
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -795,11 +1066,9 @@ func (sm *StreamManager) processRTSPFeed(rtspURL string, msgChannel chan<- Frame
 				exitCode = status.ExitStatus()
 			}
 		}
-		msgChannel <- FrameMsg{Error: "FFmpeg exited with error: " + err.Error(), ExitCode: exitCode}
-	}
-
-	if stderrBuffer.Len() > 0 {
-		msgChannel <- FrameMsg{Error: "FFmpeg STDERR: " + stderrBuffer.String()}
+		message := "FFmpeg exited with error: " + err.Error()
+		opts.logs.add(LogExit, message)
+		msgChannel <- FrameMsg{Error: message, ExitCode: exitCode, Class: LogExit}
 	}
 }
 
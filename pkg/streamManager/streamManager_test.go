@@ -0,0 +1,103 @@
+package streamManager
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStreamKeepsCameraCopy(t *testing.T) {
+	sm := &StreamManager{
+		config: &Config{Cameras: []Camera{
+			{ID: "a", RtspUrl: "rtsp://a", Enabled: true},
+			{ID: "b", RtspUrl: "rtsp://b", Enabled: true},
+			{ID: "c", RtspUrl: "rtsp://c", Enabled: true},
+		}},
+		uptime: newMemoryUptimeLog(),
+		events: newEventBus(),
+	}
+	camera, err := sm.GetCamera("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &StreamInfo{camera: camera, decodeCheck: make(chan struct{}, 1)}
+	sm.streams.Store("b", info)
+
+	// Changing a returned camera must not touch the config
+	other, _ := sm.GetCamera("b")
+	other.RtspUrl = "rtsp://changed"
+	if got := sm.config.Cameras[1].RtspUrl; got != "rtsp://b" {
+		t.Errorf("GetCamera returned the config entry, RTSP URL is now %s", got)
+	}
+
+	// Deleting a camera shifts the config slice, the stream keeps its own camera
+	if err := sm.DeleteCamera("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := info.cameraConfig(); got.ID != "b" {
+		t.Errorf("stream for b now has the config of %s", got.ID)
+	}
+
+	// Updates replace the stream's copy instead of writing through it
+	before := info.cameraConfig()
+	if err := sm.UpdateCamera("b", Camera{RtspUrl: "rtsp://b2", Enabled: true, MaxFPS: 5}); err != nil {
+		t.Fatal(err)
+	}
+	after := info.cameraConfig()
+	if after.RtspUrl != "rtsp://b2" || after.MaxFPS != 5 {
+		t.Errorf("stream did not pick up the update: %+v", after)
+	}
+	if before.RtspUrl != "rtsp://b" || before.MaxFPS != 0 {
+		t.Errorf("update modified the copy held by the frame loop: %+v", before)
+	}
+	select {
+	case <-info.decodeCheck:
+	default:
+		t.Error("update did not ask the stream to re-check its decode mode")
+	}
+
+	if err := sm.UpdateCameraDrawElements("b", []DrawElement{{}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(info.cameraConfig().DrawElements); got != 1 {
+		t.Errorf("stream has %d draw elements, want 1", got)
+	}
+}
+
+func TestUpdateCameraFuncIsAtomic(t *testing.T) {
+	sm := &StreamManager{
+		config: &Config{Cameras: []Camera{{ID: "cam", RtspUrl: "rtsp://cam", Mode: ModeOnDemand}}},
+		uptime: newMemoryUptimeLog(),
+		events: newEventBus(),
+	}
+
+	// Every change sees the result of the previous one
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sm.UpdateCameraFunc("cam", func(c *Camera) { c.MaxFPS++ }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := sm.config.Cameras[0].MaxFPS; got != 50 {
+		t.Errorf("MaxFPS is %v after 50 increments", got)
+	}
+
+	// The change is validated and applied to a copy, an invalid result leaves the camera unchanged
+	err := sm.UpdateCameraFunc("cam", func(c *Camera) {
+		c.ID = "other"
+		c.Mode = "sometimes"
+	})
+	if err == nil {
+		t.Error("accepted an invalid mode")
+	}
+	if got := sm.config.Cameras[0]; got.ID != "cam" || got.Mode != ModeOnDemand {
+		t.Errorf("camera changed to %s, %s despite the error", got.ID, got.Mode)
+	}
+	if err := sm.UpdateCameraFunc("missing", func(c *Camera) {}); err == nil {
+		t.Error("updated a missing camera")
+	}
+}
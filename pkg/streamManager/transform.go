@@ -0,0 +1,326 @@
+package streamManager
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Transform represents one step of a camera's image transform pipeline
+type Transform struct {
+	Type       string       `json:"type"`                 // "rotate", "mirror", "crop", "adjust", "deinterlace", "dewarp"
+	Degrees    int          `json:"degrees,omitempty"`    // rotate: 90, 180 or 270 clockwise
+	Axis       string       `json:"axis,omitempty"`       // mirror: "horizontal" (default) or "vertical"
+	Region     *Rect        `json:"region,omitempty"`     // crop: region of the frame to keep
+	Brightness float64      `json:"brightness,omitempty"` // adjust: offset added to each channel, -255 to 255
+	Contrast   float64      `json:"contrast,omitempty"`   // adjust: contrast multiplier, 0 keeps the original contrast
+	Lens       *FisheyeLens `json:"lens,omitempty"`       // dewarp: fisheye lens parameters
+}
+
+// FisheyeLens describes the image circle of a fisheye lens for panorama dewarping
+type FisheyeLens struct {
+	CenterX     int     `json:"centerX,omitempty"`     // Lens center in source pixels, 0 uses the frame center
+	CenterY     int     `json:"centerY,omitempty"`     // Lens center in source pixels, 0 uses the frame center
+	Radius      int     `json:"radius,omitempty"`      // Radius of the image circle, 0 uses half the shorter side
+	InnerRadius int     `json:"innerRadius,omitempty"` // Radius around the center left out of the panorama
+	Angle       float64 `json:"angle,omitempty"`       // Panorama start angle in degrees
+	Width       int     `json:"width,omitempty"`       // Output width, 0 uses half the circumference
+	Height      int     `json:"height,omitempty"`      // Output height, 0 uses Radius - InnerRadius
+}
+
+// Limits on the panorama size so a bad lens config cannot exhaust memory
+const (
+	maxDewarpSide   = 8192
+	maxDewarpPixels = 4096 * 4096
+)
+
+// validateTransforms checks that every transform step is known and well formed
+func validateTransforms(transforms []Transform) error {
+	for i, t := range transforms {
+		switch t.Type {
+		case "rotate":
+			if t.Degrees != 90 && t.Degrees != 180 && t.Degrees != 270 {
+				return fmt.Errorf("transform %d: rotate degrees must be 90, 180 or 270", i)
+			}
+		case "mirror":
+			if t.Axis != "" && t.Axis != "horizontal" && t.Axis != "vertical" {
+				return fmt.Errorf("transform %d: mirror axis must be horizontal or vertical", i)
+			}
+		case "crop":
+			if t.Region == nil || t.Region.Width <= 0 || t.Region.Height <= 0 {
+				return fmt.Errorf("transform %d: crop requires a non-empty region", i)
+			}
+		case "adjust":
+			if t.Contrast < 0 {
+				return fmt.Errorf("transform %d: contrast must not be negative", i)
+			}
+		case "deinterlace":
+		case "dewarp":
+			if t.Lens == nil {
+				return fmt.Errorf("transform %d: dewarp requires lens parameters", i)
+			}
+			if t.Lens.Radius < 0 || t.Lens.InnerRadius < 0 || (t.Lens.Radius > 0 && t.Lens.InnerRadius >= t.Lens.Radius) {
+				return fmt.Errorf("transform %d: dewarp inner radius must be smaller than radius", i)
+			}
+			if t.Lens.Width < 0 || t.Lens.Height < 0 {
+				return fmt.Errorf("transform %d: dewarp width and height must not be negative", i)
+			}
+			if t.Lens.Radius > maxDewarpSide || t.Lens.Width > maxDewarpSide || t.Lens.Height > maxDewarpSide ||
+				t.Lens.Width*t.Lens.Height > maxDewarpPixels {
+				return fmt.Errorf("transform %d: dewarp output must be at most %d pixels per side and %d pixels in total", i, maxDewarpSide, maxDewarpPixels)
+			}
+		default:
+			return fmt.Errorf("transform %d: unknown type %q", i, t.Type)
+		}
+	}
+	return nil
+}
+
+// applyTransforms runs the camera's transform pipeline followed by its crop, rotation and scale.
+// The input frame is never modified; it is returned unchanged when nothing is configured.
+func applyTransforms(camera *Camera, img *image.RGBA) *image.RGBA {
+	for _, t := range camera.Transforms {
+		switch t.Type {
+		case "rotate":
+			img = rotateRGBA(img, t.Degrees)
+		case "mirror":
+			img = mirrorRGBA(img, t.Axis == "vertical")
+		case "crop":
+			if t.Region != nil {
+				img = cropRGBA(img, *t.Region)
+			}
+		case "adjust":
+			img = adjustRGBA(img, t.Brightness, t.Contrast)
+		case "deinterlace":
+			img = deinterlaceRGBA(img)
+		case "dewarp":
+			if t.Lens != nil {
+				img = dewarpRGBA(img, *t.Lens)
+			}
+		}
+	}
+
+	if camera.Crop != nil {
+		img = cropRGBA(img, *camera.Crop)
+	}
+
+	switch camera.Rotate {
+	case 90, 180, 270:
+		img = rotateRGBA(img, camera.Rotate)
+	}
+
+	if camera.Scale > 0 && camera.Scale != 1 {
+		img = scaleRGBA(img, camera.Scale)
+	}
+
+	return img
+}
+
+// cloneRGBA returns a copy of an image with its origin at (0, 0)
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	xdraw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, xdraw.Src)
+	return dst
+}
+
+// cropRGBA copies a region of an image, clamped to the image bounds
+func cropRGBA(src *image.RGBA, r Rect) *image.RGBA {
+	region := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Add(src.Bounds().Min).Intersect(src.Bounds())
+	if region.Empty() {
+		return src
+	}
+	return cloneRGBA(src.SubImage(region).(*image.RGBA))
+}
+
+// rotateRGBA rotates an image clockwise by 90, 180 or 270 degrees
+func rotateRGBA(src *image.RGBA, degrees int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.RGBA
+	switch degrees {
+	case 180:
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	case 90, 270:
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	default:
+		return src
+	}
+
+	for y := 0; y < h; y++ {
+		srcRow := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			so := x * 4
+			do := dy*dst.Stride + dx*4
+			copy(dst.Pix[do:do+4], srcRow[so:so+4])
+		}
+	}
+	return dst
+}
+
+// mirrorRGBA flips an image horizontally, or vertically if vertical is set
+func mirrorRGBA(src *image.RGBA, vertical bool) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		srcRow := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		if vertical {
+			copy(dst.Pix[(h-1-y)*dst.Stride:(h-y)*dst.Stride], srcRow[:w*4])
+			continue
+		}
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < w; x++ {
+			copy(dstRow[(w-1-x)*4:(w-x)*4], srcRow[x*4:x*4+4])
+		}
+	}
+	return dst
+}
+
+// adjustRGBA applies brightness and contrast to the color channels of an image
+func adjustRGBA(src *image.RGBA, brightness, contrast float64) *image.RGBA {
+	if contrast == 0 {
+		contrast = 1
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		v := (float64(i)-128)*contrast + 128 + brightness
+		lut[i] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+
+	dst := cloneRGBA(src)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = lut[dst.Pix[i]]
+		dst.Pix[i+1] = lut[dst.Pix[i+1]]
+		dst.Pix[i+2] = lut[dst.Pix[i+2]]
+	}
+	return dst
+}
+
+// deinterlaceRGBA removes combing by replacing each odd line with the average of its neighbours
+func deinterlaceRGBA(src *image.RGBA) *image.RGBA {
+	dst := cloneRGBA(src)
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+
+	for y := 1; y < h-1; y += 2 {
+		above := dst.Pix[(y-1)*dst.Stride:]
+		below := dst.Pix[(y+1)*dst.Stride:]
+		row := dst.Pix[y*dst.Stride:]
+		for i := 0; i < w*4; i++ {
+			row[i] = uint8((uint16(above[i]) + uint16(below[i]) + 1) / 2)
+		}
+	}
+	return dst
+}
+
+// dewarpKey identifies a cached fisheye lookup table
+type dewarpKey struct {
+	width, height, stride int
+	lens                  FisheyeLens
+}
+
+var (
+	dewarpMaps   = make(map[dewarpKey][]int32)
+	dewarpMapsMu sync.Mutex
+)
+
+// dewarpRGBA unwraps a fisheye image circle into a panorama
+func dewarpRGBA(src *image.RGBA, lens FisheyeLens) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if lens.CenterX == 0 && lens.CenterY == 0 {
+		lens.CenterX, lens.CenterY = w/2, h/2
+	}
+	if lens.Radius == 0 {
+		lens.Radius = min(w, h) / 2
+	}
+	if lens.InnerRadius >= lens.Radius {
+		return src
+	}
+	if lens.Width == 0 {
+		lens.Width = int(math.Pi * float64(lens.Radius))
+	}
+	if lens.Height == 0 {
+		lens.Height = lens.Radius - lens.InnerRadius
+	}
+	// Defaults follow the frame size, so check the result as well as the config
+	if lens.Width <= 0 || lens.Height <= 0 || lens.Width > maxDewarpSide || lens.Height > maxDewarpSide ||
+		lens.Width*lens.Height > maxDewarpPixels {
+		return src
+	}
+
+	table := dewarpTable(w, h, src.Stride, lens)
+	dst := image.NewRGBA(image.Rect(0, 0, lens.Width, lens.Height))
+	for i, offset := range table {
+		if offset < 0 {
+			continue
+		}
+		so := src.PixOffset(b.Min.X, b.Min.Y) + int(offset)
+		copy(dst.Pix[i*4:i*4+4], src.Pix[so:so+4])
+	}
+	return dst
+}
+
+// dewarpTable returns the source pixel offset for each panorama pixel, -1 for pixels
+// outside the frame. Tables are cached per frame size and lens.
+func dewarpTable(w, h, stride int, lens FisheyeLens) []int32 {
+	key := dewarpKey{width: w, height: h, stride: stride, lens: lens}
+
+	dewarpMapsMu.Lock()
+	defer dewarpMapsMu.Unlock()
+	if table, ok := dewarpMaps[key]; ok {
+		return table
+	}
+
+	table := make([]int32, lens.Width*lens.Height)
+	start := lens.Angle * math.Pi / 180
+	span := float64(lens.Radius - lens.InnerRadius)
+	for y := 0; y < lens.Height; y++ {
+		// Top of the panorama is the outer edge of the image circle
+		r := float64(lens.Radius) - span*float64(y)/float64(lens.Height)
+		for x := 0; x < lens.Width; x++ {
+			theta := start + 2*math.Pi*float64(x)/float64(lens.Width)
+			sx := int(math.Round(float64(lens.CenterX) + r*math.Cos(theta)))
+			sy := int(math.Round(float64(lens.CenterY) + r*math.Sin(theta)))
+			if sx < 0 || sx >= w || sy < 0 || sy >= h {
+				table[y*lens.Width+x] = -1
+				continue
+			}
+			table[y*lens.Width+x] = int32(sy*stride + sx*4)
+		}
+	}
+
+	// Lens settings rarely change, drop everything if they keep changing
+	if len(dewarpMaps) >= 16 {
+		dewarpMaps = make(map[dewarpKey][]int32)
+	}
+	dewarpMaps[key] = table
+	return table
+}
+
+// scaleRGBA resizes an image by a scale factor using bilinear interpolation
+func scaleRGBA(src *image.RGBA, factor float64) *image.RGBA {
+	w := int(float64(src.Bounds().Dx()) * factor)
+	h := int(float64(src.Bounds().Dy()) * factor)
+	if w <= 0 || h <= 0 {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+	return dst
+}
@@ -0,0 +1,285 @@
+package streamManager
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// gridRGBA returns a w x h image whose pixel (x, y) has red x and green y
+func gridRGBA(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+// sourceOf returns the source coordinates encoded in a gridRGBA pixel
+func sourceOf(img *image.RGBA, x, y int) image.Point {
+	c := img.RGBAAt(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)
+	return image.Pt(int(c.R), int(c.G))
+}
+
+func TestGeometricTransforms(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   image.Point
+		apply func(*image.RGBA) *image.RGBA
+		size  image.Point
+		// Expected source pixel for a few output pixels
+		pixels map[image.Point]image.Point
+	}{
+		{
+			name:  "rotate 90",
+			src:   image.Pt(4, 3),
+			apply: func(img *image.RGBA) *image.RGBA { return rotateRGBA(img, 90) },
+			size:  image.Pt(3, 4),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {0, 2}, {2, 0}: {0, 0}, {0, 3}: {3, 2}, {2, 3}: {3, 0},
+			},
+		},
+		{
+			name:  "rotate 180",
+			src:   image.Pt(4, 3),
+			apply: func(img *image.RGBA) *image.RGBA { return rotateRGBA(img, 180) },
+			size:  image.Pt(4, 3),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {3, 2}, {3, 2}: {0, 0}, {1, 0}: {2, 2},
+			},
+		},
+		{
+			name:  "rotate 270",
+			src:   image.Pt(4, 3),
+			apply: func(img *image.RGBA) *image.RGBA { return rotateRGBA(img, 270) },
+			size:  image.Pt(3, 4),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {3, 0}, {2, 0}: {3, 2}, {0, 3}: {0, 0},
+			},
+		},
+		{
+			name:  "mirror horizontal",
+			src:   image.Pt(4, 3),
+			apply: func(img *image.RGBA) *image.RGBA { return mirrorRGBA(img, false) },
+			size:  image.Pt(4, 3),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {3, 0}, {3, 2}: {0, 2}, {1, 1}: {2, 1},
+			},
+		},
+		{
+			name:  "mirror vertical",
+			src:   image.Pt(4, 3),
+			apply: func(img *image.RGBA) *image.RGBA { return mirrorRGBA(img, true) },
+			size:  image.Pt(4, 3),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {0, 2}, {3, 2}: {3, 0}, {1, 1}: {1, 1},
+			},
+		},
+		{
+			name:  "crop",
+			src:   image.Pt(8, 6),
+			apply: func(img *image.RGBA) *image.RGBA { return cropRGBA(img, Rect{X: 2, Y: 1, Width: 3, Height: 2}) },
+			size:  image.Pt(3, 2),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {2, 1}, {2, 1}: {4, 2},
+			},
+		},
+		{
+			name:  "crop clamped to the frame",
+			src:   image.Pt(8, 6),
+			apply: func(img *image.RGBA) *image.RGBA { return cropRGBA(img, Rect{X: 6, Y: 4, Width: 10, Height: 10}) },
+			size:  image.Pt(2, 2),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {6, 4}, {1, 1}: {7, 5},
+			},
+		},
+		{
+			name: "crop of a sub image",
+			src:  image.Pt(8, 6),
+			apply: func(img *image.RGBA) *image.RGBA {
+				return cropRGBA(img.SubImage(image.Rect(2, 2, 8, 6)).(*image.RGBA), Rect{X: 1, Y: 1, Width: 2, Height: 2})
+			},
+			size: image.Pt(2, 2),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {3, 3}, {1, 1}: {4, 4},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		src := gridRGBA(test.src.X, test.src.Y)
+		before := append([]uint8(nil), src.Pix...)
+
+		dst := test.apply(src)
+		if got := dst.Bounds().Size(); got != test.size {
+			t.Errorf("%s: size %v, want %v", test.name, got, test.size)
+			continue
+		}
+		for at, want := range test.pixels {
+			if got := sourceOf(dst, at.X, at.Y); got != want {
+				t.Errorf("%s: pixel %v came from %v, want %v", test.name, at, got, want)
+			}
+		}
+		if string(before) != string(src.Pix) {
+			t.Errorf("%s: source frame was modified", test.name)
+		}
+	}
+}
+
+func TestAdjustRGBA(t *testing.T) {
+	tests := []struct {
+		name                 string
+		brightness, contrast float64
+		in, want             uint8
+	}{
+		{name: "unchanged", in: 77, want: 77},
+		{name: "brighter", brightness: 20, in: 100, want: 120},
+		{name: "darker clamps at 0", brightness: -50, in: 30, want: 0},
+		{name: "brighter clamps at 255", brightness: 50, in: 230, want: 255},
+		{name: "double contrast", contrast: 2, in: 100, want: 72},
+		{name: "double contrast above middle", contrast: 2, in: 150, want: 172},
+		{name: "no contrast", contrast: 0.0001, in: 10, want: 128},
+	}
+
+	for _, test := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		src.SetRGBA(0, 0, color.RGBA{R: test.in, G: test.in, B: test.in, A: 200})
+		got := adjustRGBA(src, test.brightness, test.contrast).RGBAAt(0, 0)
+		if got.R != test.want || got.G != test.want || got.B != test.want {
+			t.Errorf("%s: got %v, want %d", test.name, got, test.want)
+		}
+		if got.A != 200 {
+			t.Errorf("%s: alpha changed to %d", test.name, got.A)
+		}
+	}
+}
+
+func TestDeinterlaceRGBA(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1, 4))
+	for y, v := range []uint8{10, 200, 30, 250} {
+		src.SetRGBA(0, y, color.RGBA{R: v, A: 255})
+	}
+
+	dst := deinterlaceRGBA(src)
+	// Odd lines between two even lines are averaged, the last line has nothing below it
+	for y, want := range []uint8{10, 20, 30, 250} {
+		if got := dst.RGBAAt(0, y).R; got != want {
+			t.Errorf("line %d: got %d, want %d", y, got, want)
+		}
+	}
+}
+
+func TestDewarpRGBA(t *testing.T) {
+	src := gridRGBA(100, 100)
+
+	tests := []struct {
+		name   string
+		lens   FisheyeLens
+		size   image.Point
+		pixels map[image.Point]image.Point
+	}{
+		{
+			name: "defaults",
+			lens: FisheyeLens{},
+			size: image.Pt(157, 50),
+			// Top row is the outer edge of the circle starting at angle 0, bottom row is near the center
+			pixels: map[image.Point]image.Point{{0, 1}: {99, 50}, {0, 49}: {51, 50}},
+		},
+		{
+			name: "quarter turn",
+			lens: FisheyeLens{Radius: 40, Width: 4, Height: 2},
+			size: image.Pt(4, 2),
+			pixels: map[image.Point]image.Point{
+				{0, 0}: {90, 50}, {1, 0}: {50, 90}, {2, 0}: {10, 50}, {3, 0}: {50, 10}, {0, 1}: {70, 50},
+			},
+		},
+		{
+			name:   "start angle",
+			lens:   FisheyeLens{Radius: 40, Width: 4, Height: 1, Angle: 90},
+			size:   image.Pt(4, 1),
+			pixels: map[image.Point]image.Point{{0, 0}: {50, 90}},
+		},
+		{
+			name:   "inner radius",
+			lens:   FisheyeLens{Radius: 40, InnerRadius: 20, Width: 4, Height: 2},
+			size:   image.Pt(4, 2),
+			pixels: map[image.Point]image.Point{{0, 1}: {80, 50}},
+		},
+		{
+			name:   "inner radius covering the circle",
+			lens:   FisheyeLens{InnerRadius: 60},
+			size:   image.Pt(100, 100),
+			pixels: map[image.Point]image.Point{{3, 4}: {3, 4}},
+		},
+		{
+			name:   "output too large",
+			lens:   FisheyeLens{Width: maxDewarpSide, Height: maxDewarpSide},
+			size:   image.Pt(100, 100),
+			pixels: map[image.Point]image.Point{{3, 4}: {3, 4}},
+		},
+	}
+
+	for _, test := range tests {
+		dst := dewarpRGBA(src, test.lens)
+		if got := dst.Bounds().Size(); got != test.size {
+			t.Errorf("%s: size %v, want %v", test.name, got, test.size)
+			continue
+		}
+		for at, want := range test.pixels {
+			if got := sourceOf(dst, at.X, at.Y); got != want {
+				t.Errorf("%s: pixel %v came from %v, want %v", test.name, at, got, want)
+			}
+		}
+	}
+
+	// Pixels that map outside the frame stay transparent
+	dst := dewarpRGBA(src, FisheyeLens{CenterX: 5, CenterY: 50, Radius: 40, Width: 4, Height: 1})
+	if a := dst.RGBAAt(2, 0).A; a != 0 {
+		t.Errorf("pixel outside the frame has alpha %d, want 0", a)
+	}
+}
+
+func TestValidateTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		valid     bool
+	}{
+		{name: "rotate", transform: Transform{Type: "rotate", Degrees: 90}, valid: true},
+		{name: "rotate by 45", transform: Transform{Type: "rotate", Degrees: 45}},
+		{name: "mirror", transform: Transform{Type: "mirror", Axis: "vertical"}, valid: true},
+		{name: "mirror diagonal", transform: Transform{Type: "mirror", Axis: "diagonal"}},
+		{name: "crop", transform: Transform{Type: "crop", Region: &Rect{Width: 1, Height: 1}}, valid: true},
+		{name: "empty crop", transform: Transform{Type: "crop", Region: &Rect{Width: 0, Height: 1}}},
+		{name: "negative contrast", transform: Transform{Type: "adjust", Contrast: -1}},
+		{name: "dewarp defaults", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{}}, valid: true},
+		{name: "dewarp without lens", transform: Transform{Type: "dewarp"}},
+		{name: "dewarp inner radius", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Radius: 10, InnerRadius: 10}}},
+		{name: "dewarp negative width", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Width: -1}}},
+		{name: "dewarp negative height", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Height: -5}}},
+		{name: "dewarp too wide", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Width: maxDewarpSide + 1, Height: 1}}},
+		{name: "dewarp too many pixels", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Width: maxDewarpSide, Height: maxDewarpSide}}},
+		{name: "dewarp radius too large", transform: Transform{Type: "dewarp", Lens: &FisheyeLens{Radius: maxDewarpSide + 1}}},
+		{name: "unknown", transform: Transform{Type: "sharpen"}},
+	}
+
+	for _, test := range tests {
+		err := validateTransforms([]Transform{test.transform})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestAddCameraRejectsBadTransforms(t *testing.T) {
+	sm := &StreamManager{config: &Config{}}
+	camera := Camera{ID: "cam", Transforms: []Transform{{Type: "dewarp", Lens: &FisheyeLens{Width: -640}}}}
+	if err := sm.AddCamera(camera); err == nil {
+		t.Fatal("AddCamera accepted a negative dewarp width")
+	}
+	if len(sm.config.Cameras) != 0 {
+		t.Errorf("camera was added despite the error")
+	}
+}
@@ -0,0 +1,473 @@
+package streamManager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultUptimeLog is the file name of the uptime log, next to the config file
+const defaultUptimeLog = "uptime.jsonl"
+
+const (
+	defaultUptimeRetention = 90 * 24 * time.Hour // History kept when uptimeRetention is not set
+	uptimeHeartbeat        = time.Minute         // How often the log notes that the server is still running
+	uptimeCompactInterval  = 24 * time.Hour      // How often history older than the retention is dropped
+	stateHeartbeat         = "heartbeat"         // State of heartbeat lines, which have no camera
+)
+
+// Stream states recorded in the uptime log
+const (
+	StateStarting  = "starting"  // Stream started, waiting for the first frame
+	StateStreaming = "streaming" // Frames are arriving
+	StateBackoff   = "backoff"   // The source failed, waiting to retry
+	StateOffline   = "offline"   // Retrying gave up until the next start
+	StateStopped   = "stopped"   // Stopped on purpose, not counted towards availability
+)
+
+// stateDown reports whether a state counts as an outage
+func stateDown(state string) bool {
+	return state == StateBackoff || state == StateOffline
+}
+
+// uptimeRecord is one line of the uptime log
+type uptimeRecord struct {
+	Time   time.Time `json:"time"`
+	Camera string    `json:"camera,omitempty"`
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// uptimeLog appends camera state transitions to a JSON lines file.
+// The transitions within the retention are also kept in memory to answer uptime requests.
+type uptimeLog struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File          // nil if the log could not be opened, states are then only tracked in memory
+	state     map[string]string // Latest state per camera
+	history   []uptimeRecord    // Transitions in time order, empty without a file
+	retention time.Duration
+	compacted time.Time
+	stop      chan struct{} // Closed by close to end the heartbeat
+}
+
+// newMemoryUptimeLog tracks states without writing them
+func newMemoryUptimeLog() *uptimeLog {
+	return &uptimeLog{state: make(map[string]string)}
+}
+
+// openUptimeLog opens the log for appending and drops history older than retention, 0 keeps the default.
+// Cameras the previous run left in any state other than stopped are marked stopped as of the last
+// line it wrote, since nothing was monitored while the server was down.
+func openUptimeLog(path string, retention time.Duration) (*uptimeLog, error) {
+	records, lastSeen, err := readUptimeLog(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if retention <= 0 {
+		retention = defaultUptimeRetention
+	}
+
+	l := &uptimeLog{path: path, state: make(map[string]string), history: records, retention: retention, stop: make(chan struct{})}
+	for _, r := range records {
+		l.state[r.Camera] = r.State
+	}
+	for id, state := range l.state {
+		if state != StateStopped {
+			l.state[id] = StateStopped
+			l.history = append(l.history, uptimeRecord{Time: lastSeen, Camera: id, State: StateStopped, Reason: "server restart"})
+		}
+	}
+
+	// Compacting rewrites the file, including the records added above
+	if err := l.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	go l.heartbeat(l.stop)
+	return l, nil
+}
+
+// close stops the heartbeat and closes the file
+func (l *uptimeLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+}
+
+// record appends a transition. Returns the previous state and false if the camera was already in the state.
+func (l *uptimeLog) record(cameraID, state, reason string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := l.state[cameraID]
+	if previous == state {
+		return previous, false
+	}
+	l.state[cameraID] = state
+	if l.file == nil {
+		return previous, true
+	}
+
+	r := uptimeRecord{Time: time.Now().UTC(), Camera: cameraID, State: state, Reason: reason}
+	l.history = append(l.history, r)
+	l.write(r)
+	return previous, true
+}
+
+// write appends a line to the file. The caller must hold l.mu.
+func (l *uptimeLog) write(r uptimeRecord) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	// One write per line so a crash leaves at most one truncated line
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write uptime log: %v", err)
+	}
+}
+
+// heartbeat notes that the server is running while any camera is monitored, so the downtime
+// after a crash is not credited to the state the cameras were in. It also compacts the log once a day.
+func (l *uptimeLog) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(uptimeHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			if l.stop == nil {
+				// Closed while waiting for the lock
+				l.mu.Unlock()
+				return
+			}
+			if l.monitoring() {
+				l.write(uptimeRecord{Time: now.UTC(), State: stateHeartbeat})
+			}
+			if now.Sub(l.compacted) >= uptimeCompactInterval {
+				if err := l.compact(now); err != nil {
+					log.Printf("Failed to compact uptime log: %v", err)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// monitoring reports whether any camera is in a state other than stopped. The caller must hold l.mu.
+func (l *uptimeLog) monitoring() bool {
+	for _, state := range l.state {
+		if state != StateStopped {
+			return true
+		}
+	}
+	return false
+}
+
+// compact drops transitions older than the retention, keeping the last one of each camera
+// that was still monitored at the cutoff, and rewrites the file.
+// The caller must hold l.mu, or be the only user of the log.
+func (l *uptimeLog) compact(now time.Time) error {
+	cutoff := now.Add(-l.retention)
+	latest := make(map[string]int) // Index of each camera's last record before the cutoff
+	for i, r := range l.history {
+		if r.Time.Before(cutoff) {
+			latest[r.Camera] = i
+		}
+	}
+
+	var kept []uptimeRecord
+	for i, r := range l.history {
+		if !r.Time.Before(cutoff) || (latest[r.Camera] == i && r.State != StateStopped) {
+			kept = append(kept, r)
+		}
+	}
+
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open uptime log: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, r := range kept {
+		enc.Encode(r)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write uptime log: %w", err)
+	}
+	file.Close()
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace uptime log: %w", err)
+	}
+
+	file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open uptime log: %w", err)
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.history = kept
+	l.compacted = now
+	return nil
+}
+
+// current returns the latest state of a camera
+func (l *uptimeLog) current(cameraID string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state[cameraID]
+}
+
+// records returns the transitions within the retention in time order
+func (l *uptimeLog) records() ([]uptimeRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil, errors.New("uptime log is not available")
+	}
+	return append([]uptimeRecord(nil), l.history...), nil
+}
+
+// readUptimeLog reads a log file in time order, skipping lines that do not parse.
+// Also returns the time of the last line, heartbeats included.
+func readUptimeLog(path string) ([]uptimeRecord, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	var records []uptimeRecord
+	var lastSeen time.Time
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r uptimeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Time.After(lastSeen) {
+			lastSeen = r.Time
+		}
+		if r.Camera == "" {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read uptime log: %w", err)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, lastSeen, nil
+}
+
+// Outage is a period during which a camera was in the backoff or offline state
+type Outage struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Open            bool      `json:"open,omitempty"` // Not recovered by the end of the range
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// UptimeReport is the availability of a camera over a time range
+type UptimeReport struct {
+	CameraID         string    `json:"cameraId"`
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	State            string    `json:"state,omitempty"`  // Latest state
+	Availability     *float64  `json:"availability"`     // Percent of monitored time without an outage, null if never monitored
+	MonitoredSeconds float64   `json:"monitoredSeconds"` // Time not in the stopped state
+	DowntimeSeconds  float64   `json:"downtimeSeconds"`  // Time in outages
+	MTTRSeconds      float64   `json:"mttrSeconds"`      // Mean duration of the outages that recovered
+	OutageCount      int       `json:"outageCount"`      // Outages overlapping the range
+	Outages          []Outage  `json:"outages"`          // Outages overlapping the range, clipped to it
+}
+
+// FleetUptime summarises the availability of every camera
+type FleetUptime struct {
+	From             time.Time      `json:"from"`
+	To               time.Time      `json:"to"`
+	Availability     *float64       `json:"availability"` // Over the monitored time of all cameras
+	MonitoredSeconds float64        `json:"monitoredSeconds"`
+	DowntimeSeconds  float64        `json:"downtimeSeconds"`
+	OutageCount      int            `json:"outageCount"`
+	Cameras          []UptimeReport `json:"cameras"`
+}
+
+// computeUptime builds a camera's report from its records in time order.
+// Time after now is not counted.
+func computeUptime(cameraID string, records []uptimeRecord, from, to, now time.Time) UptimeReport {
+	report := UptimeReport{CameraID: cameraID, From: from, To: to, Outages: []Outage{}}
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	state := StateStopped
+	var outage *Outage
+	var recovered []float64
+
+	// advance accounts the current state from start until t
+	advance := func(start, t time.Time) {
+		if start.Before(from) {
+			start = from
+		}
+		if t.After(end) {
+			t = end
+		}
+		if !t.After(start) {
+			return
+		}
+		d := t.Sub(start).Seconds()
+		if state != StateStopped {
+			report.MonitoredSeconds += d
+		}
+		if stateDown(state) {
+			report.DowntimeSeconds += d
+		}
+	}
+	// transition moves to a new state at t, opening or closing outages
+	transition := func(t time.Time, next, nextReason string) {
+		switch {
+		case stateDown(next) && outage == nil:
+			outage = &Outage{Start: t, Reason: nextReason}
+		case !stateDown(next) && outage != nil:
+			outage.End = t
+			report.addOutage(*outage, from, end, &recovered)
+			outage = nil
+		}
+		state = next
+	}
+
+	last := time.Time{}
+	for _, r := range records {
+		if r.Time.After(end) {
+			break
+		}
+		if !last.IsZero() {
+			advance(last, r.Time)
+		}
+		transition(r.Time, r.State, r.Reason)
+		last = r.Time
+	}
+	if !last.IsZero() {
+		advance(last, end)
+	}
+	if outage != nil {
+		outage.End = end
+		outage.Open = true
+		report.addOutage(*outage, from, end, &recovered)
+	}
+
+	report.OutageCount = len(report.Outages)
+	if len(recovered) > 0 {
+		total := 0.0
+		for _, d := range recovered {
+			total += d
+		}
+		report.MTTRSeconds = total / float64(len(recovered))
+	}
+	if report.MonitoredSeconds > 0 {
+		availability := 100 * (1 - report.DowntimeSeconds/report.MonitoredSeconds)
+		report.Availability = &availability
+	}
+	return report
+}
+
+// addOutage adds an outage clipped to the range if it overlaps it. Outages that recovered
+// within the range count towards the mean time to recovery with their full duration.
+func (report *UptimeReport) addOutage(o Outage, from, end time.Time, recovered *[]float64) {
+	if !o.End.After(from) || !o.Start.Before(end) {
+		return
+	}
+	if !o.Open {
+		*recovered = append(*recovered, o.End.Sub(o.Start).Seconds())
+	}
+	if o.Start.Before(from) {
+		o.Start = from
+	}
+	o.DurationSeconds = o.End.Sub(o.Start).Seconds()
+	report.Outages = append(report.Outages, o)
+}
+
+// GetCameraUptime returns the availability of a camera between from and to
+func (sm *StreamManager) GetCameraUptime(cameraID string, from, to time.Time) (UptimeReport, error) {
+	if _, err := sm.GetCamera(cameraID); err != nil {
+		return UptimeReport{}, err
+	}
+	records, err := sm.uptime.records()
+	if err != nil {
+		return UptimeReport{}, err
+	}
+
+	report := computeUptime(cameraID, cameraRecords(records, cameraID), from, to, time.Now())
+	report.State = sm.uptime.current(cameraID)
+	return report, nil
+}
+
+// GetFleetUptime returns the availability of every camera between from and to
+func (sm *StreamManager) GetFleetUptime(from, to time.Time) (FleetUptime, error) {
+	records, err := sm.uptime.records()
+	if err != nil {
+		return FleetUptime{}, err
+	}
+
+	now := time.Now()
+	fleet := FleetUptime{From: from, To: to, Cameras: []UptimeReport{}}
+	for _, camera := range sm.GetAllCameras() {
+		report := computeUptime(camera.ID, cameraRecords(records, camera.ID), from, to, now)
+		report.State = sm.uptime.current(camera.ID)
+		fleet.MonitoredSeconds += report.MonitoredSeconds
+		fleet.DowntimeSeconds += report.DowntimeSeconds
+		fleet.OutageCount += report.OutageCount
+		fleet.Cameras = append(fleet.Cameras, report)
+	}
+	if fleet.MonitoredSeconds > 0 {
+		availability := 100 * (1 - fleet.DowntimeSeconds/fleet.MonitoredSeconds)
+		fleet.Availability = &availability
+	}
+	return fleet, nil
+}
+
+// cameraRecords returns the records of one camera
+func cameraRecords(records []uptimeRecord, cameraID string) []uptimeRecord {
+	var out []uptimeRecord
+	for _, r := range records {
+		if r.Camera == cameraID {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// uptimeLogPath returns the configured uptime log path, relative paths resolve next to the config file
+func uptimeLogPath(configPath, configured string) string {
+	if configured == "" {
+		configured = defaultUptimeLog
+	}
+	if filepath.IsAbs(configured) {
+		return configured
+	}
+	return filepath.Join(filepath.Dir(configPath), configured)
+}
@@ -0,0 +1,231 @@
+package streamManager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeUptime(t *testing.T) {
+	base := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	rec := func(minutes int, state string) uptimeRecord {
+		return uptimeRecord{Time: at(minutes), Camera: "cam", State: state, Reason: "r" + state}
+	}
+
+	tests := []struct {
+		name         string
+		records      []uptimeRecord
+		from, to     int
+		now          int
+		availability float64 // -1 for never monitored
+		outages      int
+		mttr         float64
+		open         bool // Last outage still open
+	}{
+		{
+			name:    "always streaming",
+			records: []uptimeRecord{rec(0, StateStarting), rec(1, StateStreaming)},
+			from:    0, to: 100, now: 1000,
+			availability: 100,
+		},
+		{
+			name: "one outage",
+			records: []uptimeRecord{
+				rec(0, StateStreaming), rec(10, StateBackoff), rec(15, StateOffline), rec(20, StateStarting), rec(21, StateStreaming),
+			},
+			from: 0, to: 100, now: 1000,
+			availability: 90, outages: 1, mttr: 600,
+		},
+		{
+			name:    "stopped time is not monitored",
+			records: []uptimeRecord{rec(0, StateStreaming), rec(50, StateStopped), rec(90, StateStreaming), rec(94, StateBackoff)},
+			from:    0, to: 100, now: 1000,
+			availability: 90, outages: 1, open: true,
+		},
+		{
+			name:    "outage clipped to the range",
+			records: []uptimeRecord{rec(0, StateBackoff), rec(30, StateStreaming)},
+			from:    20, to: 40, now: 1000,
+			availability: 50, outages: 1, mttr: 1800,
+		},
+		{
+			name:    "future time is not counted",
+			records: []uptimeRecord{rec(0, StateStreaming), rec(40, StateBackoff)},
+			from:    0, to: 100, now: 50,
+			availability: 80, outages: 1, open: true,
+		},
+		{
+			name:    "never monitored",
+			records: []uptimeRecord{rec(0, StateStopped)},
+			from:    0, to: 100, now: 1000,
+			availability: -1,
+		},
+	}
+
+	for _, test := range tests {
+		report := computeUptime("cam", test.records, at(test.from), at(test.to), at(test.now))
+		switch {
+		case test.availability < 0 && report.Availability != nil:
+			t.Errorf("%s: availability = %v, want null", test.name, *report.Availability)
+		case test.availability >= 0 && (report.Availability == nil || *report.Availability != test.availability):
+			t.Errorf("%s: availability = %v, want %v", test.name, report.Availability, test.availability)
+		}
+		if report.OutageCount != test.outages {
+			t.Errorf("%s: %d outages, want %d", test.name, report.OutageCount, test.outages)
+			continue
+		}
+		if report.MTTRSeconds != test.mttr {
+			t.Errorf("%s: MTTR = %v, want %v", test.name, report.MTTRSeconds, test.mttr)
+		}
+		if n := len(report.Outages); n > 0 && report.Outages[n-1].Open != test.open {
+			t.Errorf("%s: last outage open = %v, want %v", test.name, report.Outages[n-1].Open, test.open)
+		}
+	}
+}
+
+func TestUptimeLogRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uptime.jsonl")
+	l, err := openUptimeLog(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.record("cam", StateStreaming, "")
+	l.record("cam", StateStreaming, "") // Unchanged states are not written again
+	l.close()
+
+	// A new run marks cameras that were left running as stopped
+	l, err = openUptimeLog(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+	records, err := l.records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].State != StateStopped {
+		t.Errorf("got records %+v, want streaming then stopped", records)
+	}
+
+	// The file holds the same records as memory
+	written, _, err := readUptimeLog(path)
+	if err != nil || len(written) != 2 {
+		t.Errorf("file has records %+v, %v, want 2", written, err)
+	}
+}
+
+func TestUptimeLogDowntime(t *testing.T) {
+	base := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Second)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name    string
+		lines   []uptimeRecord
+		stopped time.Time // Time of the synthetic stopped record
+	}{
+		{
+			name:    "stamped with the last heartbeat",
+			lines:   []uptimeRecord{{Time: at(0), Camera: "cam", State: StateStreaming}, {Time: at(9), State: stateHeartbeat}, {Time: at(10), State: stateHeartbeat}},
+			stopped: at(10),
+		},
+		{
+			name:    "stamped with the last record without heartbeats",
+			lines:   []uptimeRecord{{Time: at(0), Camera: "cam", State: StateStarting}, {Time: at(1), Camera: "cam", State: StateStreaming}},
+			stopped: at(1),
+		},
+		{
+			name:    "truncated last line is ignored",
+			lines:   []uptimeRecord{{Time: at(0), Camera: "cam", State: StateStreaming}, {Time: at(5), State: stateHeartbeat}, {}},
+			stopped: at(5),
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "uptime.jsonl")
+		var data []byte
+		for _, line := range test.lines {
+			if line.Time.IsZero() {
+				data = append(data, `{"time":"20`...)
+				continue
+			}
+			b, _ := json.Marshal(line)
+			data = append(append(data, b...), '\n')
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := openUptimeLog(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, _ := l.records()
+		l.close()
+
+		last := records[len(records)-1]
+		if last.State != StateStopped || !last.Time.Equal(test.stopped) {
+			t.Errorf("%s: last record %+v, want stopped at %v", test.name, last, test.stopped)
+			continue
+		}
+
+		// The server was down from the stop until now, which is neither uptime nor an outage
+		report := computeUptime("cam", records, at(0), at(120), at(120))
+		if report.Availability == nil || *report.Availability != 100 || report.MonitoredSeconds != test.stopped.Sub(at(0)).Seconds() {
+			t.Errorf("%s: availability %v over %vs, want 100 over %vs", test.name, report.Availability, report.MonitoredSeconds, test.stopped.Sub(at(0)).Seconds())
+		}
+	}
+}
+
+func TestUptimeLogCompaction(t *testing.T) {
+	now := time.Now().UTC()
+	day := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+	lines := []uptimeRecord{
+		{Time: day(200), Camera: "old", State: StateStreaming},
+		{Time: day(190), Camera: "old", State: StateStopped},
+		{Time: day(150), Camera: "cam", State: StateStarting},
+		{Time: day(150), Camera: "cam", State: StateStreaming},
+		{Time: day(100), Camera: "cam", State: StateBackoff},
+		{Time: day(100), State: stateHeartbeat},
+		{Time: day(5), Camera: "cam", State: StateStreaming},
+		{Time: day(1), Camera: "cam", State: StateStopped},
+	}
+	path := filepath.Join(t.TempDir(), "uptime.jsonl")
+	var data []byte
+	for _, line := range lines {
+		b, _ := json.Marshal(line)
+		data = append(append(data, b...), '\n')
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openUptimeLog(path, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.close()
+
+	// Only the state each camera was in at the cutoff is kept from before it
+	want := []string{StateBackoff, StateStreaming, StateStopped}
+	records, _ := l.records()
+	written, _, _ := readUptimeLog(path)
+	for _, got := range [][]uptimeRecord{records, written} {
+		if len(got) != len(want) {
+			t.Fatalf("kept %+v, want states %v", got, want)
+		}
+		for i, r := range got {
+			if r.Camera != "cam" || r.State != want[i] {
+				t.Errorf("record %d is %+v, want cam %s", i, r, want[i])
+			}
+		}
+	}
+
+	// The outage that started before the cutoff is still reported
+	report := computeUptime("cam", records, day(30), now, now)
+	if report.OutageCount != 1 || report.DowntimeSeconds != (25*24*time.Hour).Seconds() {
+		t.Errorf("got %d outages, %vs down, want 1 outage of 25 days", report.OutageCount, report.DowntimeSeconds)
+	}
+}
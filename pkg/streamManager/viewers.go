@@ -0,0 +1,245 @@
+package streamManager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrViewerLimitReached is returned when a camera already has maxViewers viewers
+var ErrViewerLimitReached = errors.New("viewer limit reached")
+
+// errViewerKicked is returned to the MJPEG writer once a viewer has been disconnected
+var errViewerKicked = errors.New("viewer disconnected")
+
+// ViewerInfo describes a single client watching a camera stream
+type ViewerInfo struct {
+	ID        string    `json:"id"`
+	RemoteIP  string    `json:"remoteIp"`
+	UserAgent string    `json:"userAgent"`
+	StartedAt time.Time `json:"startedAt"`
+	BytesSent int64     `json:"bytesSent"`
+	FPS       float64   `json:"fps"`
+}
+
+// viewerSession tracks a connected viewer
+type viewerSession struct {
+	ViewerInfo
+
+	mu            sync.Mutex
+	lastFrame     time.Time
+	frameInterval float64 // Smoothed seconds between frames
+	kicked        chan struct{}
+	kickOnce      sync.Once
+}
+
+// newViewerSession creates a session for an incoming stream request
+func newViewerSession(r *http.Request) *viewerSession {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+
+	return &viewerSession{
+		ViewerInfo: ViewerInfo{
+			ID:        hex.EncodeToString(id),
+			RemoteIP:  remoteIP,
+			UserAgent: r.UserAgent(),
+			StartedAt: time.Now(),
+		},
+		kicked: make(chan struct{}),
+	}
+}
+
+// recordFrame accounts for one MJPEG frame written to the viewer
+func (v *viewerSession) recordFrame(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	v.BytesSent += int64(n)
+	if !v.lastFrame.IsZero() {
+		dt := now.Sub(v.lastFrame).Seconds()
+		if v.frameInterval == 0 {
+			v.frameInterval = dt
+		} else {
+			v.frameInterval = 0.8*v.frameInterval + 0.2*dt
+		}
+	}
+	v.lastFrame = now
+}
+
+// snapshot returns the current viewer info
+func (v *viewerSession) snapshot() ViewerInfo {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fps := 0.0
+	// Report 0 fps once the viewer has stopped receiving frames
+	if v.frameInterval > 0 && time.Since(v.lastFrame).Seconds() < 5*v.frameInterval+1 {
+		fps = 1 / v.frameInterval
+	}
+
+	info := v.ViewerInfo
+	info.FPS = fps
+	return info
+}
+
+// kick disconnects the viewer, serveViewer closes its connection
+func (v *viewerSession) kick() {
+	v.kickOnce.Do(func() { close(v.kicked) })
+}
+
+// viewerWriter counts bytes sent to a viewer and fails writes once the viewer is kicked
+// or the handler has returned
+type viewerWriter struct {
+	http.ResponseWriter
+	session *viewerSession
+	metrics *streamMetrics // Counts bytes sent by all viewers of the stream, nil if unknown
+	mu      sync.Mutex
+	header  http.Header // Copied to the response on the first write
+	wrote   bool
+	closed  bool // The ResponseWriter must not be used any more
+}
+
+// Header returns headers that are sent with the first write. The stream sets them on its own
+// goroutine, which must not touch the response once the handler has returned.
+func (w *viewerWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+// Write writes one MJPEG part to the client
+func (w *viewerWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errViewerKicked
+	}
+	select {
+	case <-w.session.kicked:
+		return 0, errViewerKicked
+	default:
+	}
+
+	if !w.wrote {
+		for k, v := range w.header {
+			w.ResponseWriter.Header()[k] = v
+		}
+		w.wrote = true
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.session.recordFrame(n)
+	if w.metrics != nil {
+		w.metrics.bytesSent.Add(uint64(n))
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *viewerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close aborts a write in progress and fails any later write. The expired write deadline
+// also makes the server close the connection once the handler returns.
+func (w *viewerWriter) close() {
+	http.NewResponseController(w.ResponseWriter).SetWriteDeadline(time.Now())
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+}
+
+// serveViewer streams MJPEG to a viewer until the stream ends, the client disconnects or the
+// viewer is kicked. The MJPEG stream only notices the last two when it writes the next frame,
+// which never comes on a stalled stream, so it runs on its own goroutine and returns once
+// that write fails.
+func serveViewer(stream http.Handler, w *viewerWriter, r *http.Request) {
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		stream.ServeHTTP(w, r)
+	}()
+
+	select {
+	case <-served:
+	case <-w.session.kicked:
+	case <-r.Context().Done():
+	}
+	w.close()
+}
+
+// registerViewer adds a viewer session to a stream
+func (si *StreamInfo) registerViewer(session *viewerSession) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.viewers[session.ID] = session
+}
+
+// unregisterViewer removes a viewer session from a stream
+func (si *StreamInfo) unregisterViewer(session *viewerSession) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	delete(si.viewers, session.ID)
+}
+
+// GetViewers returns the active viewer sessions for a camera, oldest first
+func (sm *StreamManager) GetViewers(cameraID string) ([]ViewerInfo, error) {
+	streamInfo, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return nil, err
+	}
+
+	streamInfo.mu.Lock()
+	sessions := make([]*viewerSession, 0, len(streamInfo.viewers))
+	for _, v := range streamInfo.viewers {
+		sessions = append(sessions, v)
+	}
+	streamInfo.mu.Unlock()
+
+	viewers := make([]ViewerInfo, 0, len(sessions))
+	for _, v := range sessions {
+		viewers = append(viewers, v.snapshot())
+	}
+	sort.Slice(viewers, func(i, j int) bool {
+		return viewers[i].StartedAt.Before(viewers[j].StartedAt)
+	})
+	return viewers, nil
+}
+
+// KickViewer disconnects a viewer session from a camera stream
+func (sm *StreamManager) KickViewer(cameraID, viewerID string) error {
+	streamInfo, err := sm.GetStreamInfo(cameraID)
+	if err != nil {
+		return err
+	}
+
+	streamInfo.mu.Lock()
+	session, ok := streamInfo.viewers[viewerID]
+	if ok {
+		delete(streamInfo.viewers, viewerID)
+	}
+	streamInfo.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("viewer not found: %s", viewerID)
+	}
+
+	session.kick()
+	log.Printf("Viewer %s (%s) disconnected from camera %s", viewerID, session.RemoteIP, cameraID)
+	return nil
+}
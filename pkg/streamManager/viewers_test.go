@@ -0,0 +1,163 @@
+package streamManager
+
+import (
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hybridgroup/mjpeg"
+)
+
+// newViewerTestManager returns a manager with a running, stalled stream for one camera
+func newViewerTestManager(maxViewers int) (*StreamManager, *StreamInfo) {
+	camera := Camera{ID: "cam", Enabled: true, MaxViewers: maxViewers}
+	sm := &StreamManager{
+		config: &Config{Cameras: []Camera{camera}},
+		uptime: newMemoryUptimeLog(),
+		events: newEventBus(),
+	}
+	info := &StreamInfo{
+		Stream:      mjpeg.NewStream(),
+		camera:      &camera,
+		subscribers: make(map[chan *image.RGBA]struct{}),
+		viewers:     make(map[string]*viewerSession),
+		decodeCheck: make(chan struct{}, 1),
+	}
+	sm.streams.Store(camera.ID, info)
+	return sm, info
+}
+
+func TestAddViewerLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxViewers int
+		viewers    int // Viewers added before the one that is checked
+		limited    bool
+	}{
+		{name: "unlimited", maxViewers: 0, viewers: 50},
+		{name: "below the limit", maxViewers: 3, viewers: 2},
+		{name: "at the limit", maxViewers: 3, viewers: 3, limited: true},
+		{name: "limit of one", maxViewers: 1, viewers: 1, limited: true},
+	}
+
+	for _, test := range tests {
+		sm, info := newViewerTestManager(test.maxViewers)
+		for i := 0; i < test.viewers; i++ {
+			if err := sm.AddViewer("cam"); err != nil {
+				t.Fatalf("%s: viewer %d: %v", test.name, i+1, err)
+			}
+		}
+
+		err := sm.AddViewer("cam")
+		if got := errors.Is(err, ErrViewerLimitReached); got != test.limited {
+			t.Errorf("%s: got error %v, want limited %v", test.name, err, test.limited)
+		}
+		want := test.viewers + 1
+		if test.limited {
+			want = test.viewers
+		}
+		if info.ViewerCount != want {
+			t.Errorf("%s: %d viewers, want %d", test.name, info.ViewerCount, want)
+		}
+
+		// A leaving viewer frees its slot
+		if test.limited {
+			sm.RemoveViewer("cam")
+			if err := sm.AddViewer("cam"); err != nil {
+				t.Errorf("%s: viewer after one left: %v", test.name, err)
+			}
+		}
+	}
+}
+
+func TestKickStalledViewer(t *testing.T) {
+	sm, _ := newViewerTestManager(1)
+	server := httptest.NewServer(http.HandlerFunc(sm.handleStream))
+	defer server.Close()
+
+	// The stream never produces a frame, so the first viewer is stuck waiting
+	done := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(server.URL + "/stream/cam")
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	var viewers []ViewerInfo
+	deadline := time.Now().Add(time.Second)
+	for len(viewers) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("viewer was not registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+		viewers, _ = sm.GetViewers("cam")
+	}
+
+	// The camera allows one viewer
+	resp, err := http.Get(server.URL + "/stream/cam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second viewer got status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// Kicking closes the connection right away and frees the slot
+	if err := sm.KickViewer("cam", viewers[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("kicked viewer is still connected")
+	}
+	deadline = time.Now().Add(time.Second)
+	for {
+		count, _ := sm.GetViewerCount("cam")
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d viewers after the kick, want 0", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := sm.AddViewer("cam"); err != nil {
+		t.Errorf("new viewer after the kick: %v", err)
+	}
+
+	if err := sm.KickViewer("cam", viewers[0].ID); err == nil {
+		t.Error("kicking the same viewer twice succeeded")
+	}
+}
+
+func TestViewerWriterAfterClose(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	session := newViewerSession(httptest.NewRequest(http.MethodGet, "/stream/cam", nil))
+	w := &viewerWriter{ResponseWriter: recorder, session: session, metrics: &streamMetrics{}}
+
+	// Headers reach the response with the first write
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace")
+	if n, err := w.Write([]byte("frame")); n != 5 || err != nil {
+		t.Fatalf("write before close: %d, %v", n, err)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "multipart/x-mixed-replace" {
+		t.Errorf("content type %q, want the one set before the first write", got)
+	}
+
+	w.close()
+	if _, err := w.Write([]byte("frame")); !errors.Is(err, errViewerKicked) {
+		t.Errorf("write after close returned %v, want %v", err, errViewerKicked)
+	}
+	if got := session.snapshot().BytesSent; got != 5 {
+		t.Errorf("%d bytes sent, want 5", got)
+	}
+}
@@ -0,0 +1,218 @@
+package streamManager
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"strings"
+	"time"
+)
+
+// virtualSourcePrefix marks a camera whose frames come from another camera's decoder
+const virtualSourcePrefix = "camera://"
+
+// maxScale limits the output scale factor of a camera
+const maxScale = 4
+
+// ParentID returns the source camera ID when the camera is derived from another camera
+func (c *Camera) ParentID() (string, bool) {
+	if !strings.HasPrefix(c.RtspUrl, virtualSourcePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(c.RtspUrl, virtualSourcePrefix), true
+}
+
+// validateVirtualSource rejects virtual cameras whose source does not exist, points at
+// the camera itself or forms a cycle. The caller must hold sm.mu.
+func (sm *StreamManager) validateVirtualSource(camera Camera) error {
+	parentID, ok := camera.ParentID()
+	if !ok {
+		return nil
+	}
+	if parentID == "" {
+		return fmt.Errorf("virtual camera %s has no source camera", camera.ID)
+	}
+	if parentID != camera.ID && !sm.hasCamera(parentID) {
+		return fmt.Errorf("virtual camera %s: source camera not found: %s", camera.ID, parentID)
+	}
+
+	visited := map[string]bool{camera.ID: true}
+	for parentID != "" {
+		if visited[parentID] {
+			return fmt.Errorf("virtual camera %s has a source cycle through %s", camera.ID, parentID)
+		}
+		visited[parentID] = true
+
+		next := ""
+		for _, c := range sm.config.Cameras {
+			if c.ID == parentID {
+				next, _ = c.ParentID()
+				break
+			}
+		}
+		parentID = next
+	}
+	return nil
+}
+
+// hasCamera reports whether a camera is configured. The caller must hold sm.mu.
+func (sm *StreamManager) hasCamera(id string) bool {
+	for _, c := range sm.config.Cameras {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLayout checks the camera's crop, rotation and scale
+func validateLayout(camera Camera) error {
+	if camera.Crop != nil && (camera.Crop.X < 0 || camera.Crop.Y < 0 || camera.Crop.Width <= 0 || camera.Crop.Height <= 0) {
+		return fmt.Errorf("crop requires a non-empty region inside the frame")
+	}
+	switch camera.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("rotate must be 0, 90, 180 or 270")
+	}
+	if camera.Scale < 0 || camera.Scale > maxScale {
+		return fmt.Errorf("scale must be between 0 and %g", float64(maxScale))
+	}
+	return nil
+}
+
+// subscribe registers a virtual camera for this stream's decoded frames
+func (si *StreamInfo) subscribe() chan *image.RGBA {
+	ch := make(chan *image.RGBA, 1)
+	si.mu.Lock()
+	si.subscribers[ch] = struct{}{}
+
+	// An attached virtual camera keeps an on-demand source running
+	if si.StopTimer != nil {
+		si.StopTimer.Stop()
+		si.StopTimer = nil
+	}
+	si.mu.Unlock()
+	si.requestDecodeCheck()
+	return ch
+}
+
+// unsubscribe detaches a virtual camera from this stream
+func (si *StreamInfo) unsubscribe(ch chan *image.RGBA) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if _, ok := si.subscribers[ch]; ok {
+		delete(si.subscribers, ch)
+		close(ch)
+	}
+	si.requestDecodeCheck()
+}
+
+// closeSubscribers detaches all virtual cameras, signalling that the source stopped
+func (si *StreamInfo) closeSubscribers() {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	for ch := range si.subscribers {
+		delete(si.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish shares a decoded frame with all virtual cameras.
+// Subscribers receive one read-only copy; slow subscribers skip frames.
+func (si *StreamInfo) publish(img *image.RGBA) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if len(si.subscribers) == 0 {
+		return
+	}
+
+	frame := cloneRGBA(img)
+	for ch := range si.subscribers {
+		select {
+		case ch <- frame:
+		default:
+		}
+	}
+}
+
+// processVirtualCamera renders a camera from another camera's decoded frames
+// instead of opening its own RTSP connection
+func (sm *StreamManager) processVirtualCamera(info *StreamInfo, parentID string) {
+	cameraID := info.cameraConfig().ID
+	defer func() {
+		if sm.streams.CompareAndDelete(cameraID, info) {
+			sm.emit(EventStreamStopped, cameraID, nil)
+		}
+		info.closeSubscribers()
+		log.Printf("Stream processing stopped and cleaned up for camera: %s", cameraID)
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go sm.watchStall(cameraID, info, done)
+
+	// Transformed frames are passed on to cameras derived from this one
+	pipeline := sm.startPipeline(info, true)
+	defer pipeline.close()
+
+	for {
+		parent, err := sm.GetStreamInfo(parentID)
+		if err != nil {
+			if err := sm.StartStream(parentID); err != nil {
+				log.Printf("Failed to start source camera %s for virtual camera %s: %v", parentID, cameraID, err)
+				sm.recordState(cameraID, info, StateBackoff, err.Error())
+			}
+			parent, err = sm.GetStreamInfo(parentID)
+		}
+
+		if err == nil {
+			log.Printf("Virtual camera %s attached to source camera %s", cameraID, parentID)
+			frames := parent.subscribe()
+			stopped := sm.renderVirtualFrames(cameraID, info, pipeline, frames)
+			parent.unsubscribe(frames)
+			if !stopped {
+				sm.recordState(cameraID, info, StateBackoff, "source camera "+parentID+" stopped")
+			}
+
+			// An on-demand source may no longer be needed
+			sm.checkIdle(parentID)
+			if stopped {
+				return
+			}
+		}
+
+		// Check if we should stop before retrying
+		select {
+		case <-info.stop:
+			return
+		case <-time.After(5 * time.Second):
+			log.Printf("Reattaching virtual camera %s to source camera %s", cameraID, parentID)
+		}
+	}
+}
+
+// renderVirtualFrames feeds source frames to the pipeline until the source stops or the stream is stopped.
+// Returns true if the virtual camera itself was stopped.
+func (sm *StreamManager) renderVirtualFrames(cameraID string, info *StreamInfo, pipeline *framePipeline, frames <-chan *image.RGBA) bool {
+	streaming := false
+	for {
+		select {
+		case <-info.stop:
+			return true
+		case frame, ok := <-frames:
+			if !ok {
+				return false
+			}
+			if !streaming {
+				streaming = true
+				sm.recordState(cameraID, info, StateStreaming, "")
+			}
+			if !info.allowFrame() {
+				continue
+			}
+			// Frames are shared between virtual cameras, never draw on them directly
+			pipeline.submit(&pipelineFrame{img: frame, shared: true, start: time.Now()})
+		}
+	}
+}
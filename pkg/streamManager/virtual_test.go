@@ -0,0 +1,120 @@
+package streamManager
+
+import (
+	"image"
+	"testing"
+)
+
+func TestValidateVirtualSource(t *testing.T) {
+	sm := &StreamManager{config: &Config{Cameras: []Camera{
+		{ID: "panorama", RtspUrl: "rtsp://camera/stream"},
+		{ID: "left", RtspUrl: "camera://panorama"},
+		{ID: "a", RtspUrl: "camera://b"},
+		{ID: "b", RtspUrl: "camera://left"},
+	}}}
+
+	tests := []struct {
+		name   string
+		camera Camera
+		valid  bool
+	}{
+		{name: "rtsp camera", camera: Camera{ID: "x", RtspUrl: "rtsp://camera/stream"}, valid: true},
+		{name: "derived from a camera", camera: Camera{ID: "right", RtspUrl: "camera://panorama"}, valid: true},
+		{name: "derived from a virtual camera", camera: Camera{ID: "detail", RtspUrl: "camera://left"}, valid: true},
+		{name: "no source", camera: Camera{ID: "x", RtspUrl: "camera://"}},
+		{name: "unknown source", camera: Camera{ID: "x", RtspUrl: "camera://missing"}},
+		{name: "self reference", camera: Camera{ID: "x", RtspUrl: "camera://x"}},
+		{name: "A to B to A", camera: Camera{ID: "b", RtspUrl: "camera://a"}},
+		{name: "longer cycle", camera: Camera{ID: "left", RtspUrl: "camera://a"}},
+		{name: "existing chain", camera: Camera{ID: "a", RtspUrl: "camera://b"}, valid: true},
+	}
+
+	for _, test := range tests {
+		err := sm.validateVirtualSource(test.camera)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestUpdateCameraRejectsCycle(t *testing.T) {
+	sm := &StreamManager{config: &Config{Cameras: []Camera{
+		{ID: "a", RtspUrl: "rtsp://camera/stream"},
+		{ID: "b", RtspUrl: "camera://a"},
+	}}}
+
+	// Pointing a at b would make a and b feed each other
+	if err := sm.UpdateCamera("a", Camera{RtspUrl: "camera://b"}); err == nil {
+		t.Fatal("UpdateCamera accepted a source cycle")
+	}
+	if got := sm.config.Cameras[0].RtspUrl; got != "rtsp://camera/stream" {
+		t.Errorf("camera a changed to %s despite the error", got)
+	}
+	if err := sm.AddCamera(Camera{ID: "c", RtspUrl: "camera://missing"}); err == nil {
+		t.Error("AddCamera accepted an unknown source")
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		camera Camera
+		valid  bool
+	}{
+		{name: "none", camera: Camera{}, valid: true},
+		{name: "crop, rotate and scale", camera: Camera{Crop: &Rect{X: 960, Width: 960, Height: 1080}, Rotate: 90, Scale: 0.5}, valid: true},
+		{name: "empty crop", camera: Camera{Crop: &Rect{Width: 0, Height: 100}}},
+		{name: "crop outside the frame", camera: Camera{Crop: &Rect{X: -10, Width: 100, Height: 100}}},
+		{name: "rotate by 45", camera: Camera{Rotate: 45}},
+		{name: "negative scale", camera: Camera{Scale: -1}},
+		{name: "huge scale", camera: Camera{Scale: maxScale + 1}},
+	}
+
+	for _, test := range tests {
+		err := validateLayout(test.camera)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestApplyLayout(t *testing.T) {
+	// A virtual camera showing the right half of a panorama, rotated and scaled down
+	camera := &Camera{Crop: &Rect{X: 4, Width: 4, Height: 2}, Rotate: 90, Scale: 0.5}
+	src := gridRGBA(8, 2)
+
+	dst := applyTransforms(camera, src)
+	if got := dst.Bounds().Size(); got != image.Pt(1, 2) {
+		t.Errorf("size %v, want 1x2", got)
+	}
+
+	// The parent's frame is shared between cameras and must not change
+	if sourceOf(src, 5, 1) != image.Pt(5, 1) {
+		t.Error("source frame was modified")
+	}
+}
+
+func TestPublishToVirtualCameras(t *testing.T) {
+	info := &StreamInfo{subscribers: make(map[chan *image.RGBA]struct{}), decodeCheck: make(chan struct{}, 1)}
+	fast := info.subscribe()
+	slow := info.subscribe()
+
+	frame := gridRGBA(4, 4)
+	info.publish(frame)
+	<-fast
+	info.publish(frame)
+
+	// Each subscriber gets a copy, a slow subscriber skips frames instead of blocking
+	got := <-fast
+	if got == frame {
+		t.Error("subscriber received the source frame instead of a copy")
+	}
+	if len(slow) != 1 {
+		t.Errorf("slow subscriber has %d frames queued, want 1", len(slow))
+	}
+
+	info.closeSubscribers()
+	if _, ok := <-fast; ok {
+		t.Error("subscriber channel still open after the source stopped")
+	}
+}